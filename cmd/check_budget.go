@@ -0,0 +1,72 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/kalverra/workflow-metrics/observe"
+	"github.com/rs/zerolog/log"
+	"github.com/spf13/cobra"
+)
+
+var (
+	budgetWebhookURL string
+	budgetOpenIssue  bool
+)
+
+var checkBudgetCmd = &cobra.Command{
+	Use:         "check-budget",
+	Short:       "Check gathered CI spend against the budgets in the config file",
+	Long:        "Check gathered CI spend against the budgets in the config file, and exit non-zero if any are exceeded. Budgets without a repo check the repos in the config file, or every repo in the store, unless an owner and repo are provided. Budgets that need attention can be posted to a Slack compatible webhook, and exceeded budgets can open GitHub issues.",
+	Annotations: map[string]string{annotationOffline: "", annotationAnyRepo: ""},
+	RunE: func(cmd *cobra.Command, args []string) error {
+		log.Debug().
+			Bool("webhook-url", budgetWebhookURL != "").
+			Bool("open-issue", budgetOpenIssue).
+			Msg("check-budget flags")
+
+		budgets := configuredBudgets()
+		if len(budgets) == 0 {
+			return fmt.Errorf("no budgets in the config file")
+		}
+		repos, err := configuredRepos()
+		if err != nil {
+			return err
+		}
+		results, err := observe.CheckBudgets(budgets, repos, time.Now())
+		if err != nil {
+			return err
+		}
+
+		var errs error
+		if budgetWebhookURL != "" {
+			errs = errors.Join(errs, observe.PostBudgetWebhook(budgetWebhookURL, owner, repo, results))
+		}
+		exceeded := 0
+		for _, result := range results {
+			if result.Status == observe.BudgetExceeded {
+				exceeded++
+			}
+		}
+		if budgetOpenIssue && exceeded > 0 {
+			// Only connect to GitHub when there are issues to open
+			githubClient, err = getGitHubClient()
+			if err != nil {
+				return errors.Join(errs, fmt.Errorf("failed to create GitHub client: %w", err))
+			}
+			errs = errors.Join(errs, observe.OpenBudgetIssues(githubClient, owner, repo, results))
+		}
+		if exceeded > 0 {
+			errs = errors.Join(errs, fmt.Errorf("%d of %d budgets exceeded", exceeded, len(results)))
+		}
+		return errs
+	},
+}
+
+func init() {
+	checkBudgetCmd.Flags().StringVar(&budgetWebhookURL, "webhook-url", "", "Slack compatible incoming webhook to post budgets that need attention to, when their status or spend changed since the last post")
+	checkBudgetCmd.Flags().BoolVar(&budgetOpenIssue, "open-issue", false, "Open a GitHub issue for each exceeded budget, or comment on the one already open")
+
+	rootCmd.AddCommand(checkBudgetCmd)
+}
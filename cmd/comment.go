@@ -0,0 +1,27 @@
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/kalverra/workflow-metrics/observe"
+	"github.com/spf13/cobra"
+)
+
+var commentCmd = &cobra.Command{
+	Use:   "comment",
+	Short: "Create or update a sticky pull request comment summarizing its CI runs",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if pullRequestID == "" {
+			return fmt.Errorf("pull request ID must be provided")
+		}
+		number, err := pullRequestNumber()
+		if err != nil {
+			return err
+		}
+		return observe.PullRequestComment(githubClient, owner, repo, number)
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(commentCmd)
+}
@@ -0,0 +1,61 @@
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/kalverra/workflow-metrics/observe"
+	"github.com/rs/zerolog/log"
+	"github.com/spf13/cobra"
+)
+
+var (
+	baseWorkflowRunID   int64
+	headWorkflowRunID   int64
+	regressionThreshold float64
+	compareOutputTypes  []string
+)
+
+var compareCmd = &cobra.Command{
+	Use:   "compare",
+	Short: "Compare two workflow runs",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		log.Debug().
+			Int64("base", baseWorkflowRunID).
+			Int64("head", headWorkflowRunID).
+			Float64("regression-threshold", regressionThreshold).
+			Strs("output-types", compareOutputTypes).
+			Msg("compare flags")
+
+		if baseWorkflowRunID == headWorkflowRunID {
+			return fmt.Errorf("base and head workflow run IDs must be different")
+		}
+
+		return observe.CompareWorkflowRuns(
+			githubClient,
+			owner,
+			repo,
+			baseWorkflowRunID,
+			headWorkflowRunID,
+			regressionThreshold,
+			compareOutputTypes,
+		)
+	},
+}
+
+func init() {
+	compareCmd.Flags().Int64Var(&baseWorkflowRunID, "base", 0, "Workflow run ID to compare against")
+	compareCmd.Flags().Int64Var(&headWorkflowRunID, "head", 0, "Workflow run ID to compare")
+	compareCmd.Flags().Float64Var(&regressionThreshold, "regression-threshold", 10, "Percentage a job's duration must grow by to be flagged as regressed")
+	compareCmd.Flags().StringArrayVar(&compareOutputTypes, "output-types", []string{"html", "md"}, "Output types to generate")
+
+	err := compareCmd.MarkFlagRequired("base")
+	if err != nil {
+		log.Fatal().Err(err).Msg("Failed to mark flag as required")
+	}
+	err = compareCmd.MarkFlagRequired("head")
+	if err != nil {
+		log.Fatal().Err(err).Msg("Failed to mark flag as required")
+	}
+
+	rootCmd.AddCommand(compareCmd)
+}
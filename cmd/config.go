@@ -0,0 +1,405 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/kalverra/workflow-metrics/gather"
+	"github.com/kalverra/workflow-metrics/observe"
+	"github.com/kalverra/workflow-metrics/store"
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	defaultConfigFileName = ".workflow-metrics.yaml"
+	// envVarPrefix prefixes the environment variables that override flags, e.g. WORKFLOW_METRICS_DATA_DIR
+	envVarPrefix = "WORKFLOW_METRICS_"
+)
+
+var configFile string
+
+// config is the contents of a config file. Every setting can be overridden by its environment variable, which
+// can be overridden by its flag.
+type config struct {
+	Owner string `yaml:"owner"`
+	Repo  string `yaml:"repo"`
+	// Repos lists the owner/repo pairs that multi-repo commands, like migrate and export, run on
+	Repos []string `yaml:"repos"`
+
+	GitHub githubConfig `yaml:"github"`
+
+	LogFile       string `yaml:"log_file"`
+	LogLevel      string `yaml:"log_level"`
+	DataDir       string `yaml:"data_dir"`
+	OutputDir     string `yaml:"output_dir"`
+	Store         string `yaml:"store"`
+	StorageFormat string `yaml:"storage_format"`
+	Dataset       string `yaml:"dataset"`
+
+	// MaxAPICalls and ReserveRateLimit budget the GitHub API calls a run can make
+	MaxAPICalls      int `yaml:"max_api_calls"`
+	ReserveRateLimit int `yaml:"reserve_rate_limit"`
+
+	OutputTypes []string `yaml:"output_types"`
+	// Pricing overrides the per-minute rate of runners, in tenths of a cent
+	Pricing map[string]int64 `yaml:"pricing"`
+
+	Gather gatherConfig `yaml:"gather"`
+	Export exportConfig `yaml:"export"`
+	Report reportConfig `yaml:"report"`
+
+	// Budgets are the limits on CI spend that check-budget evaluates
+	Budgets []budgetConfig `yaml:"budgets"`
+	Alerts  alertsConfig   `yaml:"alerts"`
+
+	Notify notifyConfig `yaml:"notify"`
+}
+
+// githubConfig describes how to connect and authenticate to GitHub
+type githubConfig struct {
+	// URL is a GitHub Enterprise Server URL, e.g. https://github.example.com
+	URL string `yaml:"url"`
+	// UploadURL is the GitHub Enterprise Server upload URL, if it differs from URL
+	UploadURL string `yaml:"upload_url"`
+
+	// TokenEnv is the environment variable to read the token from, instead of GITHUB_TOKEN
+	TokenEnv string `yaml:"token_env"`
+	// TokenFile is a file to read the token from
+	TokenFile string `yaml:"token_file"`
+
+	// AppID is a GitHub App to authenticate as instead of a token
+	AppID int64 `yaml:"app_id"`
+	// AppPrivateKey is the path to the GitHub App's private key, or its PEM contents
+	AppPrivateKey string `yaml:"app_private_key"`
+	// Installations are the GitHub App's installation IDs by owner. Owners that aren't listed are looked up.
+	Installations map[string]int64 `yaml:"installations"`
+
+	// Timeout is how long a single GitHub API call can take, e.g. 30s
+	Timeout string `yaml:"timeout"`
+	// Retries is how many times a failed GitHub API call is retried
+	Retries *int `yaml:"retries"`
+}
+
+type gatherConfig struct {
+	// Concurrency is how many workflow runs are gathered at once
+	Concurrency int `yaml:"concurrency"`
+}
+
+type exportConfig struct {
+	Format string `yaml:"format"`
+	Dir    string `yaml:"dir"`
+}
+
+type reportConfig struct {
+	Workflow            string   `yaml:"workflow"`
+	Branch              string   `yaml:"branch"`
+	OutputTypes         []string `yaml:"output_types"`
+	RegressionThreshold *float64 `yaml:"regression_threshold"`
+	// CostGroupBy are the dimensions report cost rolls up by
+	CostGroupBy []string `yaml:"cost_group_by"`
+}
+
+// budgetConfig is a limit on CI spend over a period, see observe.Budget
+type budgetConfig struct {
+	Name        string  `yaml:"name"`
+	Repo        string  `yaml:"repo"`
+	Workflow    string  `yaml:"workflow"`
+	Runner      string  `yaml:"runner"`
+	Period      string  `yaml:"period"`
+	Limit       float64 `yaml:"limit"`
+	WarnPercent float64 `yaml:"warn_percent"`
+}
+
+// alertsConfig describes where check-budget sends alerts
+type alertsConfig struct {
+	// WebhookURL is a Slack compatible incoming webhook
+	WebhookURL string `yaml:"webhook_url"`
+	// OpenIssue opens a GitHub issue for each exceeded budget
+	OpenIssue bool `yaml:"open_issue"`
+}
+
+// notifyConfig describes the chat webhook notify posts to
+type notifyConfig struct {
+	// Kind is slack or teams
+	Kind       string `yaml:"kind"`
+	WebhookURL string `yaml:"webhook_url"`
+	ReportURL  string `yaml:"report_url"`
+	// RunTemplate and DigestTemplate are text/template files for the messages, instead of the defaults
+	RunTemplate    string `yaml:"run_template"`
+	DigestTemplate string `yaml:"digest_template"`
+}
+
+var cfg config
+
+// loadConfig reads the config file, from the --config flag or discovered in the working or home directory, and
+// applies it and environment variables to every flag of cmd that wasn't set on the command line
+func loadConfig(cmd *cobra.Command) error {
+	path, err := findConfigFile()
+	if err != nil {
+		return err
+	}
+	if path != "" {
+		file, err := os.Open(path)
+		if err != nil {
+			return fmt.Errorf("failed to open config file '%s': %w", path, err)
+		}
+		decoder := yaml.NewDecoder(file)
+		decoder.KnownFields(true)
+		err = decoder.Decode(&cfg)
+		file.Close()
+		// An empty config file is valid
+		if err != nil && !errors.Is(err, io.EOF) {
+			return fmt.Errorf("failed to parse config file '%s': %w", path, err)
+		}
+		configFile = path
+	}
+
+	configValues := cfg.flagValues(cmd)
+	var errs error
+	cmd.Flags().VisitAll(func(flag *pflag.Flag) {
+		if flag.Changed || flag.Name == "config" {
+			return
+		}
+		values, source := configValues[flag.Name], "config file"
+		if env, ok := os.LookupEnv(flagEnvVar(flag.Name)); ok {
+			values, source = []string{env}, flagEnvVar(flag.Name)
+			if _, isSlice := flag.Value.(pflag.SliceValue); isSlice {
+				values = strings.Split(env, ",")
+			}
+		}
+		if len(values) == 0 {
+			return
+		}
+		if err := setFlag(flag, values); err != nil {
+			errs = errors.Join(errs, fmt.Errorf("invalid %s from %s: %w", flag.Name, source, err))
+		}
+	})
+	if errs != nil {
+		return errs
+	}
+
+	if len(cfg.Pricing) > 0 {
+		gather.SetRunnerRates(cfg.Pricing)
+	}
+	return nil
+}
+
+// findConfigFile returns the config file to use, or an empty string if there is none
+func findConfigFile() (string, error) {
+	if configFile != "" {
+		if _, err := os.Stat(configFile); err != nil {
+			return "", fmt.Errorf("failed to find config file '%s': %w", configFile, err)
+		}
+		return configFile, nil
+	}
+	if path, ok := os.LookupEnv(envVarPrefix + "CONFIG"); ok && path != "" {
+		return path, nil
+	}
+
+	dirs := []string{"."}
+	if home, err := os.UserHomeDir(); err == nil {
+		dirs = append(dirs, home)
+	}
+	for _, dir := range dirs {
+		path := filepath.Join(dir, defaultConfigFileName)
+		if _, err := os.Stat(path); err == nil {
+			return path, nil
+		}
+	}
+	return "", nil
+}
+
+// flagValues maps flag names to their values from the config file. Some settings only apply to some commands,
+// as different commands reuse the same flag names.
+func (c config) flagValues(cmd *cobra.Command) map[string][]string {
+	values := map[string][]string{}
+	set := func(name, value string) {
+		if value != "" {
+			values[name] = []string{value}
+		}
+	}
+
+	set("owner", c.Owner)
+	set("repo", c.Repo)
+	if c.Owner == "" && c.Repo == "" && len(c.Repos) == 1 {
+		if r, err := parseRepo(c.Repos[0]); err == nil {
+			set("owner", r.Owner)
+			set("repo", r.Repo)
+		}
+	}
+	set("github-url", c.GitHub.URL)
+	set("github-upload-url", c.GitHub.UploadURL)
+	if c.GitHub.AppID != 0 {
+		set("github-app-id", strconv.FormatInt(c.GitHub.AppID, 10))
+	}
+	set("github-app-private-key", c.GitHub.AppPrivateKey)
+	set("github-timeout", c.GitHub.Timeout)
+	if c.GitHub.Retries != nil {
+		set("github-retries", strconv.Itoa(*c.GitHub.Retries))
+	}
+	if c.MaxAPICalls != 0 {
+		set("max-api-calls", strconv.Itoa(c.MaxAPICalls))
+	}
+	if c.ReserveRateLimit != 0 {
+		set("reserve-rate-limit", strconv.Itoa(c.ReserveRateLimit))
+	}
+	set("log-file", c.LogFile)
+	set("log-level", c.LogLevel)
+	set("data-dir", c.DataDir)
+	set("output-dir", c.OutputDir)
+	set("store", c.Store)
+	set("storage-format", c.StorageFormat)
+	set("dataset", c.Dataset)
+	// Output types are only applied to commands that support every one of them, e.g. not csv to compare
+	if len(c.OutputTypes) > 0 && supportsOutputTypes(cmd, c.OutputTypes) {
+		values["output-types"] = c.OutputTypes
+	}
+
+	switch {
+	case cmd == gatherCmd:
+		if c.Gather.Concurrency != 0 {
+			set("concurrency", strconv.Itoa(c.Gather.Concurrency))
+		}
+	case cmd == exportCmd:
+		set("format", c.Export.Format)
+		set("export-dir", c.Export.Dir)
+	case cmd == compareCmd:
+		if c.Report.RegressionThreshold != nil {
+			set("regression-threshold", strconv.FormatFloat(*c.Report.RegressionThreshold, 'f', -1, 64))
+		}
+	case cmd == checkBudgetCmd:
+		set("webhook-url", c.Alerts.WebhookURL)
+		if c.Alerts.OpenIssue {
+			set("open-issue", "true")
+		}
+	case cmd.Parent() == notifyCmd:
+		set("kind", c.Notify.Kind)
+		set("webhook-url", c.Notify.WebhookURL)
+		set("report-url", c.Notify.ReportURL)
+		if cmd == notifyRunCmd {
+			set("template", c.Notify.RunTemplate)
+		} else {
+			set("template", c.Notify.DigestTemplate)
+		}
+	case cmd.Parent() == reportCmd:
+		set("workflow", c.Report.Workflow)
+		set("branch", c.Report.Branch)
+		if len(c.Report.OutputTypes) > 0 {
+			values["output-types"] = c.Report.OutputTypes
+		}
+		if cmd == costCmd && len(c.Report.CostGroupBy) > 0 {
+			values["group-by"] = c.Report.CostGroupBy
+		}
+	}
+	return values
+}
+
+// supportsOutputTypes checks if cmd has an output-types flag that supports every one of outputTypes
+func supportsOutputTypes(cmd *cobra.Command, outputTypes []string) bool {
+	var supported []string
+	switch cmd {
+	case observeCmd:
+		supported = []string{"html", "md", "csv", "step-summary"}
+	case compareCmd, trendCmd:
+		supported = []string{"html", "md"}
+	case flakyCmd:
+		supported = []string{"html", "md", "json"}
+	case costCmd:
+		supported = []string{"html", "md", "csv"}
+	}
+	for _, outputType := range outputTypes {
+		if !slices.Contains(supported, outputType) {
+			return false
+		}
+	}
+	return true
+}
+
+// configuredBudgets returns the budgets in the config file
+func configuredBudgets() []observe.Budget {
+	budgets := make([]observe.Budget, 0, len(cfg.Budgets))
+	for i, b := range cfg.Budgets {
+		name := b.Name
+		if name == "" {
+			name = fmt.Sprintf("budget %d", i+1)
+		}
+		budgets = append(budgets, observe.Budget{
+			Name:        name,
+			Repo:        b.Repo,
+			Workflow:    b.Workflow,
+			Runner:      b.Runner,
+			Period:      b.Period,
+			Limit:       b.Limit,
+			WarnPercent: b.WarnPercent,
+		})
+	}
+	return budgets
+}
+
+// configuredRepos returns the repos that multi-repo commands run on. That's the owner and repo if provided,
+// otherwise the repos in the config file, otherwise every repo in the store.
+func configuredRepos() ([]store.Repo, error) {
+	if owner != "" && repo != "" {
+		return []store.Repo{{Owner: owner, Repo: repo}}, nil
+	}
+	if len(cfg.Repos) > 0 {
+		repos := make([]store.Repo, 0, len(cfg.Repos))
+		for _, r := range cfg.Repos {
+			parsed, err := parseRepo(r)
+			if err != nil {
+				return nil, err
+			}
+			repos = append(repos, parsed)
+		}
+		return repos, nil
+	}
+
+	repos, err := dataStore.Repos()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list repos in store: %w", err)
+	}
+	return repos, nil
+}
+
+// configGitHubToken reads the GitHub token from the source in the config file, if there is one
+func configGitHubToken() (string, error) {
+	if cfg.GitHub.TokenEnv != "" {
+		return os.Getenv(cfg.GitHub.TokenEnv), nil
+	}
+	if cfg.GitHub.TokenFile != "" {
+		token, err := os.ReadFile(cfg.GitHub.TokenFile)
+		if err != nil {
+			return "", fmt.Errorf("failed to read GitHub token file '%s': %w", cfg.GitHub.TokenFile, err)
+		}
+		return strings.TrimSpace(string(token)), nil
+	}
+	return "", nil
+}
+
+func parseRepo(fullName string) (store.Repo, error) {
+	r, name, ok := strings.Cut(fullName, "/")
+	if !ok || r == "" || name == "" || strings.Contains(name, "/") {
+		return store.Repo{}, fmt.Errorf("invalid repo '%s', must be owner/repo", fullName)
+	}
+	return store.Repo{Owner: r, Repo: name}, nil
+}
+
+// flagEnvVar is the environment variable that overrides a flag, e.g. WORKFLOW_METRICS_DATA_DIR for --data-dir
+func flagEnvVar(name string) string {
+	return envVarPrefix + strings.ToUpper(strings.ReplaceAll(name, "-", "_"))
+}
+
+func setFlag(flag *pflag.Flag, values []string) error {
+	if slice, ok := flag.Value.(pflag.SliceValue); ok {
+		return slice.Replace(values)
+	}
+	return flag.Value.Set(values[0])
+}
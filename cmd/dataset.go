@@ -0,0 +1,67 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/kalverra/workflow-metrics/gather"
+	"github.com/rs/zerolog/log"
+	"github.com/spf13/cobra"
+)
+
+var queryFormat string
+
+var ingestCmd = &cobra.Command{
+	Use:         "ingest",
+	Short:       "Ingest all gathered workflow runs of a repo into the SQLite dataset",
+	Annotations: map[string]string{annotationOffline: ""},
+	RunE: func(cmd *cobra.Command, args []string) error {
+		workflowRuns, err := gather.LocalWorkflowRuns(owner, repo)
+		if err != nil {
+			return err
+		}
+		return ingest(workflowRuns)
+	},
+}
+
+var queryCmd = &cobra.Command{
+	Use:         "query <sql>",
+	Short:       "Run a SQL query against the SQLite dataset",
+	Long:        "Run a SQL query against the SQLite dataset. Tables are runs, attempts, jobs, steps, and monitor_samples.",
+	Args:        cobra.ExactArgs(1),
+	Annotations: map[string]string{annotationOffline: "", annotationAnyRepo: ""},
+	RunE: func(cmd *cobra.Command, args []string) error {
+		log.Debug().
+			Str("query", args[0]).
+			Str("format", queryFormat).
+			Msg("query flags")
+
+		ds, err := openDataset()
+		if err != nil {
+			return err
+		}
+		return errors.Join(ds.Query(os.Stdout, args[0], queryFormat), ds.Close())
+	},
+}
+
+// ingest writes workflow runs into the SQLite dataset
+func ingest(workflowRuns []*gather.WorkflowRunData) error {
+	ds, err := openDataset()
+	if err != nil {
+		return err
+	}
+	err = ds.Ingest(owner, repo, workflowRuns...)
+	if err != nil {
+		return errors.Join(fmt.Errorf("failed to ingest workflow runs: %w", err), ds.Close())
+	}
+	log.Info().Int("workflow_run_count", len(workflowRuns)).Msg("Ingested workflow runs into dataset")
+	return ds.Close()
+}
+
+func init() {
+	queryCmd.Flags().StringVar(&queryFormat, "format", "table", "Output format (table, csv, json)")
+
+	rootCmd.AddCommand(ingestCmd)
+	rootCmd.AddCommand(queryCmd)
+}
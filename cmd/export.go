@@ -0,0 +1,48 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/kalverra/workflow-metrics/export"
+	"github.com/rs/zerolog/log"
+	"github.com/spf13/cobra"
+)
+
+var (
+	exportFormat string
+	exportDir    string
+)
+
+var exportCmd = &cobra.Command{
+	Use:         "export",
+	Short:       "Export gathered data as runs, jobs, and steps tables for data warehouses",
+	Long:        "Export gathered data as runs, jobs, and steps tables for data warehouses, partitioned by repo and date. Exports the repos in the config file, or every repo in the store, unless an owner and repo are provided.",
+	Annotations: map[string]string{annotationOffline: "", annotationAnyRepo: ""},
+	RunE: func(cmd *cobra.Command, args []string) error {
+		log.Debug().
+			Str("format", exportFormat).
+			Str("export-dir", exportDir).
+			Msg("export flags")
+
+		repos, err := configuredRepos()
+		if err != nil {
+			return err
+		}
+
+		var errs error
+		for _, r := range repos {
+			if err := export.WorkflowRuns(r.Owner, r.Repo, exportDir, exportFormat); err != nil {
+				errs = errors.Join(errs, fmt.Errorf("failed to export %s/%s: %w", r.Owner, r.Repo, err))
+			}
+		}
+		return errs
+	},
+}
+
+func init() {
+	exportCmd.Flags().StringVar(&exportFormat, "format", export.FormatParquet, fmt.Sprintf("Export format (%s, %s)", export.FormatParquet, export.FormatNDJSON))
+	exportCmd.Flags().StringVar(&exportDir, "export-dir", "export", "Directory to write exported tables to")
+
+	rootCmd.AddCommand(exportCmd)
+}
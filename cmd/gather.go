@@ -1,7 +1,9 @@
 package cmd
 
 import (
+	"errors"
 	"fmt"
+	"time"
 
 	"github.com/kalverra/workflow-metrics/gather"
 	"github.com/rs/zerolog/log"
@@ -11,33 +13,138 @@ import (
 const githubTokenEnvVar = "GITHUB_TOKEN"
 
 var (
-	githubToken string
-	forceUpdate bool
+	githubToken   string
+	forceUpdate   bool
+	wait          bool
+	maxWait       time.Duration
+	partialGather bool
+	since         string
+	until         string
+	concurrency   int
 )
 
 var gatherCmd = &cobra.Command{
 	Use:   "gather",
 	Short: "Gather metrics from GitHub",
+	Long: `Gather metrics from GitHub for a workflow run, a pull request, or every workflow run created in a time range.
+
+Many workflow runs are gathered at once with --concurrency workers. Workflow runs that fail don't stop the others,
+and the failures are summarized at the end.`,
+	PreRunE: func(cmd *cobra.Command, args []string) error {
+		if since == "" {
+			return requireRunOrPullRequest(cmd, args)
+		}
+		if workflowRunID != 0 || pullRequestID != "" {
+			return fmt.Errorf("--since can't be combined with a workflow run ID or pull request ID")
+		}
+		return nil
+	},
 	RunE: func(cmd *cobra.Command, args []string) error {
 		log.Debug().
 			Bool("force-update", forceUpdate).
+			Bool("wait", wait).
+			Str("max-wait", maxWait.String()).
+			Bool("partial", partialGather).
+			Str("since", since).
+			Str("until", until).
+			Int("concurrency", concurrency).
 			Msg("gather flags")
 
+		if wait {
+			gather.SetWait(maxWait)
+		}
+		gather.SetPartial(partialGather)
+		gather.SetConcurrency(concurrency)
+
+		var (
+			workflowRuns []*gather.WorkflowRunData
+			gatherErr    error
+		)
 		if workflowRunID != 0 {
-			_, err := gather.WorkflowRun(githubClient, owner, repo, workflowRunID, forceUpdate)
-			return err
+			workflowRun, err := gather.WorkflowRun(githubClient, owner, repo, workflowRunID, forceUpdate)
+			if err != nil {
+				return err
+			}
+			workflowRuns = append(workflowRuns, workflowRun)
 		}
 
 		if pullRequestID != "" {
-			return fmt.Errorf("pull request gathering not implemented yet")
+			pullRequestNumber, err := pullRequestNumber()
+			if err != nil {
+				return err
+			}
+			// Workflow runs that were gathered are still ingested when others failed
+			pullRequest, err := gather.PullRequest(githubClient, owner, repo, pullRequestNumber, forceUpdate)
+			if pullRequest == nil {
+				return err
+			}
+			gatherErr = err
+			workflowRuns = append(workflowRuns, pullRequest.WorkflowRuns...)
 		}
 
-		return nil
+		if since != "" {
+			from, to, err := backfillRange(since, until)
+			if err != nil {
+				return err
+			}
+			workflowRunIDs, err := gather.WorkflowRunIDsCreated(githubClient, owner, repo, from, to)
+			if err != nil {
+				return err
+			}
+			// Workflow runs that were gathered are still ingested when others failed
+			backfilled, err := gather.WorkflowRuns(githubClient, owner, repo, workflowRunIDs, forceUpdate)
+			gatherErr = err
+			workflowRuns = append(workflowRuns, backfilled...)
+		}
+
+		if datasetPath != "" {
+			return errors.Join(gatherErr, ingest(workflowRuns))
+		}
+		return gatherErr
 	},
 }
 
 func init() {
 	gatherCmd.Flags().BoolVarP(&forceUpdate, "force-update", "u", false, "Force update of existing data")
+	gatherCmd.Flags().BoolVar(&wait, "wait", false, "Wait for in-progress workflow runs to complete, polling with backoff. The workflow run this is running in can't complete while waiting, so it fails, or is snapshotted with --partial")
+	gatherCmd.Flags().DurationVar(&maxWait, "max-wait", 30*time.Minute, "Longest to wait for in-progress workflow runs with --wait")
+	gatherCmd.Flags().BoolVar(&partialGather, "partial", false, "Store a snapshot of workflow runs that are still in progress, marked as partial, instead of failing. With --wait, only after the max wait")
+	gatherCmd.Flags().StringVar(&since, "since", "", "Backfill every workflow run created since a date (2006-01-02), time (RFC 3339), or duration ago (e.g. 720h)")
+	gatherCmd.Flags().StringVar(&until, "until", "", "Only backfill workflow runs created until a date, time, or duration ago (default now)")
+	gatherCmd.Flags().IntVar(&concurrency, "concurrency", 4, "Number of workflow runs to gather at once")
 
 	rootCmd.AddCommand(gatherCmd)
 }
+
+// backfillRange parses the --since and --until flags into the time range to backfill workflow runs from
+func backfillRange(since, until string) (from, to time.Time, err error) {
+	from, err = parseTimeFlag(since)
+	if err != nil {
+		return from, to, fmt.Errorf("invalid --since: %w", err)
+	}
+	to = time.Now()
+	if until != "" {
+		to, err = parseTimeFlag(until)
+		if err != nil {
+			return from, to, fmt.Errorf("invalid --until: %w", err)
+		}
+	}
+	if !from.Before(to) {
+		return from, to, fmt.Errorf("--since '%s' must be before --until '%s'", from.Format(time.RFC3339), to.Format(time.RFC3339))
+	}
+	return from, to, nil
+}
+
+// parseTimeFlag parses a date, RFC 3339 time, or a duration before now
+func parseTimeFlag(value string) (time.Time, error) {
+	if t, err := time.Parse(time.DateOnly, value); err == nil {
+		return t, nil
+	}
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+	if d, err := time.ParseDuration(value); err == nil {
+		return time.Now().Add(-d), nil
+	}
+	return time.Time{}, fmt.Errorf("'%s' isn't a date, RFC 3339 time, or duration", value)
+}
@@ -0,0 +1,175 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/bradleyfalzon/ghinstallation/v2"
+	"github.com/google/go-github/v70/github"
+	"github.com/rs/zerolog/log"
+)
+
+// GitHub App flags
+var (
+	githubAppID             int64
+	githubAppPrivateKey     string
+	githubAppInstallationID int64
+)
+
+// appInstallationTransport authenticates each request as the GitHub App's installation on the owner of the
+// requested resource, so a single client can work across orgs. Installation tokens are minted on first use and
+// refreshed before they expire.
+type appInstallationTransport struct {
+	appsTransport *ghinstallation.AppsTransport
+	appsClient    *github.Client
+	// defaultOwner is used for requests that aren't for a specific owner, like rate limits
+	defaultOwner string
+
+	mu sync.Mutex
+	// installationIDs are known installations by lowercase owner, from config or looked up
+	installationIDs map[string]int64
+	transports      map[int64]*ghinstallation.Transport
+}
+
+// githubAppTransport builds a transport that authenticates as the configured GitHub App. With an installation ID,
+// every request uses that installation. Otherwise the installation is picked per owner.
+func githubAppTransport(base http.RoundTripper) (http.RoundTripper, error) {
+	privateKey, err := githubAppKey()
+	if err != nil {
+		return nil, err
+	}
+	appsTransport, err := ghinstallation.NewAppsTransport(base, githubAppID, privateKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create GitHub App transport for app %d: %w", githubAppID, err)
+	}
+	appsClient, err := withGitHubURLs(github.NewClient(&http.Client{Transport: appsTransport}))
+	if err != nil {
+		return nil, err
+	}
+	appsTransport.BaseURL = strings.TrimSuffix(appsClient.BaseURL.String(), "/")
+
+	if githubAppInstallationID != 0 {
+		log.Debug().
+			Int64("app_id", githubAppID).
+			Int64("installation_id", githubAppInstallationID).
+			Msg("Authenticating as GitHub App installation")
+		return ghinstallation.NewFromAppsTransport(appsTransport, githubAppInstallationID), nil
+	}
+
+	installationIDs := make(map[string]int64, len(cfg.GitHub.Installations))
+	for installationOwner, id := range cfg.GitHub.Installations {
+		installationIDs[strings.ToLower(installationOwner)] = id
+	}
+	log.Debug().
+		Int64("app_id", githubAppID).
+		Int("configured_installations", len(installationIDs)).
+		Msg("Authenticating as GitHub App, picking installations per owner")
+	return &appInstallationTransport{
+		appsTransport:   appsTransport,
+		appsClient:      appsClient,
+		defaultOwner:    owner,
+		installationIDs: installationIDs,
+		transports:      map[int64]*ghinstallation.Transport{},
+	}, nil
+}
+
+// RoundTrip authenticates the request with the token of the installation on the request's owner
+func (t *appInstallationTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	requestOwner := ownerFromPath(req.URL.Path)
+	if requestOwner == "" {
+		requestOwner = t.defaultOwner
+	}
+	if requestOwner == "" {
+		return nil, fmt.Errorf("unable to pick a GitHub App installation for '%s', provide an owner or installation ID", req.URL.Path)
+	}
+
+	transport, err := t.installation(req.Context(), requestOwner)
+	if err != nil {
+		return nil, err
+	}
+	return transport.RoundTrip(req)
+}
+
+// installation returns the transport for the app's installation on owner, looking the installation up if needed
+func (t *appInstallationTransport) installation(ctx context.Context, installationOwner string) (*ghinstallation.Transport, error) {
+	key := strings.ToLower(installationOwner)
+	t.mu.Lock()
+	id, ok := t.installationIDs[key]
+	t.mu.Unlock()
+	if !ok {
+		// Look up without holding the lock so requests for other owners aren't blocked on the API call
+		var err error
+		id, err = t.findInstallation(ctx, installationOwner)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if storedID, ok := t.installationIDs[key]; ok {
+		// Another request looked it up first
+		id = storedID
+	} else {
+		t.installationIDs[key] = id
+	}
+	transport, ok := t.transports[id]
+	if !ok {
+		transport = ghinstallation.NewFromAppsTransport(t.appsTransport, id)
+		t.transports[id] = transport
+	}
+	return transport, nil
+}
+
+// findInstallation looks up the app's installation on an org, falling back to a user account
+func (t *appInstallationTransport) findInstallation(ctx context.Context, installationOwner string) (int64, error) {
+	installation, _, err := t.appsClient.Apps.FindOrganizationInstallation(ctx, installationOwner)
+	if err != nil {
+		var ghErr *github.ErrorResponse
+		if !errors.As(err, &ghErr) || ghErr.Response == nil || ghErr.Response.StatusCode != http.StatusNotFound {
+			return 0, fmt.Errorf("failed to find GitHub App installation for '%s': %w", installationOwner, err)
+		}
+		installation, _, err = t.appsClient.Apps.FindUserInstallation(ctx, installationOwner)
+		if err != nil {
+			return 0, fmt.Errorf("GitHub App %d is not installed on '%s': %w", githubAppID, installationOwner, err)
+		}
+	}
+
+	log.Debug().
+		Str("owner", installationOwner).
+		Int64("installation_id", installation.GetID()).
+		Msg("Found GitHub App installation")
+	return installation.GetID(), nil
+}
+
+// githubAppKey reads the app's private key, which can be given as either PEM contents or a path to a PEM file
+func githubAppKey() ([]byte, error) {
+	if githubAppPrivateKey == "" {
+		return nil, fmt.Errorf("GitHub App %d requires a private key", githubAppID)
+	}
+	if strings.HasPrefix(strings.TrimSpace(githubAppPrivateKey), "-----BEGIN") {
+		return []byte(githubAppPrivateKey), nil
+	}
+	privateKey, err := os.ReadFile(githubAppPrivateKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read GitHub App private key '%s': %w", githubAppPrivateKey, err)
+	}
+	return privateKey, nil
+}
+
+// ownerFromPath finds the owner a GitHub API request is for, e.g. "kalverra" for /repos/kalverra/workflow-metrics
+func ownerFromPath(path string) string {
+	segments := strings.Split(strings.Trim(path, "/"), "/")
+	for i := 0; i < len(segments)-1; i++ {
+		switch segments[i] {
+		case "repos", "orgs", "users":
+			return segments[i+1]
+		}
+	}
+	return ""
+}
@@ -0,0 +1,114 @@
+package cmd
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/bradleyfalzon/ghinstallation/v2"
+	"github.com/google/go-github/v70/github"
+	"github.com/kalverra/workflow-metrics/fakegithub"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/sync/errgroup"
+)
+
+func TestMain(m *testing.M) {
+	zerolog.SetGlobalLevel(zerolog.Disabled)
+	os.Exit(m.Run())
+}
+
+// newTestAppInstallationTransport authenticates as a GitHub App against the fake server, picking installations per
+// owner
+func newTestAppInstallationTransport(t *testing.T, server *fakegithub.Server) *appInstallationTransport {
+	t.Helper()
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err, "failed to generate app private key")
+	privateKey := pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)})
+	appsTransport, err := ghinstallation.NewAppsTransport(http.DefaultTransport, 1, privateKey)
+	require.NoError(t, err, "failed to create apps transport")
+	appsClient, err := github.NewClient(&http.Client{Transport: appsTransport}).WithEnterpriseURLs(server.URL, server.URL)
+	require.NoError(t, err, "failed to create apps client")
+	appsTransport.BaseURL = strings.TrimSuffix(appsClient.BaseURL.String(), "/")
+
+	return &appInstallationTransport{
+		appsTransport:   appsTransport,
+		appsClient:      appsClient,
+		installationIDs: map[string]int64{},
+		transports:      map[int64]*ghinstallation.Transport{},
+	}
+}
+
+func TestAppInstallationTransport(t *testing.T) {
+	t.Parallel()
+
+	server := fakegithub.New()
+	t.Cleanup(server.Close)
+	// One owner is an org and the other a user account, which is looked up after the org lookup isn't found
+	owners := map[string]int64{"smartcontractkit": 1, "kalverra": 2}
+	server.AddInstallation("smartcontractkit", owners["smartcontractkit"], true)
+	server.AddInstallation("kalverra", owners["kalverra"], false)
+	for installationOwner := range owners {
+		server.AddRuns(installationOwner, "workflow-metrics", fakegithub.Run(1))
+	}
+
+	transport := newTestAppInstallationTransport(t, server)
+	client, err := github.NewClient(&http.Client{Transport: transport}).WithEnterpriseURLs(server.URL, server.URL)
+	require.NoError(t, err, "failed to create client")
+
+	// Every owner is first used by many requests at once
+	eg := errgroup.Group{}
+	for i := range 20 {
+		requestOwner := "smartcontractkit"
+		if i%2 == 1 {
+			requestOwner = "kalverra"
+		}
+		eg.Go(func() error {
+			_, _, err := client.Actions.GetWorkflowRunByID(context.Background(), requestOwner, "workflow-metrics", 1)
+			return err
+		})
+	}
+	require.NoError(t, eg.Wait(), "requests should authenticate as the installation on their owner")
+	for installationOwner, id := range owners {
+		assert.Equal(t, 1, countRequests(server, fmt.Sprintf("POST /app/installations/%d/access_tokens", id)),
+			"a single token should be minted for %s's installation", installationOwner)
+	}
+
+	// Installations and their tokens are cached
+	lookups := countRequests(server, "GET /orgs/smartcontractkit/installation") + countRequests(server, "GET /users/kalverra/installation")
+	for _, requestOwner := range []string{"smartcontractkit", "kalverra"} {
+		_, _, err := client.Actions.GetWorkflowRunByID(context.Background(), requestOwner, "workflow-metrics", 1)
+		require.NoError(t, err, "failed to call the API as %s's installation", requestOwner)
+	}
+	assert.Equal(t, lookups,
+		countRequests(server, "GET /orgs/smartcontractkit/installation")+countRequests(server, "GET /users/kalverra/installation"),
+		"installations should only be looked up on first use")
+	assert.Zero(t, countRequests(server, "GET /users/smartcontractkit/installation"), "org installation shouldn't be looked up as a user")
+	for _, id := range owners {
+		assert.Equal(t, 1, countRequests(server, fmt.Sprintf("POST /app/installations/%d/access_tokens", id)),
+			"tokens should be reused until they expire")
+	}
+
+	_, _, err = client.Actions.GetWorkflowRunByID(context.Background(), "not-installed", "workflow-metrics", 1)
+	require.ErrorContains(t, err, "is not installed on 'not-installed'", "expected an error for an owner without an installation")
+}
+
+// countRequests counts the requests the fake server got for a method and path
+func countRequests(server *fakegithub.Server, request string) int {
+	count := 0
+	for _, made := range server.Requests() {
+		if made == request {
+			count++
+		}
+	}
+	return count
+}
@@ -0,0 +1,54 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/kalverra/workflow-metrics/gather"
+	"github.com/rs/zerolog/log"
+	"github.com/spf13/cobra"
+)
+
+var migrateDryRun bool
+
+var migrateCmd = &cobra.Command{
+	Use:         "migrate",
+	Short:       "Rewrite stored data in the current schema version",
+	Long:        "Rewrite stored data in the current schema version. Migrates the repos in the config file, or every repo in the store, unless an owner and repo are provided.",
+	Annotations: map[string]string{annotationOffline: "", annotationAnyRepo: ""},
+	RunE: func(cmd *cobra.Command, args []string) error {
+		log.Debug().
+			Bool("dry-run", migrateDryRun).
+			Int("schema_version", gather.SchemaVersion).
+			Msg("migrate flags")
+
+		repos, err := configuredRepos()
+		if err != nil {
+			return err
+		}
+
+		var (
+			total int
+			errs  error
+		)
+		for _, r := range repos {
+			migrated, err := gather.Migrate(r.Owner, r.Repo, migrateDryRun)
+			total += migrated
+			if err != nil {
+				errs = errors.Join(errs, fmt.Errorf("failed to migrate %s/%s: %w", r.Owner, r.Repo, err))
+			}
+		}
+		log.Info().
+			Int("repo_count", len(repos)).
+			Int("migrated", total).
+			Bool("dry_run", migrateDryRun).
+			Msg("Migration complete")
+		return errs
+	},
+}
+
+func init() {
+	migrateCmd.Flags().BoolVar(&migrateDryRun, "dry-run", false, "Report what would be migrated without rewriting anything")
+
+	rootCmd.AddCommand(migrateCmd)
+}
@@ -0,0 +1,42 @@
+package cmd
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/kalverra/workflow-metrics/monitor"
+	"github.com/rs/zerolog/log"
+	"github.com/spf13/cobra"
+)
+
+var (
+	monitorInterval time.Duration
+	monitorFile     string
+)
+
+var monitorCmd = &cobra.Command{
+	Use:   "monitor",
+	Short: "Sample the runner's process resource usage until interrupted",
+	Long: fmt.Sprintf(`Sample the CPU and memory usage of every process on the runner until interrupted, then write the samples to
+a file. Run it in the background of a job, stop it with SIGINT or SIGTERM, and upload the file in an artifact named
+'%s' for gather to attach the samples to the workflow run when run with --monitor-artifacts.`, monitor.ArtifactName),
+	Annotations: map[string]string{annotationOffline: "", annotationAnyRepo: ""},
+	RunE: func(cmd *cobra.Command, args []string) error {
+		log.Debug().
+			Str("interval", monitorInterval.String()).
+			Str("monitor-file", monitorFile).
+			Msg("monitor flags")
+
+		if monitorInterval <= 0 {
+			return fmt.Errorf("interval must be positive")
+		}
+		return monitor.Monitor(monitorInterval, monitorFile)
+	},
+}
+
+func init() {
+	monitorCmd.Flags().DurationVar(&monitorInterval, "interval", 5*time.Second, "How often to sample resource usage")
+	monitorCmd.Flags().StringVar(&monitorFile, "monitor-file", monitor.FileName, "File to write the samples to")
+
+	rootCmd.AddCommand(monitorCmd)
+}
@@ -0,0 +1,112 @@
+package cmd
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/kalverra/workflow-metrics/observe"
+	"github.com/rs/zerolog/log"
+	"github.com/spf13/cobra"
+)
+
+var (
+	notifyKind       string
+	notifyWebhookURL string
+	notifyTemplate   string
+	notifyReportURL  string
+	digestWorkflow   string
+	digestBranch     string
+	digestSince      string
+	digestUntil      string
+)
+
+var notifyCmd = &cobra.Command{
+	Use:   "notify",
+	Short: "Post summaries of workflow runs to Slack or Teams incoming webhooks",
+	Long: `Post summaries of workflow runs to Slack or Teams incoming webhooks. Messages are text/template files, which
+can use the link and bold functions to format for the kind of webhook, and the escape function for any other field.`,
+}
+
+var notifyRunCmd = &cobra.Command{
+	Use:   "run",
+	Short: "Post a workflow run's duration, cost, and failed jobs",
+	PreRunE: func(cmd *cobra.Command, args []string) error {
+		if workflowRunID == 0 {
+			return fmt.Errorf("workflow run ID must be provided")
+		}
+		return nil
+	},
+	RunE: func(cmd *cobra.Command, args []string) error {
+		log.Debug().
+			Str("kind", notifyKind).
+			Str("template", notifyTemplate).
+			Str("report-url", notifyReportURL).
+			Msg("notify run flags")
+
+		n, err := notifier()
+		if err != nil {
+			return err
+		}
+		return observe.NotifyWorkflowRun(githubClient, n, owner, repo, workflowRunID)
+	},
+}
+
+var notifyDigestCmd = &cobra.Command{
+	Use:         "digest",
+	Short:       "Post a digest of gathered runs' success rate, duration, cost, and failures, e.g. a daily CI health summary",
+	Annotations: map[string]string{annotationOffline: ""},
+	RunE: func(cmd *cobra.Command, args []string) error {
+		log.Debug().
+			Str("kind", notifyKind).
+			Str("template", notifyTemplate).
+			Str("report-url", notifyReportURL).
+			Str("workflow", digestWorkflow).
+			Str("branch", digestBranch).
+			Str("since", digestSince).
+			Str("until", digestUntil).
+			Msg("notify digest flags")
+
+		n, err := notifier()
+		if err != nil {
+			return err
+		}
+		since, until, err := backfillRange(digestSince, digestUntil)
+		if err != nil {
+			return err
+		}
+		return observe.NotifyDigest(n, owner, repo, digestWorkflow, digestBranch, since, until)
+	},
+}
+
+// notifier builds the notifier from the notify flags
+func notifier() (observe.Notifier, error) {
+	if notifyWebhookURL == "" {
+		return observe.Notifier{}, fmt.Errorf("webhook URL must be provided")
+	}
+	if !slices.Contains(observe.NotifyKinds, notifyKind) {
+		return observe.Notifier{}, fmt.Errorf("unknown webhook kind '%s', must be one of %s", notifyKind, strings.Join(observe.NotifyKinds, ", "))
+	}
+	return observe.Notifier{
+		Kind:       notifyKind,
+		WebhookURL: notifyWebhookURL,
+		Template:   notifyTemplate,
+		ReportURL:  notifyReportURL,
+	}, nil
+}
+
+func init() {
+	notifyCmd.PersistentFlags().StringVar(&notifyKind, "kind", observe.NotifySlack, fmt.Sprintf("Kind of incoming webhook (%s)", strings.Join(observe.NotifyKinds, ", ")))
+	notifyCmd.PersistentFlags().StringVar(&notifyWebhookURL, "webhook-url", "", "Incoming webhook to post to")
+	notifyCmd.PersistentFlags().StringVar(&notifyTemplate, "template", "", "text/template file for the message, instead of the default")
+	notifyCmd.PersistentFlags().StringVar(&notifyReportURL, "report-url", "", "URL of the published HTML report to link to")
+
+	notifyDigestCmd.Flags().StringVar(&digestWorkflow, "workflow", "", "Only include runs of this workflow name, path, or file name")
+	notifyDigestCmd.Flags().StringVar(&digestBranch, "branch", "", "Only include runs on this branch")
+	notifyDigestCmd.Flags().StringVar(&digestSince, "since", (24 * time.Hour).String(), "Include runs created since this date, RFC 3339 time, or duration ago")
+	notifyDigestCmd.Flags().StringVar(&digestUntil, "until", "", "Include runs created before this date, RFC 3339 time, or duration ago, defaults to now")
+
+	notifyCmd.AddCommand(notifyRunCmd, notifyDigestCmd)
+	rootCmd.AddCommand(notifyCmd)
+}
@@ -2,7 +2,9 @@ package cmd
 
 import (
 	"fmt"
+	"slices"
 
+	"github.com/kalverra/workflow-metrics/gather"
 	"github.com/kalverra/workflow-metrics/observe"
 	"github.com/rs/zerolog/log"
 	"github.com/spf13/cobra"
@@ -13,19 +15,24 @@ var (
 )
 
 var observeCmd = &cobra.Command{
-	Use:   "observe",
-	Short: "Observe metrics from GitHub",
+	Use:     "observe",
+	Short:   "Observe metrics from GitHub",
+	PreRunE: requireRunOrPullRequest,
 	RunE: func(cmd *cobra.Command, args []string) error {
 		log.Debug().
 			Strs("output-types", outputTypes).
 			Msg("observe flags")
 
 		if workflowRunID != 0 {
+			// Step summaries are written by a job in the same workflow run, so it's still in progress
+			if slices.Contains(outputTypes, "step-summary") {
+				gather.SetPartial(true)
+			}
 			return observe.WorkflowRun(githubClient, owner, repo, workflowRunID, outputTypes)
 		}
 
 		if pullRequestID != "" {
-			fmt.Errorf("pull request gathering not implemented yet")
+			return fmt.Errorf("pull request gathering not implemented yet")
 		}
 		return nil
 	},
@@ -34,5 +41,5 @@ var observeCmd = &cobra.Command{
 func init() {
 	rootCmd.AddCommand(observeCmd)
 
-	observeCmd.Flags().StringArrayVar(&outputTypes, "output-types", []string{"html", "md"}, "Output types to generate")
+	observeCmd.Flags().StringArrayVar(&outputTypes, "output-types", []string{"html", "md"}, "Output types to generate (html, md, csv, step-summary). step-summary snapshots the workflow run if it's still in progress, to run as its last job")
 }
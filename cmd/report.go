@@ -0,0 +1,132 @@
+package cmd
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/kalverra/workflow-metrics/observe"
+	"github.com/rs/zerolog/log"
+	"github.com/spf13/cobra"
+)
+
+var (
+	reportWorkflow    string
+	reportBranch      string
+	reportOutputTypes []string
+	reportSince       string
+	reportUntil       string
+	costGroupBy       []string
+)
+
+var reportCmd = &cobra.Command{
+	Use:   "report",
+	Short: "Build reports over many gathered workflow runs",
+}
+
+var trendCmd = &cobra.Command{
+	Use:         "trend",
+	Short:       "Report how a workflow's durations, cost, success rate, and queue times change over time",
+	Annotations: map[string]string{annotationOffline: ""},
+	RunE: func(cmd *cobra.Command, args []string) error {
+		log.Debug().
+			Str("workflow", reportWorkflow).
+			Str("branch", reportBranch).
+			Strs("output-types", reportOutputTypes).
+			Msg("report trend flags")
+
+		// Not marked as required, as it can also come from the config file
+		if reportWorkflow == "" {
+			return fmt.Errorf("workflow must be provided")
+		}
+		return observe.WorkflowTrend(owner, repo, reportWorkflow, reportBranch, reportOutputTypes)
+	},
+}
+
+var flakyCmd = &cobra.Command{
+	Use:         "flaky",
+	Short:       "Report jobs and steps that both fail and succeed on the same commit",
+	Annotations: map[string]string{annotationOffline: ""},
+	RunE: func(cmd *cobra.Command, args []string) error {
+		log.Debug().
+			Str("workflow", reportWorkflow).
+			Str("branch", reportBranch).
+			Strs("output-types", reportOutputTypes).
+			Msg("report flaky flags")
+
+		return observe.Flaky(owner, repo, reportWorkflow, reportBranch, reportOutputTypes)
+	},
+}
+
+var jobsCmd = &cobra.Command{
+	Use:         "jobs",
+	Short:       "Write a CSV with the duration, billable minutes, and cost of every job in gathered runs",
+	Annotations: map[string]string{annotationOffline: ""},
+	RunE: func(cmd *cobra.Command, args []string) error {
+		log.Debug().
+			Str("workflow", reportWorkflow).
+			Str("branch", reportBranch).
+			Msg("report jobs flags")
+
+		return observe.JobsCSV(owner, repo, reportWorkflow, reportBranch)
+	},
+}
+
+var costCmd = &cobra.Command{
+	Use:   "cost",
+	Short: "Roll up the cost of gathered runs by workflow, job, branch, event, actor, and runner SKU",
+	Long: `Roll up the cost of gathered runs by workflow file, job, branch, event, triggering actor, and runner SKU,
+with totals and each group's share of the cost. Output types are html, md, and csv.`,
+	Annotations: map[string]string{annotationOffline: ""},
+	RunE: func(cmd *cobra.Command, args []string) error {
+		log.Debug().
+			Str("workflow", reportWorkflow).
+			Str("branch", reportBranch).
+			Str("since", reportSince).
+			Str("until", reportUntil).
+			Strs("group-by", costGroupBy).
+			Strs("output-types", reportOutputTypes).
+			Msg("report cost flags")
+
+		filter := observe.CostFilter{Workflow: reportWorkflow, Branch: reportBranch}
+		if reportSince != "" {
+			since, err := parseTimeFlag(reportSince)
+			if err != nil {
+				return fmt.Errorf("invalid --since: %w", err)
+			}
+			filter.Since = since
+		}
+		if reportUntil != "" {
+			until, err := parseTimeFlag(reportUntil)
+			if err != nil {
+				return fmt.Errorf("invalid --until: %w", err)
+			}
+			filter.Until = until
+		}
+		return observe.Cost(owner, repo, filter, costGroupBy, reportOutputTypes)
+	},
+}
+
+func init() {
+	reportCmd.PersistentFlags().StringArrayVar(&reportOutputTypes, "output-types", []string{"html", "md"}, "Output types to generate (html, md, json or csv where supported)")
+
+	trendCmd.Flags().StringVar(&reportWorkflow, "workflow", "", "Workflow name, path, or file name to report on")
+	trendCmd.Flags().StringVar(&reportBranch, "branch", "", "Only include runs on this branch")
+
+	flakyCmd.Flags().StringVar(&reportWorkflow, "workflow", "", "Only include runs of this workflow name, path, or file name")
+	flakyCmd.Flags().StringVar(&reportBranch, "branch", "", "Only include runs on this branch")
+
+	jobsCmd.Flags().StringVar(&reportWorkflow, "workflow", "", "Only include runs of this workflow name, path, or file name")
+	jobsCmd.Flags().StringVar(&reportBranch, "branch", "", "Only include runs on this branch")
+
+	reportCmd.AddCommand(trendCmd)
+	reportCmd.AddCommand(flakyCmd)
+	costCmd.Flags().StringVar(&reportWorkflow, "workflow", "", "Only include runs of this workflow name, path, or file name")
+	costCmd.Flags().StringVar(&reportBranch, "branch", "", "Only include runs on this branch")
+	costCmd.Flags().StringVar(&reportSince, "since", "", "Only include runs created since a date (2006-01-02), time (RFC 3339), or duration ago (e.g. 720h)")
+	costCmd.Flags().StringVar(&reportUntil, "until", "", "Only include runs created before a date, time, or duration ago")
+	costCmd.Flags().StringSliceVar(&costGroupBy, "group-by", observe.CostGroupings, fmt.Sprintf("Dimensions to roll up cost by (%s)", strings.Join(observe.CostGroupings, ", ")))
+
+	reportCmd.AddCommand(jobsCmd)
+	reportCmd.AddCommand(costCmd)
+	rootCmd.AddCommand(reportCmd)
+}
@@ -0,0 +1,98 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+
+	"github.com/kalverra/workflow-metrics/dataset"
+	"github.com/kalverra/workflow-metrics/gather"
+	"github.com/kalverra/workflow-metrics/webhook"
+	"github.com/rs/zerolog/log"
+	"github.com/spf13/cobra"
+)
+
+var (
+	webhookAddr      string
+	webhookSecret    string
+	webhookWorkers   int
+	webhookQueueSize int
+)
+
+var serveWebhooksCmd = &cobra.Command{
+	Use:   "serve-webhooks",
+	Short: "Serve GitHub webhooks, gathering workflow runs as they complete",
+	Long: `Serve GitHub webhooks on /webhook, gathering workflow runs as they complete.
+
+Configure a repo or org webhook with the workflow_run and workflow_job events. Every workflow_job status change is
+recorded when it's received, for precise queue times and runner assignments. Completed workflow_run events gather the
+final data of the workflow run, replacing any partial snapshot.`,
+	Annotations: map[string]string{annotationAnyRepo: ""},
+	RunE: func(cmd *cobra.Command, args []string) error {
+		log.Debug().
+			Str("addr", webhookAddr).
+			Int("workers", webhookWorkers).
+			Int("queue-size", webhookQueueSize).
+			Msg("serve-webhooks flags")
+
+		var (
+			ds     *dataset.Dataset
+			dsLock sync.Mutex
+		)
+		if datasetPath != "" {
+			var err error
+			ds, err = openDataset()
+			if err != nil {
+				return err
+			}
+		}
+
+		server, err := webhook.NewServer(webhook.Config{
+			Addr:      webhookAddr,
+			Secret:    []byte(webhookSecret),
+			Workers:   webhookWorkers,
+			QueueSize: webhookQueueSize,
+		}, func(owner, repo string, workflowRunID int64) error {
+			// Forced, as a partial snapshot or data from before a re-run may already be stored
+			workflowRun, err := gather.WorkflowRun(githubClient, owner, repo, workflowRunID, true)
+			if err != nil {
+				return err
+			}
+			if workflowRun == nil {
+				return fmt.Errorf("no data gathered for workflow run '%d'", workflowRunID)
+			}
+			if ds == nil {
+				return nil
+			}
+			dsLock.Lock()
+			defer dsLock.Unlock()
+			return ds.Ingest(owner, repo, workflowRun)
+		}, gather.RecordJobEvent)
+		if err != nil {
+			return err
+		}
+
+		ctx, stop := signal.NotifyContext(cmd.Context(), os.Interrupt, syscall.SIGTERM)
+		defer stop()
+		err = server.Run(ctx)
+		if ds != nil {
+			err = errors.Join(err, ds.Close())
+		}
+		if err != nil {
+			return fmt.Errorf("webhook server failed: %w", err)
+		}
+		return nil
+	},
+}
+
+func init() {
+	serveWebhooksCmd.Flags().StringVar(&webhookAddr, "addr", ":8080", "Address to serve webhooks on")
+	serveWebhooksCmd.Flags().StringVar(&webhookSecret, "webhook-secret", "", fmt.Sprintf("Secret to validate webhook payloads with (can also be set via %sWEBHOOK_SECRET)", envVarPrefix))
+	serveWebhooksCmd.Flags().IntVar(&webhookWorkers, "workers", 4, "Number of workflow runs to gather at once")
+	serveWebhooksCmd.Flags().IntVar(&webhookQueueSize, "queue-size", 100, "Number of workflow runs that can wait to be gathered before webhooks are rejected")
+
+	rootCmd.AddCommand(serveWebhooksCmd)
+}
@@ -4,11 +4,21 @@ import (
 	"context"
 	"fmt"
 	"io"
+	"net/http"
+	"net/url"
 	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/gofri/go-github-ratelimit/github_ratelimit"
 	"github.com/google/go-github/v70/github"
+	"github.com/kalverra/workflow-metrics/dataset"
+	"github.com/kalverra/workflow-metrics/gather"
+	"github.com/kalverra/workflow-metrics/observe"
+	"github.com/kalverra/workflow-metrics/store"
+	ghtransport "github.com/kalverra/workflow-metrics/transport"
 	"github.com/rs/zerolog"
 	"github.com/rs/zerolog/log"
 	"github.com/spf13/cobra"
@@ -17,6 +27,20 @@ import (
 
 const logTimeFormat = "2006-01-02T15:04:05.000"
 
+// Command annotations that relax what the root command sets up before running a subcommand
+const (
+	// annotationOffline marks commands that never call the GitHub API
+	annotationOffline = "offline"
+	// annotationAnyRepo marks commands that don't need an owner and repo
+	annotationAnyRepo = "any-repo"
+)
+
+const (
+	defaultDatasetName = "workflow-metrics.db"
+	// httpCacheDirName is the dir in the data dir that GitHub API responses are cached in
+	httpCacheDirName = ".http_cache"
+)
+
 // These variables are set at build time and describe the version and build of the application
 var (
 	version   = "dev"
@@ -34,8 +58,25 @@ var (
 	repo              string
 	workflowRunID     int64
 	pullRequestID     string
+	dataDir           string
+	outputDir         string
+	storeURI          string
+	datasetPath       string
+	storageFormat     string
+	githubURL         string
+	githubUploadURL   string
+	maxAPICalls       int
+	reserveRateLimit  int
+	httpCache         bool
+	githubTimeout     time.Duration
+	githubRetries     int
+	recordDir         string
+	replayDir         string
+	monitorArtifacts  bool
 
 	githubClient *github.Client
+	apiBudget    *ghtransport.Budget
+	dataStore    store.Store
 )
 
 var rootCmd = &cobra.Command{
@@ -43,21 +84,42 @@ var rootCmd = &cobra.Command{
 	Short: "", // TODO: Fill out
 	Long:  ``, // TODO: Fill out
 	PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
-		if workflowRunID == 0 && pullRequestID == "" {
-			return fmt.Errorf("either workflow run ID or pull request ID must be provided")
-		}
-		if workflowRunID != 0 && pullRequestID != "" {
-			return fmt.Errorf("only one of workflow run ID or pull request ID must be provided")
+		err := loadConfig(cmd)
+		if err != nil {
+			return fmt.Errorf("failed to load config: %w", err)
 		}
-
-		err := setupLogging()
+		err = setupLogging()
 		if err != nil {
 			return fmt.Errorf("failed to setup logging: %w", err)
 		}
-		githubClient, err = getGitHubClient()
+		if _, anyRepo := cmd.Annotations[annotationAnyRepo]; !anyRepo && (owner == "" || repo == "") {
+			return fmt.Errorf("both owner and repo must be provided")
+		}
+		if githubTimeout <= 0 {
+			return fmt.Errorf("github-timeout must be positive")
+		}
+		if githubRetries < 0 {
+			return fmt.Errorf("github-retries can't be negative")
+		}
+		if _, offline := cmd.Annotations[annotationOffline]; !offline {
+			githubClient, err = getGitHubClient()
+			if err != nil {
+				return fmt.Errorf("failed to create GitHub client: %w", err)
+			}
+		}
+		dataStore, err = store.Open(storeURI, dataDir, outputDir)
+		if err != nil {
+			return fmt.Errorf("failed to open data store: %w", err)
+		}
+		gather.SetStore(dataStore)
+		gather.SetTimeout(githubTimeout)
+		gather.SetRetries(githubRetries)
+		gather.SetMonitorArtifacts(monitorArtifacts)
+		err = gather.SetStorageFormat(storageFormat)
 		if err != nil {
-			return fmt.Errorf("failed to create GitHub client: %w", err)
+			return err
 		}
+		observe.SetStore(dataStore)
 
 		log.Debug().
 			Str("version", version).
@@ -73,9 +135,24 @@ var rootCmd = &cobra.Command{
 			Str("log_file", logFileName).
 			Str("log_level", logLevelInput).
 			Bool("disable_console_log", disableConsoleLog).
+			Str("data_dir", dataDir).
+			Str("output_dir", outputDir).
+			Str("store", storeURI).
+			Str("storage_format", storageFormat).
+			Str("config", configFile).
+			Str("github_timeout", githubTimeout.String()).
+			Int("github_retries", githubRetries).
+			Bool("monitor_artifacts", monitorArtifacts).
 			Msg("workflow-metrics flags")
 		return nil
 	},
+	PersistentPostRunE: func(cmd *cobra.Command, args []string) error {
+		logAPICalls()
+		if dataStore == nil {
+			return nil
+		}
+		return dataStore.Close()
+	},
 	Run: func(cmd *cobra.Command, args []string) {
 		err := cmd.Help()
 		if err != nil {
@@ -85,6 +162,7 @@ var rootCmd = &cobra.Command{
 }
 
 func init() {
+	rootCmd.PersistentFlags().StringVar(&configFile, "config", "", fmt.Sprintf("Config file (default %s in the working or home directory). Flags can also be set via %s<FLAG_NAME> environment variables", defaultConfigFileName, envVarPrefix))
 	rootCmd.PersistentFlags().StringVarP(&logFileName, "log-file", "f", "workflow-metrics.log.json", "Log file name")
 	rootCmd.PersistentFlags().StringVarP(&logLevelInput, "log-level", "l", "info", "Log level")
 	rootCmd.PersistentFlags().BoolVarP(&disableConsoleLog, "silent", "s", false, "Disables console logs. Still logs to file")
@@ -93,16 +171,25 @@ func init() {
 	rootCmd.PersistentFlags().StringVarP(&repo, "repo", "r", "", "Repository name")
 	rootCmd.PersistentFlags().Int64VarP(&workflowRunID, "workflow-run-id", "w", 0, "Workflow run ID")
 	rootCmd.PersistentFlags().StringVarP(&pullRequestID, "pull-request-id", "p", "", "Pull request ID")
+	rootCmd.PersistentFlags().StringVar(&dataDir, "data-dir", "data", "Directory to store gathered data in")
+	rootCmd.PersistentFlags().StringVar(&outputDir, "output-dir", "observe_output", "Directory to write observations to")
+	rootCmd.PersistentFlags().StringVar(&storeURI, "store", "", "Where to store data instead of the local data dir, e.g. sqlite://metrics.db or s3://bucket/prefix?endpoint=localhost:9000")
+	rootCmd.PersistentFlags().StringVar(&storageFormat, "storage-format", gather.StorageFormatJSON, fmt.Sprintf("Format to write gathered data in, %s or %s (trimmed and zstd compressed). Both formats are always readable", gather.StorageFormatJSON, gather.StorageFormatCompact))
+	rootCmd.PersistentFlags().StringVar(&datasetPath, "dataset", "", "SQLite dataset to also write gathered data to, and to ingest and query (default <data-dir>/workflow-metrics.db for ingest and query)")
 	rootCmd.PersistentFlags().StringVarP(&githubToken, "github-token", "t", "", fmt.Sprintf("GitHub API token (can also be set via %s)", githubTokenEnvVar))
-
-	err := rootCmd.MarkPersistentFlagRequired("owner")
-	if err != nil {
-		log.Fatal().Err(err).Msg("Failed to mark flag as required")
-	}
-	err = rootCmd.MarkPersistentFlagRequired("repo")
-	if err != nil {
-		log.Fatal().Err(err).Msg("Failed to mark flag as required")
-	}
+	rootCmd.PersistentFlags().StringVar(&githubURL, "github-url", "", "GitHub Enterprise Server URL, e.g. https://github.example.com (default api.github.com)")
+	rootCmd.PersistentFlags().StringVar(&githubUploadURL, "github-upload-url", "", "GitHub Enterprise Server upload URL (default --github-url)")
+	rootCmd.PersistentFlags().IntVar(&maxAPICalls, "max-api-calls", 0, "Stop calling the GitHub API after this many calls (default unlimited)")
+	rootCmd.PersistentFlags().IntVar(&reserveRateLimit, "reserve-rate-limit", 0, "Stop calling the GitHub API when this much of the rate limit is left, for other automation sharing the token")
+	rootCmd.PersistentFlags().DurationVar(&githubTimeout, "github-timeout", 10*time.Second, "How long a single GitHub API call can take before it's cancelled")
+	rootCmd.PersistentFlags().IntVar(&githubRetries, "github-retries", 3, "How many times to retry GitHub API calls that fail with server errors, rate limits, or timeouts")
+	rootCmd.PersistentFlags().StringVar(&recordDir, "record", "", "Record every GitHub API response to this dir, to replay them later with --replay")
+	rootCmd.PersistentFlags().StringVar(&replayDir, "replay", "", "Replay GitHub API responses recorded with --record from this dir, without any network calls or credentials")
+	rootCmd.PersistentFlags().BoolVar(&monitorArtifacts, "monitor-artifacts", false, "Attach the resource usage samples of the monitor command from workflow runs' artifacts, which costs an API call per workflow run")
+	rootCmd.PersistentFlags().BoolVar(&httpCache, "http-cache", false, "Cache GitHub API responses in the data dir and make conditional requests, which don't count against the rate limit. The cache isn't evicted, so clear it when it grows too large")
+	rootCmd.PersistentFlags().Int64Var(&githubAppID, "github-app-id", 0, "GitHub App ID to authenticate as instead of a token")
+	rootCmd.PersistentFlags().StringVar(&githubAppPrivateKey, "github-app-private-key", "", "GitHub App private key, as a path to a PEM file or the PEM contents")
+	rootCmd.PersistentFlags().Int64Var(&githubAppInstallationID, "github-app-installation-id", 0, "GitHub App installation ID to use for every request (default looks up the installation for each owner)")
 }
 
 func Execute() {
@@ -112,26 +199,112 @@ func Execute() {
 	}
 }
 
+// requireRunOrPullRequest validates that exactly one of workflow run ID or pull request ID was provided
+func requireRunOrPullRequest(cmd *cobra.Command, args []string) error {
+	if workflowRunID == 0 && pullRequestID == "" {
+		return fmt.Errorf("either workflow run ID or pull request ID must be provided")
+	}
+	if workflowRunID != 0 && pullRequestID != "" {
+		return fmt.Errorf("only one of workflow run ID or pull request ID must be provided")
+	}
+	return nil
+}
+
+// openDataset opens the SQLite dataset, defaulting to one in the data dir
+func openDataset() (*dataset.Dataset, error) {
+	path := datasetPath
+	if path == "" {
+		path = filepath.Join(dataDir, defaultDatasetName)
+	}
+	log.Debug().Str("dataset", path).Msg("Opening dataset")
+	return dataset.Open(path)
+}
+
+// pullRequestNumber parses the pull request ID flag into a pull request number
+func pullRequestNumber() (int, error) {
+	number, err := strconv.Atoi(strings.TrimPrefix(pullRequestID, "#"))
+	if err != nil || number <= 0 {
+		return 0, fmt.Errorf("invalid pull request ID '%s', must be a pull request number", pullRequestID)
+	}
+	return number, nil
+}
+
 func getGitHubClient() (*github.Client, error) {
-	if githubToken != "" {
-		log.Debug().Msg("Using GitHub token from flag")
-	} else if os.Getenv(githubTokenEnvVar) != "" {
-		githubToken = os.Getenv(githubTokenEnvVar)
-		log.Debug().Msg("Using GitHub token from environment variable")
+	base, err := recordingTransport()
+	if err != nil {
+		return nil, err
+	}
+	apiHost, err := githubAPIHost()
+	if err != nil {
+		return nil, err
+	}
+	// Artifacts are downloaded with the same client, from blob storage that mustn't be sent credentials
+	base = ghtransport.NewAPIHostOnlyAuth(base, apiHost)
+
+	var transport http.RoundTripper
+	if replayDir != "" {
+		log.Debug().Msg("Replaying GitHub API responses, no credentials needed")
+	} else if githubAppID != 0 {
+		transport, err = githubAppTransport(base)
+		if err != nil {
+			return nil, err
+		}
 	} else {
-		log.Warn().Msg("GitHub token not provided, will likely hit rate limits quickly")
+		configToken, err := configGitHubToken()
+		if err != nil {
+			return nil, err
+		}
+		if githubToken != "" {
+			log.Debug().Msg("Using GitHub token from flag")
+		} else if configToken != "" {
+			githubToken = configToken
+			log.Debug().Msg("Using GitHub token from config file source")
+		} else if os.Getenv(githubTokenEnvVar) != "" {
+			githubToken = os.Getenv(githubTokenEnvVar)
+			log.Debug().Msg("Using GitHub token from environment variable")
+		} else {
+			log.Warn().Msg("GitHub token not provided, will likely hit rate limits quickly")
+		}
+	}
+
+	if transport == nil {
+		transport = base
+	}
+	apiBudget = ghtransport.NewBudget(transport, maxAPICalls, reserveRateLimit)
+	transport = apiBudget
+	// Conditional requests would record and replay not modified responses, rather than the data
+	if httpCache && recordDir == "" && replayDir == "" {
+		cacheDir := filepath.Join(dataDir, httpCacheDirName)
+		cache, err := ghtransport.NewCache(transport, cacheDir)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create HTTP cache: %w", err)
+		}
+		transport = cache
+		log.Debug().Str("dir", cacheDir).Msg("Caching GitHub API responses")
 	}
 
-	rateLimiter, err := github_ratelimit.NewRateLimitWaiterClient(nil)
+	rateLimiter, err := github_ratelimit.NewRateLimitWaiterClient(transport)
 	if err != nil {
 		log.Fatal().Err(err).Msg("Failed to create rate limiter")
 	}
-	client := github.NewClient(rateLimiter)
-	if githubToken != "" {
+	client, err := withGitHubURLs(github.NewClient(rateLimiter))
+	if err != nil {
+		return nil, err
+	}
+	if githubToken != "" && githubAppID == 0 && replayDir == "" {
 		client = client.WithAuthToken(githubToken)
 	}
-	limits, _, err := client.RateLimit.Get(context.Background())
+	// Without an owner, there's no GitHub App installation to check the rate limit of
+	if replayDir != "" || githubAppID != 0 && githubAppInstallationID == 0 && owner == "" {
+		return client, nil
+	}
+	limits, resp, err := client.RateLimit.Get(context.Background())
 	if err != nil {
+		// GitHub Enterprise Server responds with not found when rate limiting is disabled
+		if githubURL != "" && resp != nil && resp.StatusCode == http.StatusNotFound {
+			log.Debug().Str("github_url", githubURL).Msg("Rate limiting is disabled on GitHub Enterprise Server")
+			return client, nil
+		}
 		return nil, err
 	}
 	rateLimit := limits.GetCore().Limit
@@ -146,6 +319,84 @@ func getGitHubClient() (*github.Client, error) {
 	return client, nil
 }
 
+// recordingTransport is the transport that reaches GitHub, which records or replays responses with --record or --replay
+func recordingTransport() (http.RoundTripper, error) {
+	switch {
+	case recordDir != "" && replayDir != "":
+		return nil, fmt.Errorf("only one of --record or --replay can be used")
+	case recordDir != "":
+		log.Info().Str("dir", recordDir).Msg("Recording GitHub API responses")
+		recorder, err := ghtransport.NewRecorder(http.DefaultTransport, recordDir)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create recorder: %w", err)
+		}
+		return recorder, nil
+	case replayDir != "":
+		log.Info().Str("dir", replayDir).Msg("Replaying GitHub API responses")
+		replayer, err := ghtransport.NewReplayer(replayDir)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create replayer: %w", err)
+		}
+		return replayer, nil
+	default:
+		return http.DefaultTransport, nil
+	}
+}
+
+// logAPICalls reports the GitHub API calls made per endpoint
+func logAPICalls() {
+	if apiBudget == nil {
+		return
+	}
+	var notModified int
+	for _, endpoint := range apiBudget.Report() {
+		notModified += endpoint.NotModified
+		log.Info().
+			Str("endpoint", endpoint.Endpoint).
+			Int("calls", endpoint.Calls).
+			Int("not_modified", endpoint.NotModified).
+			Msg("GitHub API calls")
+	}
+	log.Info().
+		Int("calls", apiBudget.Calls()).
+		Int("not_modified", notModified).
+		Int("max_api_calls", maxAPICalls).
+		Int("reserve_rate_limit", reserveRateLimit).
+		Msg("Total GitHub API calls")
+}
+
+// withGitHubURLs points a client at GitHub Enterprise Server when a GitHub URL is configured
+// githubAPIHost is the host of the GitHub API, which is the only host sent credentials
+func githubAPIHost() (string, error) {
+	if githubURL == "" {
+		return "api.github.com", nil
+	}
+	u, err := url.Parse(githubURL)
+	if err != nil || u.Host == "" {
+		return "", fmt.Errorf("invalid GitHub Enterprise Server URL '%s'", githubURL)
+	}
+	return u.Host, nil
+}
+
+func withGitHubURLs(client *github.Client) (*github.Client, error) {
+	if githubURL == "" {
+		return client, nil
+	}
+	uploadURL := githubUploadURL
+	if uploadURL == "" {
+		uploadURL = githubURL
+	}
+	client, err := client.WithEnterpriseURLs(githubURL, uploadURL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid GitHub Enterprise Server URL '%s': %w", githubURL, err)
+	}
+	log.Debug().
+		Str("base_url", client.BaseURL.String()).
+		Str("upload_url", client.UploadURL.String()).
+		Msg("Using GitHub Enterprise Server")
+	return client, nil
+}
+
 func setupLogging() error {
 	err := os.WriteFile(logFileName, []byte{}, 0644)
 	if err != nil {
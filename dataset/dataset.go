@@ -0,0 +1,299 @@
+package dataset
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/kalverra/workflow-metrics/gather"
+	"github.com/rs/zerolog/log"
+
+	// Pure Go SQLite driver, registered as "sqlite"
+	_ "modernc.org/sqlite"
+)
+
+// schema normalizes gathered workflow runs into tables that are easy to query
+var schema = []string{
+	`CREATE TABLE IF NOT EXISTS runs (
+		id             INTEGER PRIMARY KEY,
+		owner          TEXT NOT NULL,
+		repo           TEXT NOT NULL,
+		workflow_id    INTEGER,
+		workflow_name  TEXT,
+		workflow_path  TEXT,
+		event          TEXT,
+		head_branch    TEXT,
+		head_sha       TEXT,
+		actor          TEXT,
+		status         TEXT,
+		conclusion     TEXT,
+		run_number     INTEGER,
+		run_attempt    INTEGER,
+		created_at     TIMESTAMP,
+		run_started_at TIMESTAMP,
+		updated_at     TIMESTAMP,
+		html_url       TEXT
+	)`,
+	`CREATE TABLE IF NOT EXISTS attempts (
+		run_id           INTEGER NOT NULL REFERENCES runs(id),
+		attempt          INTEGER NOT NULL,
+		conclusion       TEXT,
+		job_count        INTEGER,
+		started_at       TIMESTAMP,
+		completed_at     TIMESTAMP,
+		duration_seconds REAL,
+		cost             INTEGER,
+		PRIMARY KEY (run_id, attempt)
+	)`,
+	`CREATE TABLE IF NOT EXISTS jobs (
+		id               INTEGER PRIMARY KEY,
+		run_id           INTEGER NOT NULL REFERENCES runs(id),
+		run_attempt      INTEGER,
+		name             TEXT,
+		status           TEXT,
+		conclusion       TEXT,
+		runner           TEXT,
+		runner_name      TEXT,
+		runner_group     TEXT,
+		labels           TEXT,
+		created_at       TIMESTAMP,
+		started_at       TIMESTAMP,
+		completed_at     TIMESTAMP,
+		queue_seconds    REAL,
+		duration_seconds REAL,
+		cost             INTEGER,
+		html_url         TEXT
+	)`,
+	`CREATE TABLE IF NOT EXISTS steps (
+		job_id           INTEGER NOT NULL REFERENCES jobs(id),
+		number           INTEGER NOT NULL,
+		name             TEXT,
+		status           TEXT,
+		conclusion       TEXT,
+		started_at       TIMESTAMP,
+		completed_at     TIMESTAMP,
+		duration_seconds REAL,
+		PRIMARY KEY (job_id, number)
+	)`,
+	`CREATE TABLE IF NOT EXISTS monitor_samples (
+		run_id      INTEGER NOT NULL REFERENCES runs(id),
+		sampled_at  TIMESTAMP NOT NULL,
+		process     TEXT,
+		pid         INTEGER,
+		cpu_percent REAL,
+		mem_percent REAL
+	)`,
+	`CREATE INDEX IF NOT EXISTS jobs_run_id ON jobs (run_id)`,
+	`CREATE INDEX IF NOT EXISTS monitor_samples_run_id ON monitor_samples (run_id)`,
+}
+
+// Dataset is a SQLite database of normalized workflow run data
+type Dataset struct {
+	path string
+	db   *sql.DB
+}
+
+// Open opens or creates a dataset at path
+func Open(path string) (*Dataset, error) {
+	if dir := filepath.Dir(path); dir != "" {
+		err := os.MkdirAll(dir, 0755)
+		if err != nil {
+			return nil, fmt.Errorf("failed to make dir '%s': %w", dir, err)
+		}
+	}
+
+	db, err := sql.Open("sqlite", path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open dataset '%s': %w", path, err)
+	}
+	for _, statement := range schema {
+		if _, err := db.Exec(statement); err != nil {
+			return nil, errors.Join(fmt.Errorf("failed to create dataset schema: %w", err), db.Close())
+		}
+	}
+	return &Dataset{path: path, db: db}, nil
+}
+
+// Close closes the dataset
+func (d *Dataset) Close() error {
+	return d.db.Close()
+}
+
+// Ingest writes workflow runs into the dataset, replacing any previous data for the same runs
+func (d *Dataset) Ingest(owner, repo string, workflowRuns ...*gather.WorkflowRunData) error {
+	startTime := time.Now()
+	tx, err := d.db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+
+	for _, workflowRun := range workflowRuns {
+		if err := ingestWorkflowRun(tx, owner, repo, workflowRun); err != nil {
+			return errors.Join(
+				fmt.Errorf("failed to ingest workflow run '%d': %w", workflowRun.GetID(), err),
+				tx.Rollback(),
+			)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	log.Debug().
+		Str("dataset", d.path).
+		Int("workflow_run_count", len(workflowRuns)).
+		Str("duration", time.Since(startTime).String()).
+		Msg("Ingested workflow runs")
+	return nil
+}
+
+func ingestWorkflowRun(tx *sql.Tx, owner, repo string, workflowRun *gather.WorkflowRunData) error {
+	runID := workflowRun.GetID()
+	for _, table := range []string{"monitor_samples", "attempts", "runs"} {
+		column := "run_id"
+		if table == "runs" {
+			column = "id"
+		}
+		if _, err := tx.Exec(fmt.Sprintf("DELETE FROM %s WHERE %s = ?", table, column), runID); err != nil {
+			return err
+		}
+	}
+	if _, err := tx.Exec(`DELETE FROM steps WHERE job_id IN (SELECT id FROM jobs WHERE run_id = ?)`, runID); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(`DELETE FROM jobs WHERE run_id = ?`, runID); err != nil {
+		return err
+	}
+
+	_, err := tx.Exec(
+		`INSERT INTO runs (
+			id, owner, repo, workflow_id, workflow_name, workflow_path, event, head_branch, head_sha, actor,
+			status, conclusion, run_number, run_attempt, created_at, run_started_at, updated_at, html_url
+		) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		runID, owner, repo, workflowRun.GetWorkflowID(), workflowRun.GetName(), workflowRun.GetPath(),
+		workflowRun.GetEvent(), workflowRun.GetHeadBranch(), workflowRun.GetHeadSHA(), workflowRun.GetActor().GetLogin(),
+		workflowRun.GetStatus(), workflowRun.GetConclusion(), workflowRun.GetRunNumber(), workflowRun.GetRunAttempt(),
+		nullTime(workflowRun.GetCreatedAt().Time), nullTime(workflowRun.GetRunStartedAt().Time),
+		nullTime(workflowRun.GetUpdatedAt().Time), workflowRun.GetHTMLURL(),
+	)
+	if err != nil {
+		return fmt.Errorf("failed to insert run: %w", err)
+	}
+
+	attempts := map[int64]*attempt{}
+	for _, job := range workflowRun.Jobs {
+		var (
+			startedAt    = job.GetStartedAt().Time
+			completedAt  = job.GetCompletedAt().Time
+			queueSeconds any
+		)
+		if seconds, ok := job.QueueSeconds(); ok {
+			queueSeconds = seconds
+		}
+		_, err := tx.Exec(
+			`INSERT OR REPLACE INTO jobs (
+				id, run_id, run_attempt, name, status, conclusion, runner, runner_name, runner_group, labels,
+				created_at, started_at, completed_at, queue_seconds, duration_seconds, cost, html_url
+			) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+			job.GetID(), runID, job.GetRunAttempt(), job.GetName(), job.GetStatus(), job.GetConclusion(),
+			job.Runner, job.GetRunnerName(), job.GetRunnerGroupName(), strings.Join(job.Labels, ","),
+			nullTime(job.GetCreatedAt().Time), nullTime(startedAt), nullTime(completedAt),
+			queueSeconds, secondsBetween(startedAt, completedAt),
+			job.Cost, job.GetHTMLURL(),
+		)
+		if err != nil {
+			return fmt.Errorf("failed to insert job '%d': %w", job.GetID(), err)
+		}
+
+		for _, step := range job.Steps {
+			_, err := tx.Exec(
+				`INSERT OR REPLACE INTO steps (
+					job_id, number, name, status, conclusion, started_at, completed_at, duration_seconds
+				) VALUES (?, ?, ?, ?, ?, ?, ?, ?)`,
+				job.GetID(), step.GetNumber(), step.GetName(), step.GetStatus(), step.GetConclusion(),
+				nullTime(step.GetStartedAt().Time), nullTime(step.GetCompletedAt().Time),
+				secondsBetween(step.GetStartedAt().Time, step.GetCompletedAt().Time),
+			)
+			if err != nil {
+				return fmt.Errorf("failed to insert step '%d' of job '%d': %w", step.GetNumber(), job.GetID(), err)
+			}
+		}
+
+		runAttempt := job.GetRunAttempt()
+		a, ok := attempts[runAttempt]
+		if !ok {
+			a = &attempt{conclusion: "success"}
+			attempts[runAttempt] = a
+		}
+		a.add(job)
+	}
+
+	for runAttempt, a := range attempts {
+		_, err := tx.Exec(
+			`INSERT INTO attempts (
+				run_id, attempt, conclusion, job_count, started_at, completed_at, duration_seconds, cost
+			) VALUES (?, ?, ?, ?, ?, ?, ?, ?)`,
+			runID, runAttempt, a.conclusion, a.jobCount, nullTime(a.startedAt), nullTime(a.completedAt),
+			secondsBetween(a.startedAt, a.completedAt), a.cost,
+		)
+		if err != nil {
+			return fmt.Errorf("failed to insert attempt '%d': %w", runAttempt, err)
+		}
+	}
+
+	if workflowRun.MonitorObservations != nil {
+		for _, sample := range workflowRun.MonitorObservations.Samples {
+			_, err := tx.Exec(
+				`INSERT INTO monitor_samples (run_id, sampled_at, process, pid, cpu_percent, mem_percent) VALUES (?, ?, ?, ?, ?, ?)`,
+				runID, sample.Time.UTC(), sample.Process, sample.PID, sample.CPUPercent, sample.MemPercent,
+			)
+			if err != nil {
+				return fmt.Errorf("failed to insert monitor sample: %w", err)
+			}
+		}
+	}
+	return nil
+}
+
+// attempt summarizes all jobs from a single attempt of a workflow run
+type attempt struct {
+	conclusion  string
+	jobCount    int
+	startedAt   time.Time
+	completedAt time.Time
+	cost        int64
+}
+
+func (a *attempt) add(job *gather.JobsData) {
+	a.jobCount++
+	a.cost += job.Cost
+	if conclusion := job.GetConclusion(); conclusion == "failure" || (conclusion == "cancelled" && a.conclusion != "failure") {
+		a.conclusion = conclusion
+	}
+	if startedAt := job.GetStartedAt().Time; !startedAt.IsZero() && (a.startedAt.IsZero() || startedAt.Before(a.startedAt)) {
+		a.startedAt = startedAt
+	}
+	if completedAt := job.GetCompletedAt().Time; completedAt.After(a.completedAt) {
+		a.completedAt = completedAt
+	}
+}
+
+// nullTime stores zero times as NULL
+func nullTime(t time.Time) any {
+	if t.IsZero() {
+		return nil
+	}
+	return t.UTC()
+}
+
+// secondsBetween stores durations with a missing start or end as NULL
+func secondsBetween(start, end time.Time) any {
+	if start.IsZero() || end.IsZero() {
+		return nil
+	}
+	return end.Sub(start).Seconds()
+}
@@ -0,0 +1,299 @@
+package export
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/kalverra/workflow-metrics/gather"
+	"github.com/parquet-go/parquet-go"
+	"github.com/rs/zerolog/log"
+)
+
+// Supported export formats
+const (
+	FormatParquet = "parquet"
+	FormatNDJSON  = "ndjson"
+)
+
+const partitionDateFormat = "2006-01-02"
+
+// RunRow is a single workflow run
+type RunRow struct {
+	ID              int64      `parquet:"id" json:"id"`
+	Owner           string     `parquet:"owner" json:"owner"`
+	Repo            string     `parquet:"repo" json:"repo"`
+	WorkflowID      int64      `parquet:"workflow_id" json:"workflow_id"`
+	WorkflowName    string     `parquet:"workflow_name" json:"workflow_name"`
+	WorkflowPath    string     `parquet:"workflow_path" json:"workflow_path"`
+	Event           string     `parquet:"event" json:"event"`
+	HeadBranch      string     `parquet:"head_branch" json:"head_branch"`
+	HeadSHA         string     `parquet:"head_sha" json:"head_sha"`
+	Actor           string     `parquet:"actor" json:"actor"`
+	Status          string     `parquet:"status" json:"status"`
+	Conclusion      string     `parquet:"conclusion" json:"conclusion"`
+	RunNumber       int64      `parquet:"run_number" json:"run_number"`
+	RunAttempt      int64      `parquet:"run_attempt" json:"run_attempt"`
+	CreatedAt       *time.Time `parquet:"created_at,optional" json:"created_at"`
+	RunStartedAt    *time.Time `parquet:"run_started_at,optional" json:"run_started_at"`
+	UpdatedAt       *time.Time `parquet:"updated_at,optional" json:"updated_at"`
+	DurationSeconds float64    `parquet:"duration_seconds" json:"duration_seconds"`
+	JobCount        int64      `parquet:"job_count" json:"job_count"`
+	Cost            int64      `parquet:"cost" json:"cost"`
+	HTMLURL         string     `parquet:"html_url" json:"html_url"`
+}
+
+// JobRow is a single job of a workflow run
+type JobRow struct {
+	ID              int64      `parquet:"id" json:"id"`
+	RunID           int64      `parquet:"run_id" json:"run_id"`
+	Owner           string     `parquet:"owner" json:"owner"`
+	Repo            string     `parquet:"repo" json:"repo"`
+	RunAttempt      int64      `parquet:"run_attempt" json:"run_attempt"`
+	WorkflowName    string     `parquet:"workflow_name" json:"workflow_name"`
+	Name            string     `parquet:"name" json:"name"`
+	Status          string     `parquet:"status" json:"status"`
+	Conclusion      string     `parquet:"conclusion" json:"conclusion"`
+	Runner          string     `parquet:"runner" json:"runner"`
+	RunnerName      string     `parquet:"runner_name" json:"runner_name"`
+	RunnerGroup     string     `parquet:"runner_group" json:"runner_group"`
+	Labels          []string   `parquet:"labels,list" json:"labels"`
+	CreatedAt       *time.Time `parquet:"created_at,optional" json:"created_at"`
+	StartedAt       *time.Time `parquet:"started_at,optional" json:"started_at"`
+	CompletedAt     *time.Time `parquet:"completed_at,optional" json:"completed_at"`
+	QueueSeconds    float64    `parquet:"queue_seconds" json:"queue_seconds"`
+	DurationSeconds float64    `parquet:"duration_seconds" json:"duration_seconds"`
+	Cost            int64      `parquet:"cost" json:"cost"`
+	HTMLURL         string     `parquet:"html_url" json:"html_url"`
+}
+
+// StepRow is a single step of a job
+type StepRow struct {
+	JobID           int64      `parquet:"job_id" json:"job_id"`
+	RunID           int64      `parquet:"run_id" json:"run_id"`
+	Owner           string     `parquet:"owner" json:"owner"`
+	Repo            string     `parquet:"repo" json:"repo"`
+	JobName         string     `parquet:"job_name" json:"job_name"`
+	Number          int64      `parquet:"number" json:"number"`
+	Name            string     `parquet:"name" json:"name"`
+	Status          string     `parquet:"status" json:"status"`
+	Conclusion      string     `parquet:"conclusion" json:"conclusion"`
+	StartedAt       *time.Time `parquet:"started_at,optional" json:"started_at"`
+	CompletedAt     *time.Time `parquet:"completed_at,optional" json:"completed_at"`
+	DurationSeconds float64    `parquet:"duration_seconds" json:"duration_seconds"`
+}
+
+// partition is a group of rows for a single repo on a single date
+type partition struct {
+	repo string
+	date string
+}
+
+// tables holds the flattened rows of every table, grouped by partition
+type tables struct {
+	runs  map[partition][]RunRow
+	jobs  map[partition][]JobRow
+	steps map[partition][]StepRow
+}
+
+// WorkflowRuns flattens gathered workflow runs of a repo into runs, jobs, and steps tables, written to outputDir
+// partitioned by repo and the date each run was created, e.g. <outputDir>/jobs/repo=<owner>__<repo>/date=2025-01-31/
+func WorkflowRuns(owner, repo, outputDir, format string) error {
+	if format != FormatParquet && format != FormatNDJSON {
+		return fmt.Errorf("unknown export format '%s', must be one of %s or %s", format, FormatParquet, FormatNDJSON)
+	}
+
+	startTime := time.Now()
+	workflowRuns, err := gather.LocalWorkflowRuns(owner, repo)
+	if err != nil {
+		return err
+	}
+
+	t := flatten(owner, repo, workflowRuns)
+	var files []string
+	for table, write := range map[string]func() ([]string, error){
+		"runs":  func() ([]string, error) { return writePartitions(outputDir, "runs", format, t.runs) },
+		"jobs":  func() ([]string, error) { return writePartitions(outputDir, "jobs", format, t.jobs) },
+		"steps": func() ([]string, error) { return writePartitions(outputDir, "steps", format, t.steps) },
+	} {
+		written, err := write()
+		if err != nil {
+			return fmt.Errorf("failed to export %s table: %w", table, err)
+		}
+		files = append(files, written...)
+	}
+
+	log.Info().
+		Str("owner", owner).
+		Str("repo", repo).
+		Str("format", format).
+		Int("workflow_run_count", len(workflowRuns)).
+		Int("file_count", len(files)).
+		Str("duration", time.Since(startTime).String()).
+		Msg("Exported workflow runs")
+	return nil
+}
+
+func flatten(owner, repo string, workflowRuns []*gather.WorkflowRunData) *tables {
+	t := &tables{
+		runs:  map[partition][]RunRow{},
+		jobs:  map[partition][]JobRow{},
+		steps: map[partition][]StepRow{},
+	}
+
+	for _, workflowRun := range workflowRuns {
+		p := partition{
+			repo: partitionRepo(owner, repo),
+			date: workflowRun.GetCreatedAt().UTC().Format(partitionDateFormat),
+		}
+		run := RunRow{
+			ID:              workflowRun.GetID(),
+			Owner:           owner,
+			Repo:            repo,
+			WorkflowID:      workflowRun.GetWorkflowID(),
+			WorkflowName:    workflowRun.GetName(),
+			WorkflowPath:    workflowRun.GetPath(),
+			Event:           workflowRun.GetEvent(),
+			HeadBranch:      workflowRun.GetHeadBranch(),
+			HeadSHA:         workflowRun.GetHeadSHA(),
+			Actor:           workflowRun.GetActor().GetLogin(),
+			Status:          workflowRun.GetStatus(),
+			Conclusion:      workflowRun.GetConclusion(),
+			RunNumber:       int64(workflowRun.GetRunNumber()),
+			RunAttempt:      int64(workflowRun.GetRunAttempt()),
+			CreatedAt:       optionalTime(workflowRun.GetCreatedAt().Time),
+			RunStartedAt:    optionalTime(workflowRun.GetRunStartedAt().Time),
+			UpdatedAt:       optionalTime(workflowRun.GetUpdatedAt().Time),
+			DurationSeconds: secondsBetween(workflowRun.GetRunStartedAt().Time, workflowRun.GetUpdatedAt().Time),
+			JobCount:        int64(len(workflowRun.Jobs)),
+			HTMLURL:         workflowRun.GetHTMLURL(),
+		}
+
+		for _, job := range workflowRun.Jobs {
+			run.Cost += job.Cost
+			queueSeconds, _ := job.QueueSeconds()
+			t.jobs[p] = append(t.jobs[p], JobRow{
+				ID:              job.GetID(),
+				RunID:           workflowRun.GetID(),
+				Owner:           owner,
+				Repo:            repo,
+				RunAttempt:      job.GetRunAttempt(),
+				WorkflowName:    workflowRun.GetName(),
+				Name:            job.GetName(),
+				Status:          job.GetStatus(),
+				Conclusion:      job.GetConclusion(),
+				Runner:          job.Runner,
+				RunnerName:      job.GetRunnerName(),
+				RunnerGroup:     job.GetRunnerGroupName(),
+				Labels:          job.Labels,
+				CreatedAt:       optionalTime(job.GetCreatedAt().Time),
+				StartedAt:       optionalTime(job.GetStartedAt().Time),
+				CompletedAt:     optionalTime(job.GetCompletedAt().Time),
+				QueueSeconds:    queueSeconds,
+				DurationSeconds: secondsBetween(job.GetStartedAt().Time, job.GetCompletedAt().Time),
+				Cost:            job.Cost,
+				HTMLURL:         job.GetHTMLURL(),
+			})
+
+			for _, step := range job.Steps {
+				t.steps[p] = append(t.steps[p], StepRow{
+					JobID:           job.GetID(),
+					RunID:           workflowRun.GetID(),
+					Owner:           owner,
+					Repo:            repo,
+					JobName:         job.GetName(),
+					Number:          step.GetNumber(),
+					Name:            step.GetName(),
+					Status:          step.GetStatus(),
+					Conclusion:      step.GetConclusion(),
+					StartedAt:       optionalTime(step.GetStartedAt().Time),
+					CompletedAt:     optionalTime(step.GetCompletedAt().Time),
+					DurationSeconds: secondsBetween(step.GetStartedAt().Time, step.GetCompletedAt().Time),
+				})
+			}
+		}
+		t.runs[p] = append(t.runs[p], run)
+	}
+	return t
+}
+
+// writePartitions writes each partition of a table to its own file, returning the files written
+func writePartitions[T any](outputDir, table, format string, partitions map[partition][]T) ([]string, error) {
+	keys := make([]partition, 0, len(partitions))
+	for p := range partitions {
+		keys = append(keys, p)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		return keys[i].repo+keys[i].date < keys[j].repo+keys[j].date
+	})
+
+	files := make([]string, 0, len(keys))
+	for _, p := range keys {
+		dir := filepath.Join(outputDir, table, "repo="+p.repo, "date="+p.date)
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return files, fmt.Errorf("failed to make dir '%s': %w", dir, err)
+		}
+		file := filepath.Join(dir, "part-0."+format)
+
+		var err error
+		switch format {
+		case FormatParquet:
+			err = parquet.WriteFile(file, partitions[p])
+		case FormatNDJSON:
+			err = writeNDJSON(file, partitions[p])
+		}
+		if err != nil {
+			return files, fmt.Errorf("failed to write '%s': %w", file, err)
+		}
+		log.Debug().Str("file", file).Int("row_count", len(partitions[p])).Msg("Exported partition")
+		files = append(files, file)
+	}
+	return files, nil
+}
+
+func writeNDJSON[T any](file string, rows []T) error {
+	f, err := os.Create(file)
+	if err != nil {
+		return err
+	}
+	writer := bufio.NewWriter(f)
+	encoder := json.NewEncoder(writer)
+	for _, row := range rows {
+		if err := encoder.Encode(row); err != nil {
+			f.Close()
+			return err
+		}
+	}
+	if err := writer.Flush(); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// optionalTime stores zero times as nulls
+func optionalTime(t time.Time) *time.Time {
+	if t.IsZero() {
+		return nil
+	}
+	t = t.UTC()
+	return &t
+}
+
+// secondsBetween is the number of seconds between two times, or 0 if either is missing
+func secondsBetween(start, end time.Time) float64 {
+	if start.IsZero() || end.IsZero() {
+		return 0
+	}
+	return end.Sub(start).Seconds()
+}
+
+// partitionRepo formats a repo the way it's shown in partition directories
+func partitionRepo(owner, repo string) string {
+	return strings.Join([]string{owner, repo}, "__")
+}
@@ -0,0 +1,348 @@
+package fakegithub
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/google/go-github/v70/github"
+)
+
+// BaseTime is when fixtures start by default, so data built from them is deterministic
+var BaseTime = time.Date(2025, time.January, 1, 12, 0, 0, 0, time.UTC)
+
+// RunFixture builds a workflow run and its jobs. Build it with Run, then add it to a Server.
+type RunFixture struct {
+	run       *github.WorkflowRun
+	jobs      []*JobFixture
+	billing   bool
+	artifacts []*artifactFixture
+}
+
+// JobFixture builds a job of a workflow run. Build it with RunFixture.Job.
+type JobFixture struct {
+	job *github.WorkflowJob
+	// runner is the billing runner of the job, e.g. UBUNTU
+	runner string
+	logs   string
+}
+
+// artifactFixture is an artifact of a workflow run, and the contents it's downloaded as
+type artifactFixture struct {
+	artifact *github.Artifact
+	content  []byte
+}
+
+// Run starts building a completed, successful workflow run of ci.yml named CI on main, pushed by octocat, that starts
+// at BaseTime
+func Run(id int64) *RunFixture {
+	return &RunFixture{
+		run: &github.WorkflowRun{
+			ID:              github.Ptr(id),
+			Name:            github.Ptr("CI"),
+			RunNumber:       github.Ptr(int(id)),
+			RunAttempt:      github.Ptr(1),
+			Event:           github.Ptr("push"),
+			HeadBranch:      github.Ptr("main"),
+			HeadSHA:         github.Ptr(fmt.Sprintf("%040x", id)),
+			Status:          github.Ptr("completed"),
+			Conclusion:      github.Ptr("success"),
+			WorkflowID:      github.Ptr(int64(1)),
+			Path:            github.Ptr(".github/workflows/ci.yml"),
+			Actor:           &github.User{Login: github.Ptr("octocat")},
+			TriggeringActor: &github.User{Login: github.Ptr("octocat")},
+			CreatedAt:       &github.Timestamp{Time: BaseTime},
+			RunStartedAt:    &github.Timestamp{Time: BaseTime},
+		},
+		billing: true,
+	}
+}
+
+// Name sets the workflow name of the run
+func (f *RunFixture) Name(name string) *RunFixture {
+	f.run.Name = github.Ptr(name)
+	return f
+}
+
+// Branch sets the head branch of the run
+func (f *RunFixture) Branch(branch string) *RunFixture {
+	f.run.HeadBranch = github.Ptr(branch)
+	return f
+}
+
+// SHA sets the head commit of the run
+func (f *RunFixture) SHA(sha string) *RunFixture {
+	f.run.HeadSHA = github.Ptr(sha)
+	return f
+}
+
+// Path sets the workflow file of the run, e.g. .github/workflows/release.yml
+func (f *RunFixture) Path(path string) *RunFixture {
+	f.run.Path = github.Ptr(path)
+	return f
+}
+
+// Actor sets who triggered the run
+func (f *RunFixture) Actor(login string) *RunFixture {
+	f.run.Actor = &github.User{Login: github.Ptr(login)}
+	f.run.TriggeringActor = &github.User{Login: github.Ptr(login)}
+	return f
+}
+
+// Event sets the event that triggered the run, e.g. pull_request
+func (f *RunFixture) Event(event string) *RunFixture {
+	f.run.Event = github.Ptr(event)
+	return f
+}
+
+// Created sets when the run was created and started, shifting its jobs along with it
+func (f *RunFixture) Created(created time.Time) *RunFixture {
+	shift := created.Sub(f.run.GetCreatedAt().Time)
+	f.run.CreatedAt = &github.Timestamp{Time: created}
+	f.run.RunStartedAt = &github.Timestamp{Time: f.run.GetRunStartedAt().Add(shift)}
+	for _, job := range f.jobs {
+		job.shift(shift)
+	}
+	return f
+}
+
+// Attempt sets the run attempt
+func (f *RunFixture) Attempt(attempt int) *RunFixture {
+	f.run.RunAttempt = github.Ptr(attempt)
+	return f
+}
+
+// InProgress marks the run as still in progress
+func (f *RunFixture) InProgress() *RunFixture {
+	f.run.Status = github.Ptr("in_progress")
+	f.run.Conclusion = nil
+	return f
+}
+
+// Conclusion sets how the run concluded, e.g. failure
+func (f *RunFixture) Conclusion(conclusion string) *RunFixture {
+	f.run.Conclusion = github.Ptr(conclusion)
+	return f
+}
+
+// WithoutBilling makes the run's usage respond with not found, like GitHub Enterprise Server
+func (f *RunFixture) WithoutBilling() *RunFixture {
+	f.billing = false
+	return f
+}
+
+// Artifact adds an artifact to the run, downloaded as content
+func (f *RunFixture) Artifact(id int64, name string, content []byte) *RunFixture {
+	f.artifacts = append(f.artifacts, &artifactFixture{
+		artifact: &github.Artifact{
+			ID:          github.Ptr(id),
+			Name:        github.Ptr(name),
+			SizeInBytes: github.Ptr(int64(len(content))),
+			WorkflowRun: &github.ArtifactWorkflowRun{ID: f.run.ID, HeadBranch: f.run.HeadBranch, HeadSHA: f.run.HeadSHA},
+			CreatedAt:   f.run.CreatedAt,
+		},
+		content: content,
+	})
+	return f
+}
+
+// Job adds a job to the run that's queued when the run starts, and runs for a minute on UBUNTU after the jobs before
+// it
+func (f *RunFixture) Job(id int64, name string) *JobFixture {
+	started := f.run.GetRunStartedAt().Time
+	if len(f.jobs) > 0 {
+		started = f.jobs[len(f.jobs)-1].job.GetCompletedAt().Time
+	}
+	job := &JobFixture{
+		job: &github.WorkflowJob{
+			ID:           github.Ptr(id),
+			RunID:        f.run.ID,
+			RunAttempt:   github.Ptr(int64(f.run.GetRunAttempt())),
+			Name:         github.Ptr(name),
+			WorkflowName: f.run.Name,
+			HeadBranch:   f.run.HeadBranch,
+			HeadSHA:      f.run.HeadSHA,
+			Status:       github.Ptr("completed"),
+			Conclusion:   github.Ptr("success"),
+			CreatedAt:    &github.Timestamp{Time: f.run.GetRunStartedAt().Time},
+			StartedAt:    &github.Timestamp{Time: started},
+			CompletedAt:  &github.Timestamp{Time: started.Add(time.Minute)},
+			Labels:       []string{"ubuntu-latest"},
+			RunnerName:   github.Ptr(fmt.Sprintf("GitHub Actions %d", id)),
+		},
+		runner: "UBUNTU",
+	}
+	f.jobs = append(f.jobs, job)
+	return job
+}
+
+// workflowRun is the run as GitHub serves it, updated when its last job completed
+func (f *RunFixture) workflowRun() *github.WorkflowRun {
+	run := *f.run
+	run.UpdatedAt = run.RunStartedAt
+	for _, job := range f.jobs {
+		if job.job.GetCompletedAt().After(run.GetUpdatedAt().Time) {
+			run.UpdatedAt = job.job.CompletedAt
+		}
+	}
+	return &run
+}
+
+// ID is the workflow run ID
+func (f *RunFixture) ID() int64 {
+	return f.run.GetID()
+}
+
+// WorkflowRun is the built workflow run
+func (f *RunFixture) WorkflowRun() *github.WorkflowRun {
+	return f.workflowRun()
+}
+
+// usage builds the billing data of the run from its jobs
+func (f *RunFixture) usage() *github.WorkflowRunUsage {
+	var (
+		billable   = github.WorkflowRunBillMap{}
+		durationMS int64
+	)
+	for _, job := range f.jobs {
+		// Jobs are billed once they complete
+		if job.job.CompletedAt == nil {
+			continue
+		}
+		ms := job.job.GetCompletedAt().Sub(job.job.GetStartedAt().Time).Milliseconds()
+		durationMS += ms
+		bill, ok := billable[job.runner]
+		if !ok {
+			bill = &github.WorkflowRunBill{TotalMS: github.Ptr(int64(0)), Jobs: github.Ptr(0)}
+			billable[job.runner] = bill
+		}
+		// Billable time is rounded up to the minute for each job
+		bill.TotalMS = github.Ptr(bill.GetTotalMS() + (ms+59999)/60000*60000)
+		bill.Jobs = github.Ptr(bill.GetJobs() + 1)
+		bill.JobRuns = append(bill.JobRuns, &github.WorkflowRunJobRun{
+			JobID:      github.Ptr(int(job.job.GetID())),
+			DurationMS: github.Ptr((ms + 59999) / 60000 * 60000),
+		})
+	}
+	return &github.WorkflowRunUsage{
+		Billable:      &billable,
+		RunDurationMS: github.Ptr(durationMS),
+	}
+}
+
+// Queued sets how long the job waited for a runner after the run started, keeping how long it ran
+func (f *JobFixture) Queued(queued time.Duration) *JobFixture {
+	ran := f.job.GetCompletedAt().Sub(f.job.GetStartedAt().Time)
+	started := f.job.GetCreatedAt().Add(queued)
+	f.job.StartedAt = &github.Timestamp{Time: started}
+	f.job.CompletedAt = &github.Timestamp{Time: started.Add(ran)}
+	return f
+}
+
+// Ran sets how long the job ran for
+func (f *JobFixture) Ran(ran time.Duration) *JobFixture {
+	f.job.CompletedAt = &github.Timestamp{Time: f.job.GetStartedAt().Add(ran)}
+	return f
+}
+
+// Conclusion sets how the job concluded, e.g. failure
+func (f *JobFixture) Conclusion(conclusion string) *JobFixture {
+	f.job.Conclusion = github.Ptr(conclusion)
+	return f
+}
+
+// InProgress marks the job as still running
+func (f *JobFixture) InProgress() *JobFixture {
+	f.job.Status = github.Ptr("in_progress")
+	f.job.Conclusion = nil
+	f.job.CompletedAt = nil
+	return f
+}
+
+// Runner sets the billing runner of the job, e.g. UBUNTU_4_CORE, and the labels it ran with
+func (f *JobFixture) Runner(runner string, labels ...string) *JobFixture {
+	f.runner = runner
+	if len(labels) > 0 {
+		f.job.Labels = labels
+	}
+	return f
+}
+
+// Step adds a step to the job that runs for a duration after the steps before it
+func (f *JobFixture) Step(name string, ran time.Duration, conclusion string) *JobFixture {
+	started := f.job.GetStartedAt().Time
+	if len(f.job.Steps) > 0 {
+		started = f.job.Steps[len(f.job.Steps)-1].GetCompletedAt().Time
+	}
+	f.job.Steps = append(f.job.Steps, &github.TaskStep{
+		Name:        github.Ptr(name),
+		Number:      github.Ptr(int64(len(f.job.Steps) + 1)),
+		Status:      github.Ptr("completed"),
+		Conclusion:  github.Ptr(conclusion),
+		StartedAt:   &github.Timestamp{Time: started},
+		CompletedAt: &github.Timestamp{Time: started.Add(ran)},
+	})
+	return f
+}
+
+// Logs sets the job's plain text logs
+func (f *JobFixture) Logs(logs string) *JobFixture {
+	f.logs = logs
+	return f
+}
+
+// WorkflowJob is the built job
+func (f *JobFixture) WorkflowJob() *github.WorkflowJob {
+	return f.job
+}
+
+// shift moves all of the job's times
+func (f *JobFixture) shift(shift time.Duration) {
+	for _, t := range []**github.Timestamp{&f.job.CreatedAt, &f.job.StartedAt, &f.job.CompletedAt} {
+		if *t != nil {
+			*t = &github.Timestamp{Time: (*t).Add(shift)}
+		}
+	}
+	for _, step := range f.job.Steps {
+		step.StartedAt = &github.Timestamp{Time: step.GetStartedAt().Add(shift)}
+		step.CompletedAt = &github.Timestamp{Time: step.GetCompletedAt().Add(shift)}
+	}
+}
+
+// PullRequestFixture builds a pull request. Build it with PullRequest, then add it to a Server.
+type PullRequestFixture struct {
+	pullRequest *github.PullRequest
+	commits     []string
+}
+
+// PullRequest starts building a merged pull request from a feature branch to main
+func PullRequest(number int) *PullRequestFixture {
+	return &PullRequestFixture{
+		pullRequest: &github.PullRequest{
+			Number:    github.Ptr(number),
+			Title:     github.Ptr(fmt.Sprintf("Pull request %d", number)),
+			State:     github.Ptr("closed"),
+			Merged:    github.Ptr(true),
+			CreatedAt: &github.Timestamp{Time: BaseTime},
+			Head:      &github.PullRequestBranch{Ref: github.Ptr(fmt.Sprintf("feature-%d", number))},
+			Base:      &github.PullRequestBranch{Ref: github.Ptr("main")},
+		},
+	}
+}
+
+// Open marks the pull request as still open
+func (f *PullRequestFixture) Open() *PullRequestFixture {
+	f.pullRequest.State = github.Ptr("open")
+	f.pullRequest.Merged = github.Ptr(false)
+	return f
+}
+
+// Commits adds the workflow runs' head commits to the pull request
+func (f *PullRequestFixture) Commits(runs ...*RunFixture) *PullRequestFixture {
+	for _, run := range runs {
+		f.commits = append(f.commits, run.run.GetHeadSHA())
+		f.pullRequest.Head.SHA = run.run.HeadSHA
+		run.run.Event = github.Ptr("pull_request")
+		run.run.HeadBranch = f.pullRequest.Head.Ref
+	}
+	return f
+}
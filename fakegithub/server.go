@@ -0,0 +1,578 @@
+// Package fakegithub is an in-process fake of the GitHub Actions API, serving workflow runs, jobs, usage, artifacts,
+// logs, pull requests, and GitHub App installations built from fixtures. Point a client at it to gather deterministic
+// data without a network or credentials.
+//
+//	server := fakegithub.New()
+//	defer server.Close()
+//	run := fakegithub.Run(1)
+//	run.Job(10, "build").Ran(3 * time.Minute)
+//	server.AddRuns("owner", "repo", run)
+//	data, err := gather.WorkflowRun(server.Client(), "owner", "repo", run.ID(), false)
+package fakegithub
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/go-github/v70/github"
+)
+
+const (
+	// apiPrefix is the path clients made with Client call the API under, like GitHub Enterprise Server
+	apiPrefix = "/api/v3"
+	// downloadPrefix is where artifacts and logs are redirected to for download
+	downloadPrefix = "/_download"
+
+	defaultPerPage = 30
+	rateLimit      = 5000
+
+	// installationTokenPrefix starts the tokens minted for GitHub App installations
+	installationTokenPrefix = "ghs_fake_"
+)
+
+// prefixKey is the context key of the prefix a request was made under, to link to other pages with it
+type prefixKey struct{}
+
+// Server is a fake GitHub Actions API. Add fixtures to it with AddRuns and AddPullRequests.
+type Server struct {
+	// URL is the base URL of the server, e.g. http://127.0.0.1:1234
+	URL string
+	// MaxPerPage caps the page size of list responses, to force clients to paginate
+	MaxPerPage int
+
+	server *httptest.Server
+	mux    *http.ServeMux
+
+	mu           sync.Mutex
+	runs         map[string]map[int64]*RunFixture
+	pullRequests map[string]map[int]*PullRequestFixture
+	failures     map[string][]int
+	// installations are GitHub App installations by lowercase owner
+	installations map[string]installation
+	requests      []string
+	remaining     int
+}
+
+// New starts a fake GitHub API server. Close it when done.
+func New() *Server {
+	s := &Server{
+		MaxPerPage:    100,
+		mux:           http.NewServeMux(),
+		runs:          map[string]map[int64]*RunFixture{},
+		pullRequests:  map[string]map[int]*PullRequestFixture{},
+		failures:      map[string][]int{},
+		installations: map[string]installation{},
+		remaining:     rateLimit,
+	}
+	s.mux.HandleFunc("GET /rate_limit", s.handleRateLimit)
+	s.mux.HandleFunc("GET /orgs/{owner}/installation", s.handleFindInstallation)
+	s.mux.HandleFunc("GET /users/{owner}/installation", s.handleFindInstallation)
+	s.mux.HandleFunc("POST /app/installations/{id}/access_tokens", s.handleCreateInstallationToken)
+	s.mux.HandleFunc("GET /repos/{owner}/{repo}/actions/runs", s.handleListRuns)
+	s.mux.HandleFunc("GET /repos/{owner}/{repo}/actions/runs/{id}", s.handleGetRun)
+	s.mux.HandleFunc("GET /repos/{owner}/{repo}/actions/runs/{id}/jobs", s.handleListJobs)
+	s.mux.HandleFunc("GET /repos/{owner}/{repo}/actions/runs/{id}/timing", s.handleUsage)
+	s.mux.HandleFunc("GET /repos/{owner}/{repo}/actions/runs/{id}/artifacts", s.handleListArtifacts)
+	s.mux.HandleFunc("GET /repos/{owner}/{repo}/actions/artifacts/{id}/zip", s.handleDownloadArtifact)
+	s.mux.HandleFunc("GET /repos/{owner}/{repo}/actions/jobs/{id}/logs", s.handleJobLogs)
+	s.mux.HandleFunc("GET /repos/{owner}/{repo}/pulls/{number}", s.handleGetPullRequest)
+	s.mux.HandleFunc("GET /repos/{owner}/{repo}/pulls/{number}/commits", s.handleListCommits)
+	s.mux.HandleFunc("GET "+downloadPrefix+"/artifacts/{owner}/{repo}/{id}", s.handleArtifactContent)
+	s.mux.HandleFunc("GET "+downloadPrefix+"/logs/{owner}/{repo}/{id}", s.handleLogsContent)
+	s.mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		writeError(w, http.StatusNotFound, "Not Found")
+	})
+
+	s.server = httptest.NewServer(s)
+	s.URL = s.server.URL
+	return s
+}
+
+// Close shuts down the server
+func (s *Server) Close() {
+	s.server.Close()
+}
+
+// Client is a GitHub client that calls the server
+func (s *Server) Client() *github.Client {
+	client, err := github.NewClient(s.server.Client()).WithEnterpriseURLs(s.URL, s.URL)
+	if err != nil {
+		panic(fmt.Sprintf("invalid fake GitHub URL '%s': %s", s.URL, err))
+	}
+	return client
+}
+
+// AddRuns adds workflow runs to a repo. Fixtures can still be changed after they're added.
+func (s *Server) AddRuns(owner, repo string, runs ...*RunFixture) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	key := repoKey(owner, repo)
+	if s.runs[key] == nil {
+		s.runs[key] = map[int64]*RunFixture{}
+	}
+	for _, run := range runs {
+		s.runs[key][run.ID()] = run
+	}
+}
+
+// AddPullRequests adds pull requests to a repo. Add the workflow runs of their commits with AddRuns.
+func (s *Server) AddPullRequests(owner, repo string, pullRequests ...*PullRequestFixture) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	key := repoKey(owner, repo)
+	if s.pullRequests[key] == nil {
+		s.pullRequests[key] = map[int]*PullRequestFixture{}
+	}
+	for _, pullRequest := range pullRequests {
+		s.pullRequests[key][pullRequest.pullRequest.GetNumber()] = pullRequest
+	}
+}
+
+// installation is a GitHub App installation on an org or user account
+type installation struct {
+	id    int64
+	owner string
+	org   bool
+}
+
+// AddInstallation installs a GitHub App on an org, or on a user account if org is false. Once an owner has an
+// installation, its repos can only be called with no token, or the token minted for that installation.
+func (s *Server) AddInstallation(owner string, id int64, org bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.installations[strings.ToLower(owner)] = installation{id: id, owner: owner, org: org}
+}
+
+// InstallationToken is the token the server mints for an installation
+func InstallationToken(id int64) string {
+	return installationTokenPrefix + strconv.FormatInt(id, 10)
+}
+
+// Fail makes the next calls to an API path, e.g. /repos/owner/repo/actions/runs/1/jobs, respond with the statuses in
+// order, before responding normally again
+func (s *Server) Fail(path string, statuses ...int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.failures[path] = append(s.failures[path], statuses...)
+}
+
+// Requests are the requests made to the server so far, e.g. "GET /repos/owner/repo/actions/runs/1/jobs?page=2"
+func (s *Server) Requests() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]string{}, s.requests...)
+}
+
+// ServeHTTP records the request and serves it, from under the API prefix or not
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var (
+		prefix string
+		path   = r.URL.Path
+	)
+	if strings.HasPrefix(path, apiPrefix+"/") {
+		prefix = apiPrefix
+		path = strings.TrimPrefix(path, apiPrefix)
+	}
+
+	s.mu.Lock()
+	request := fmt.Sprintf("%s %s", r.Method, path)
+	if r.URL.RawQuery != "" {
+		request += "?" + r.URL.RawQuery
+	}
+	s.requests = append(s.requests, request)
+	var failStatus int
+	if statuses := s.failures[path]; len(statuses) > 0 {
+		failStatus, s.failures[path] = statuses[0], statuses[1:]
+	}
+	if s.remaining > 0 && !strings.HasPrefix(path, downloadPrefix) && path != "/rate_limit" {
+		s.remaining--
+	}
+	remaining := s.remaining
+	s.mu.Unlock()
+
+	w.Header().Set("X-RateLimit-Limit", strconv.Itoa(rateLimit))
+	w.Header().Set("X-RateLimit-Remaining", strconv.Itoa(remaining))
+	w.Header().Set("X-RateLimit-Resource", "core")
+	w.Header().Set("X-RateLimit-Reset", strconv.FormatInt(time.Now().Add(time.Hour).Unix(), 10))
+	if failStatus != 0 {
+		writeError(w, failStatus, http.StatusText(failStatus))
+		return
+	}
+	if !s.authorized(r, path) {
+		writeError(w, http.StatusUnauthorized, "Bad credentials")
+		return
+	}
+
+	r = r.Clone(context.WithValue(r.Context(), prefixKey{}, prefix))
+	r.URL.Path = path
+	r.URL.RawPath = ""
+	s.mux.ServeHTTP(w, r)
+}
+
+// authorized checks that installation tokens are only used for the repos of the owner they were minted for
+func (s *Server) authorized(r *http.Request, path string) bool {
+	fields := strings.Fields(r.Header.Get("Authorization"))
+	if len(fields) == 0 || !strings.HasPrefix(fields[len(fields)-1], installationTokenPrefix) {
+		return true
+	}
+	segments := strings.Split(strings.Trim(path, "/"), "/")
+	if len(segments) < 2 || segments[0] != "repos" {
+		return true
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	installed, ok := s.installations[strings.ToLower(segments[1])]
+	return ok && fields[len(fields)-1] == InstallationToken(installed.id)
+}
+
+func (s *Server) handleFindInstallation(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	installed, ok := s.installations[strings.ToLower(r.PathValue("owner"))]
+	s.mu.Unlock()
+	if !ok || installed.org != strings.HasPrefix(r.URL.Path, "/orgs/") {
+		writeError(w, http.StatusNotFound, "Not Found")
+		return
+	}
+	accountType := "User"
+	if installed.org {
+		accountType = "Organization"
+	}
+	writeJSON(w, &github.Installation{
+		ID:      github.Ptr(installed.id),
+		Account: &github.User{Login: github.Ptr(installed.owner), Type: github.Ptr(accountType)},
+	})
+}
+
+func (s *Server) handleCreateInstallationToken(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil {
+		writeError(w, http.StatusNotFound, "Not Found")
+		return
+	}
+	s.mu.Lock()
+	found := false
+	for _, installed := range s.installations {
+		found = found || installed.id == id
+	}
+	s.mu.Unlock()
+	if !found {
+		writeError(w, http.StatusNotFound, "Not Found")
+		return
+	}
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(http.StatusCreated)
+	writeJSON(w, &github.InstallationToken{
+		Token:     github.Ptr(InstallationToken(id)),
+		ExpiresAt: &github.Timestamp{Time: time.Now().Add(time.Hour)},
+	})
+}
+
+func (s *Server) handleRateLimit(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	remaining := s.remaining
+	s.mu.Unlock()
+	rate := &github.Rate{Limit: rateLimit, Remaining: remaining, Reset: github.Timestamp{Time: time.Now().Add(time.Hour)}}
+	writeJSON(w, &github.RateLimits{Core: rate, Search: rate})
+}
+
+func (s *Server) handleListRuns(w http.ResponseWriter, r *http.Request) {
+	var (
+		query = r.URL.Query()
+		runs  = []*github.WorkflowRun{}
+	)
+	from, to, err := parseCreated(query.Get("created"))
+	if err != nil {
+		writeError(w, http.StatusUnprocessableEntity, err.Error())
+		return
+	}
+
+	s.mu.Lock()
+	for _, run := range s.runs[repoKey(r.PathValue("owner"), r.PathValue("repo"))] {
+		workflowRun := run.workflowRun()
+		switch {
+		case query.Get("head_sha") != "" && workflowRun.GetHeadSHA() != query.Get("head_sha"),
+			query.Get("branch") != "" && workflowRun.GetHeadBranch() != query.Get("branch"),
+			query.Get("event") != "" && workflowRun.GetEvent() != query.Get("event"),
+			query.Get("status") != "" && workflowRun.GetStatus() != query.Get("status") && workflowRun.GetConclusion() != query.Get("status"),
+			workflowRun.GetCreatedAt().Before(from),
+			!to.IsZero() && workflowRun.GetCreatedAt().After(to):
+			continue
+		}
+		runs = append(runs, workflowRun)
+	}
+	s.mu.Unlock()
+
+	// Newest first, like GitHub
+	sort.Slice(runs, func(i, j int) bool {
+		if !runs[i].GetCreatedAt().Equal(runs[j].GetCreatedAt()) {
+			return runs[i].GetCreatedAt().After(runs[j].GetCreatedAt().Time)
+		}
+		return runs[i].GetID() > runs[j].GetID()
+	})
+	start, end := s.paginate(w, r, len(runs))
+	writeJSON(w, &github.WorkflowRuns{TotalCount: github.Ptr(len(runs)), WorkflowRuns: runs[start:end]})
+}
+
+func (s *Server) handleGetRun(w http.ResponseWriter, r *http.Request) {
+	run, ok := s.run(r)
+	if !ok {
+		writeError(w, http.StatusNotFound, "Not Found")
+		return
+	}
+	writeJSON(w, run.workflowRun())
+}
+
+func (s *Server) handleListJobs(w http.ResponseWriter, r *http.Request) {
+	run, ok := s.run(r)
+	if !ok {
+		writeError(w, http.StatusNotFound, "Not Found")
+		return
+	}
+	s.mu.Lock()
+	jobs := make([]*github.WorkflowJob, 0, len(run.jobs))
+	for _, job := range run.jobs {
+		jobs = append(jobs, job.job)
+	}
+	s.mu.Unlock()
+
+	start, end := s.paginate(w, r, len(jobs))
+	writeJSON(w, &github.Jobs{TotalCount: github.Ptr(len(jobs)), Jobs: jobs[start:end]})
+}
+
+func (s *Server) handleUsage(w http.ResponseWriter, r *http.Request) {
+	run, ok := s.run(r)
+	if !ok || !run.billing {
+		writeError(w, http.StatusNotFound, "Not Found")
+		return
+	}
+	s.mu.Lock()
+	usage := run.usage()
+	s.mu.Unlock()
+	writeJSON(w, usage)
+}
+
+func (s *Server) handleListArtifacts(w http.ResponseWriter, r *http.Request) {
+	run, ok := s.run(r)
+	if !ok {
+		writeError(w, http.StatusNotFound, "Not Found")
+		return
+	}
+	s.mu.Lock()
+	artifacts := make([]*github.Artifact, 0, len(run.artifacts))
+	for _, artifact := range run.artifacts {
+		artifacts = append(artifacts, artifact.artifact)
+	}
+	s.mu.Unlock()
+
+	start, end := s.paginate(w, r, len(artifacts))
+	writeJSON(w, &github.ArtifactList{TotalCount: github.Ptr(int64(len(artifacts))), Artifacts: artifacts[start:end]})
+}
+
+// handleDownloadArtifact redirects to the artifact's contents, like GitHub redirects to blob storage
+func (s *Server) handleDownloadArtifact(w http.ResponseWriter, r *http.Request) {
+	if _, ok := s.artifact(r); !ok {
+		writeError(w, http.StatusNotFound, "Not Found")
+		return
+	}
+	http.Redirect(w, r, fmt.Sprintf("%s%s/artifacts/%s/%s/%s", s.URL, downloadPrefix, r.PathValue("owner"), r.PathValue("repo"), r.PathValue("id")), http.StatusFound)
+}
+
+func (s *Server) handleArtifactContent(w http.ResponseWriter, r *http.Request) {
+	artifact, ok := s.artifact(r)
+	if !ok {
+		writeError(w, http.StatusNotFound, "Not Found")
+		return
+	}
+	w.Header().Set("Content-Type", "application/zip")
+	_, _ = w.Write(artifact.content)
+}
+
+// handleJobLogs redirects to the job's logs, like GitHub redirects to blob storage
+func (s *Server) handleJobLogs(w http.ResponseWriter, r *http.Request) {
+	if _, ok := s.job(r); !ok {
+		writeError(w, http.StatusNotFound, "Not Found")
+		return
+	}
+	http.Redirect(w, r, fmt.Sprintf("%s%s/logs/%s/%s/%s", s.URL, downloadPrefix, r.PathValue("owner"), r.PathValue("repo"), r.PathValue("id")), http.StatusFound)
+}
+
+func (s *Server) handleLogsContent(w http.ResponseWriter, r *http.Request) {
+	job, ok := s.job(r)
+	if !ok {
+		writeError(w, http.StatusNotFound, "Not Found")
+		return
+	}
+	w.Header().Set("Content-Type", "text/plain")
+	_, _ = w.Write([]byte(job.logs))
+}
+
+func (s *Server) handleGetPullRequest(w http.ResponseWriter, r *http.Request) {
+	pullRequest, ok := s.pullRequest(r)
+	if !ok {
+		writeError(w, http.StatusNotFound, "Not Found")
+		return
+	}
+	writeJSON(w, pullRequest.pullRequest)
+}
+
+func (s *Server) handleListCommits(w http.ResponseWriter, r *http.Request) {
+	pullRequest, ok := s.pullRequest(r)
+	if !ok {
+		writeError(w, http.StatusNotFound, "Not Found")
+		return
+	}
+	commits := make([]*github.RepositoryCommit, 0, len(pullRequest.commits))
+	for _, sha := range pullRequest.commits {
+		commits = append(commits, &github.RepositoryCommit{SHA: github.Ptr(sha)})
+	}
+	start, end := s.paginate(w, r, len(commits))
+	writeJSON(w, commits[start:end])
+}
+
+// run finds the workflow run of a request
+func (s *Server) run(r *http.Request) (*RunFixture, bool) {
+	id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil {
+		return nil, false
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	run, ok := s.runs[repoKey(r.PathValue("owner"), r.PathValue("repo"))][id]
+	return run, ok
+}
+
+// job finds the job of a request in any of the repo's workflow runs
+func (s *Server) job(r *http.Request) (*JobFixture, bool) {
+	id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil {
+		return nil, false
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, run := range s.runs[repoKey(r.PathValue("owner"), r.PathValue("repo"))] {
+		for _, job := range run.jobs {
+			if job.job.GetID() == id {
+				return job, true
+			}
+		}
+	}
+	return nil, false
+}
+
+// artifact finds the artifact of a request in any of the repo's workflow runs
+func (s *Server) artifact(r *http.Request) (*artifactFixture, bool) {
+	id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil {
+		return nil, false
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, run := range s.runs[repoKey(r.PathValue("owner"), r.PathValue("repo"))] {
+		for _, artifact := range run.artifacts {
+			if artifact.artifact.GetID() == id {
+				return artifact, true
+			}
+		}
+	}
+	return nil, false
+}
+
+// pullRequest finds the pull request of a request
+func (s *Server) pullRequest(r *http.Request) (*PullRequestFixture, bool) {
+	number, err := strconv.Atoi(r.PathValue("number"))
+	if err != nil {
+		return nil, false
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	pullRequest, ok := s.pullRequests[repoKey(r.PathValue("owner"), r.PathValue("repo"))][number]
+	return pullRequest, ok
+}
+
+// paginate picks the page of a list to respond with, linking to the other pages like GitHub does
+func (s *Server) paginate(w http.ResponseWriter, r *http.Request, total int) (start, end int) {
+	query := r.URL.Query()
+	perPage, err := strconv.Atoi(query.Get("per_page"))
+	if err != nil || perPage <= 0 {
+		perPage = defaultPerPage
+	}
+	perPage = min(perPage, s.MaxPerPage)
+	page, err := strconv.Atoi(query.Get("page"))
+	if err != nil || page <= 0 {
+		page = 1
+	}
+	lastPage := max((total+perPage-1)/perPage, 1)
+
+	link := func(page int, rel string) string {
+		query.Set("page", strconv.Itoa(page))
+		prefix, _ := r.Context().Value(prefixKey{}).(string)
+		return fmt.Sprintf(`<%s%s%s?%s>; rel="%s"`, s.URL, prefix, r.URL.Path, query.Encode(), rel)
+	}
+	links := []string{}
+	if page < lastPage {
+		links = append(links, link(page+1, "next"), link(lastPage, "last"))
+	}
+	if page > 1 {
+		links = append(links, link(1, "first"), link(page-1, "prev"))
+	}
+	if len(links) > 0 {
+		w.Header().Set("Link", strings.Join(links, ", "))
+	}
+
+	start = min((page-1)*perPage, total)
+	return start, min(start+perPage, total)
+}
+
+// parseCreated parses the created filter of listing workflow runs, e.g. 2025-01-01T00:00:00Z..2025-02-01T00:00:00Z
+func parseCreated(created string) (from, to time.Time, err error) {
+	if created == "" {
+		return from, to, nil
+	}
+	fromValue, toValue, isRange := strings.Cut(created, "..")
+	if !isRange {
+		fromValue = strings.TrimPrefix(fromValue, ">=")
+	}
+	parse := func(value string) (time.Time, error) {
+		if t, err := time.Parse(time.RFC3339, value); err == nil {
+			return t, nil
+		}
+		return time.Parse(time.DateOnly, value)
+	}
+	if from, err = parse(fromValue); err != nil {
+		return from, to, fmt.Errorf("invalid created filter '%s': %w", created, err)
+	}
+	if isRange {
+		if to, err = parse(toValue); err != nil {
+			return from, to, fmt.Errorf("invalid created filter '%s': %w", created, err)
+		}
+	}
+	return from, to, nil
+}
+
+func repoKey(owner, repo string) string {
+	return url.PathEscape(owner) + "/" + url.PathEscape(repo)
+}
+
+func writeJSON(w http.ResponseWriter, body any) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	_ = json.NewEncoder(w).Encode(body)
+}
+
+func writeError(w http.ResponseWriter, status int, message string) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(map[string]string{
+		"message":           message,
+		"documentation_url": "https://docs.github.com/rest",
+	})
+}
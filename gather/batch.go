@@ -0,0 +1,273 @@
+package gather
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/google/go-github/v70/github"
+	"github.com/kalverra/workflow-metrics/transport"
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	// progressInterval is how often progress is logged while gathering many workflow runs
+	progressInterval = 10 * time.Second
+	// maxListResults is the most workflow runs GitHub returns for a single filtered list, no matter how many pages
+	maxListResults = 1000
+)
+
+// concurrency is how many workflow runs are gathered at once
+var concurrency = 4
+
+// SetConcurrency sets how many workflow runs are gathered at once when gathering many of them
+func SetConcurrency(workers int) {
+	concurrency = max(workers, 1)
+}
+
+// RunError is a workflow run that failed to gather
+type RunError struct {
+	WorkflowRunID int64
+	Err           error
+}
+
+func (e *RunError) Error() string {
+	return fmt.Sprintf("workflow run '%d': %s", e.WorkflowRunID, e.Err)
+}
+
+func (e *RunError) Unwrap() error {
+	return e.Err
+}
+
+// BatchError is the workflow runs of a batch that failed to gather, while the rest were gathered
+type BatchError struct {
+	// Total is how many workflow runs the batch gathered
+	Total int
+	// Failed are the workflow runs that failed, sorted by ID
+	Failed []*RunError
+}
+
+// Error summarizes how many workflow runs failed, and why
+func (e *BatchError) Error() string {
+	return fmt.Sprintf("failed to gather %d of %d workflow runs (%s)", len(e.Failed), e.Total, e.Summary())
+}
+
+// Unwrap allows checking the failures with errors.Is, e.g. for ErrRateLimited
+func (e *BatchError) Unwrap() []error {
+	errs := make([]error, 0, len(e.Failed))
+	for _, runErr := range e.Failed {
+		errs = append(errs, runErr)
+	}
+	return errs
+}
+
+// Summary counts the failures by reason, e.g. "2 in progress, 1 rate limited"
+func (e *BatchError) Summary() string {
+	counts := map[string]int{}
+	for _, runErr := range e.Failed {
+		counts[failureReason(runErr.Err)]++
+	}
+	reasons := make([]string, 0, len(counts))
+	for reason := range counts {
+		reasons = append(reasons, reason)
+	}
+	sort.Slice(reasons, func(i, j int) bool {
+		if counts[reasons[i]] != counts[reasons[j]] {
+			return counts[reasons[i]] > counts[reasons[j]]
+		}
+		return reasons[i] < reasons[j]
+	})
+	summary := make([]string, 0, len(reasons))
+	for _, reason := range reasons {
+		summary = append(summary, fmt.Sprintf("%d %s", counts[reason], reason))
+	}
+	return strings.Join(summary, ", ")
+}
+
+// failureReason describes why a workflow run failed to gather
+func failureReason(err error) string {
+	switch {
+	case errors.Is(err, ErrNotFound):
+		return "not found"
+	case errors.Is(err, ErrInProgress):
+		return "in progress"
+	case errors.Is(err, ErrRateLimited):
+		return "rate limited"
+	case errors.Is(err, errGitHubTimeout):
+		return "timed out"
+	case errors.Is(err, transport.ErrBudgetExhausted):
+		return "budget exhausted"
+	default:
+		return "other"
+	}
+}
+
+// gatherResult is the outcome of gathering a single workflow run of a batch
+type gatherResult struct {
+	index         int
+	workflowRunID int64
+	data          *WorkflowRunData
+	err           error
+}
+
+// WorkflowRuns gathers many workflow runs at once, with a pool of workers set by SetConcurrency.
+// Workflow runs that fail don't stop the others, the gathered workflow runs are returned in the order they were given
+// alongside a *BatchError for those that weren't.
+func WorkflowRuns(client *github.Client, owner, repo string, workflowRunIDs []int64, forceUpdate bool) ([]*WorkflowRunData, error) {
+	var (
+		startTime = time.Now()
+		uniqueIDs = make([]int64, 0, len(workflowRunIDs))
+		seen      = map[int64]bool{}
+	)
+	// Gathering the same workflow run twice at once would race to store it
+	for _, workflowRunID := range workflowRunIDs {
+		if !seen[workflowRunID] {
+			seen[workflowRunID] = true
+			uniqueIDs = append(uniqueIDs, workflowRunID)
+		}
+	}
+	if len(uniqueIDs) == 0 {
+		return nil, nil
+	}
+
+	workers := min(concurrency, len(uniqueIDs))
+	log.Info().
+		Int("workflow_run_count", len(uniqueIDs)).
+		Int("workers", workers).
+		Msg("Gathering workflow runs")
+
+	var (
+		indexes = make(chan int)
+		results = make(chan gatherResult)
+	)
+	for range workers {
+		go func() {
+			for i := range indexes {
+				data, err := WorkflowRun(client, owner, repo, uniqueIDs[i], forceUpdate)
+				results <- gatherResult{index: i, workflowRunID: uniqueIDs[i], data: data, err: err}
+			}
+		}()
+	}
+	go func() {
+		for i := range uniqueIDs {
+			indexes <- i
+		}
+		close(indexes)
+	}()
+
+	var (
+		gathered     = make([]*WorkflowRunData, len(uniqueIDs))
+		batchErr     = &BatchError{Total: len(uniqueIDs)}
+		lastProgress = time.Now()
+	)
+	for done := 1; done <= len(uniqueIDs); done++ {
+		result := <-results
+		if result.err != nil {
+			log.Warn().Err(result.err).Int64("workflow_run_id", result.workflowRunID).Msg("Failed to gather workflow run")
+			batchErr.Failed = append(batchErr.Failed, &RunError{WorkflowRunID: result.workflowRunID, Err: result.err})
+		} else {
+			gathered[result.index] = result.data
+		}
+
+		if time.Since(lastProgress) >= progressInterval && done < len(uniqueIDs) {
+			lastProgress = time.Now()
+			elapsed := time.Since(startTime)
+			log.Info().
+				Int("done", done).
+				Int("total", len(uniqueIDs)).
+				Int("failed", len(batchErr.Failed)).
+				Str("elapsed", elapsed.Round(time.Second).String()).
+				Str("remaining", (elapsed / time.Duration(done) * time.Duration(len(uniqueIDs)-done)).Round(time.Second).String()).
+				Msg("Gathering workflow runs")
+		}
+	}
+
+	workflowRuns := make([]*WorkflowRunData, 0, len(uniqueIDs))
+	for _, data := range gathered {
+		if data != nil {
+			workflowRuns = append(workflowRuns, data)
+		}
+	}
+
+	l := log.With().
+		Str("duration", time.Since(startTime).String()).
+		Int("gathered", len(workflowRuns)).
+		Int("failed", len(batchErr.Failed)).
+		Logger()
+	if len(batchErr.Failed) == 0 {
+		l.Info().Msg("Gathered workflow runs")
+		return workflowRuns, nil
+	}
+	sort.Slice(batchErr.Failed, func(i, j int) bool {
+		return batchErr.Failed[i].WorkflowRunID < batchErr.Failed[j].WorkflowRunID
+	})
+	l.Warn().Str("failures", batchErr.Summary()).Msg("Gathered workflow runs with failures")
+	return workflowRuns, batchErr
+}
+
+// WorkflowRunIDsCreated lists the IDs of all completed workflow runs created in a time range, oldest first, to backfill
+// them with WorkflowRuns
+func WorkflowRunIDsCreated(client *github.Client, owner, repo string, from, to time.Time) ([]int64, error) {
+	startTime := time.Now()
+	workflowRunIDs, err := listWorkflowRunIDsCreated(client, owner, repo, from, to)
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(workflowRunIDs, func(i, j int) bool { return workflowRunIDs[i] < workflowRunIDs[j] })
+	log.Debug().
+		Str("duration", time.Since(startTime).String()).
+		Time("from", from).
+		Time("to", to).
+		Int("workflow_run_count", len(workflowRunIDs)).
+		Msg("Listed workflow runs")
+	return workflowRunIDs, nil
+}
+
+// listWorkflowRunIDsCreated lists workflow runs created in a time range, splitting the range in half when it holds more
+// workflow runs than GitHub returns for a single list
+func listWorkflowRunIDsCreated(client *github.Client, owner, repo string, from, to time.Time) ([]int64, error) {
+	var (
+		workflowRunIDs = []int64{}
+		listOpts       = &github.ListWorkflowRunsOptions{
+			Created: fmt.Sprintf("%s..%s", from.UTC().Format(time.RFC3339), to.UTC().Format(time.RFC3339)),
+			ListOptions: github.ListOptions{
+				PerPage: 100,
+			},
+		}
+	)
+	if !gathersInProgress() {
+		listOpts.Status = "completed"
+	}
+
+	for { // Paginate through all workflow runs
+		workflowRuns, resp, err := callGitHub(func(ctx context.Context) (*github.WorkflowRuns, *github.Response, error) {
+			return client.Actions.ListRepositoryWorkflowRuns(ctx, owner, repo, listOpts)
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to list workflow runs created %s: %w", listOpts.Created, err)
+		}
+		if listOpts.Page == 0 && workflowRuns.GetTotalCount() > maxListResults && to.Sub(from) > time.Second {
+			mid := from.Add(to.Sub(from) / 2).Truncate(time.Second)
+			older, err := listWorkflowRunIDsCreated(client, owner, repo, from, mid)
+			if err != nil {
+				return nil, err
+			}
+			newer, err := listWorkflowRunIDsCreated(client, owner, repo, mid.Add(time.Second), to)
+			if err != nil {
+				return nil, err
+			}
+			return append(older, newer...), nil
+		}
+		for _, workflowRun := range workflowRuns.WorkflowRuns {
+			workflowRunIDs = append(workflowRunIDs, workflowRun.GetID())
+		}
+		if resp.NextPage == 0 {
+			break
+		}
+		listOpts.Page = resp.NextPage
+	}
+	return workflowRunIDs, nil
+}
@@ -0,0 +1,118 @@
+package gather
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand/v2"
+	"net"
+	"net/http"
+	"syscall"
+	"time"
+
+	"github.com/google/go-github/v70/github"
+	"github.com/rs/zerolog/log"
+)
+
+// Errors that gathering can fail with, wrapping the underlying GitHub API error
+var (
+	// ErrNotFound is returned when GitHub doesn't have the requested resource
+	ErrNotFound = errors.New("not found on GitHub")
+	// ErrInProgress is returned when a workflow run hasn't completed yet
+	ErrInProgress = errors.New("workflow run is still in progress")
+	// ErrBillingUnavailable is returned when GitHub has no billing data, e.g. on GitHub Enterprise Server
+	ErrBillingUnavailable = errors.New("billing data is unavailable")
+	// ErrRateLimited is returned when GitHub rate limits a call, even after retries
+	ErrRateLimited = errors.New("rate limited by GitHub")
+)
+
+const (
+	retryBaseDelay = time.Second
+	retryMaxDelay  = 30 * time.Second
+)
+
+// maxRetries is how many times a failed GitHub API call is retried
+var maxRetries = 3
+
+// SetTimeout sets how long a single GitHub API call can take before it's cancelled
+func SetTimeout(timeout time.Duration) {
+	timeoutDur = timeout
+}
+
+// SetRetries sets how many times a failed GitHub API call is retried
+func SetRetries(retries int) {
+	maxRetries = retries
+}
+
+// callGitHub makes a GitHub API call with a fresh timeout for each attempt, retrying server errors, secondary rate
+// limits, timeouts, and dropped connections with jittered exponential backoff
+func callGitHub[T any](call func(ctx context.Context) (T, *github.Response, error)) (T, *github.Response, error) {
+	for attempt := 0; ; attempt++ {
+		ctx, cancel := context.WithTimeoutCause(ghCtx, timeoutDur, errGitHubTimeout)
+		result, resp, err := call(ctx)
+		cancel()
+		if err == nil {
+			return result, resp, nil
+		}
+
+		err = classify(err)
+		delay, retry := retryDelay(err, attempt)
+		if !retry || attempt >= maxRetries {
+			return result, resp, err
+		}
+		log.Debug().
+			Err(err).
+			Int("attempt", attempt+1).
+			Int("max_retries", maxRetries).
+			Str("delay", delay.String()).
+			Msg("Retrying GitHub API call")
+		time.Sleep(delay)
+	}
+}
+
+// classify wraps a GitHub API error in the matching sentinel error
+func classify(err error) error {
+	var (
+		ghErr        *github.ErrorResponse
+		rateErr      *github.RateLimitError
+		abuseRateErr *github.AbuseRateLimitError
+	)
+	switch {
+	case errors.As(err, &rateErr), errors.As(err, &abuseRateErr):
+		return fmt.Errorf("%w: %w", ErrRateLimited, err)
+	case errors.As(err, &ghErr) && ghErr.Response != nil && ghErr.Response.StatusCode == http.StatusNotFound:
+		return fmt.Errorf("%w: %w", ErrNotFound, err)
+	case errors.Is(err, context.DeadlineExceeded) && !errors.Is(err, errGitHubTimeout):
+		return fmt.Errorf("%w after %s: %w", errGitHubTimeout, timeoutDur, err)
+	default:
+		return err
+	}
+}
+
+// retryDelay decides if a classified error is worth retrying, and how long to wait before the retry
+func retryDelay(err error, attempt int) (time.Duration, bool) {
+	var (
+		ghErr        *github.ErrorResponse
+		abuseRateErr *github.AbuseRateLimitError
+		netErr       net.Error
+	)
+	switch {
+	case errors.As(err, &abuseRateErr) && abuseRateErr.RetryAfter != nil:
+		return *abuseRateErr.RetryAfter, true
+	// Primary rate limits reset too far out to retry, and are waited out by the client's transport instead
+	case errors.As(err, &abuseRateErr),
+		errors.Is(err, errGitHubTimeout),
+		errors.As(err, &ghErr) && ghErr.Response != nil && ghErr.Response.StatusCode >= http.StatusInternalServerError,
+		errors.As(err, &netErr) && netErr.Timeout(),
+		errors.Is(err, syscall.ECONNRESET),
+		errors.Is(err, syscall.ECONNREFUSED),
+		errors.Is(err, io.ErrUnexpectedEOF):
+	default:
+		return 0, false
+	}
+
+	backoff := min(retryBaseDelay<<attempt, retryMaxDelay)
+	// Jitter spreads out the retries of calls that failed together
+	return backoff/2 + rand.N(backoff/2+1), true
+}
@@ -0,0 +1,113 @@
+package gather
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// Storage formats for gathered data
+const (
+	// StorageFormatJSON stores plain JSON, exactly as received from GitHub
+	StorageFormatJSON = "json"
+	// StorageFormatCompact stores zstd compressed JSON without the GitHub API URL fields
+	StorageFormatCompact = "compact"
+)
+
+var (
+	// storageFormat is the format new data is written in. Data in any format can always be read.
+	storageFormat = StorageFormatJSON
+
+	zstdMagic = []byte{0x28, 0xb5, 0x2f, 0xfd}
+	gzipMagic = []byte{0x1f, 0x8b}
+)
+
+// SetStorageFormat sets the format new data is written in
+func SetStorageFormat(format string) error {
+	switch format {
+	case StorageFormatJSON, StorageFormatCompact:
+		storageFormat = format
+		return nil
+	default:
+		return fmt.Errorf("unknown storage format '%s', must be one of %s or %s", format, StorageFormatJSON, StorageFormatCompact)
+	}
+}
+
+// compact converts JSON data to the configured storage format
+func compact(data []byte) ([]byte, error) {
+	if storageFormat == StorageFormatJSON {
+		return data, nil
+	}
+
+	var decoded any
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		return nil, err
+	}
+	trimmed, err := json.Marshal(trimURLs(decoded))
+	if err != nil {
+		return nil, err
+	}
+
+	encoder, err := zstd.NewWriter(nil, zstd.WithEncoderLevel(zstd.SpeedBetterCompression))
+	if err != nil {
+		return nil, err
+	}
+	defer encoder.Close()
+	return encoder.EncodeAll(trimmed, nil), nil
+}
+
+// expand converts data in any storage format back to JSON
+func expand(data []byte) ([]byte, error) {
+	switch {
+	case bytes.HasPrefix(data, zstdMagic):
+		decoder, err := zstd.NewReader(nil)
+		if err != nil {
+			return nil, err
+		}
+		defer decoder.Close()
+		return decoder.DecodeAll(data, nil)
+	case bytes.HasPrefix(data, gzipMagic):
+		reader, err := gzip.NewReader(bytes.NewReader(data))
+		if err != nil {
+			return nil, err
+		}
+		defer reader.Close()
+		return io.ReadAll(reader)
+	default:
+		return data, nil
+	}
+}
+
+// isStorageFormat checks if raw stored data is already in the configured storage format
+func isStorageFormat(data []byte) bool {
+	compressed := bytes.HasPrefix(data, zstdMagic) || bytes.HasPrefix(data, gzipMagic)
+	return compressed == (storageFormat == StorageFormatCompact)
+}
+
+// trimURLs removes the GitHub API URL fields from decoded JSON, which make up most of the stored data but can be
+// rebuilt from IDs. html_url is kept, as it's used to link to runs and jobs.
+func trimURLs(v any) any {
+	switch value := v.(type) {
+	case map[string]any:
+		for key, field := range value {
+			if key != "html_url" && (key == "url" || strings.HasSuffix(key, "_url")) {
+				delete(value, key)
+				continue
+			}
+			value[key] = trimURLs(field)
+		}
+		return value
+	case []any:
+		for i, item := range value {
+			value[i] = trimURLs(item)
+		}
+		return value
+	default:
+		return v
+	}
+}
@@ -6,15 +6,27 @@ import (
 	"time"
 
 	"github.com/google/go-github/v70/github"
+	"github.com/kalverra/workflow-metrics/store"
 )
 
-const (
+var (
+	// timeoutDur is how long a single GitHub API call can take
 	timeoutDur = 10 * time.Second
 
-	dataDir = "data"
-)
-
-var (
 	ghCtx            = context.WithValue(context.Background(), github.SleepUntilPrimaryRateLimitResetWhenRateLimited, true)
 	errGitHubTimeout = errors.New("github API timeout")
+
+	// dataStore is where gathered data is read from and written to
+	dataStore store.Store = store.NewFileSystem("data", "observe_output")
 )
+
+// APIContext returns a context for a single GitHub API call made outside of gathering, like commenting, with the same
+// timeout as gathering and waiting out primary rate limits
+func APIContext() (context.Context, context.CancelFunc) {
+	return context.WithTimeoutCause(ghCtx, timeoutDur, errGitHubTimeout)
+}
+
+// SetStore sets where gathered data is read from and written to
+func SetStore(s store.Store) {
+	dataStore = s
+}
@@ -0,0 +1,351 @@
+package gather_test
+
+import (
+	"archive/zip"
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/go-github/v70/github"
+	"github.com/kalverra/workflow-metrics/export"
+	"github.com/kalverra/workflow-metrics/fakegithub"
+	"github.com/kalverra/workflow-metrics/gather"
+	"github.com/kalverra/workflow-metrics/monitor"
+	"github.com/kalverra/workflow-metrics/observe"
+	"github.com/kalverra/workflow-metrics/store"
+	"github.com/kalverra/workflow-metrics/transport"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// testStore is shared by every test, which each gather into their own repo so they can run in parallel
+var testStore store.Store
+
+func TestMain(m *testing.M) {
+	zerolog.SetGlobalLevel(zerolog.Disabled)
+	dir, err := os.MkdirTemp("", "workflow-metrics-gather")
+	if err != nil {
+		panic(err)
+	}
+	testStore = store.NewFileSystem(filepath.Join(dir, "data"), filepath.Join(dir, "observe_output"))
+	gather.SetStore(testStore)
+	observe.SetStore(testStore)
+
+	code := m.Run()
+	_ = os.RemoveAll(dir)
+	os.Exit(code)
+}
+
+// countRequests counts the requests made to a path, with any query
+func countRequests(server *fakegithub.Server, request string) int {
+	count := 0
+	for _, made := range server.Requests() {
+		if made == request || strings.HasPrefix(made, request+"?") {
+			count++
+		}
+	}
+	return count
+}
+
+// testRun builds a workflow run with five jobs of different lengths and runners, more than a page of jobs with
+// MaxPerPage of 2
+func testRun(id int64) *fakegithub.RunFixture {
+	run := fakegithub.Run(id)
+	run.Job(id*10+1, "lint").Ran(90 * time.Second)
+	run.Job(id*10+2, "build").Runner("UBUNTU_4_CORE", "ubuntu-latest-4-cores").Ran(time.Minute)
+	run.Job(id*10+3, "test").Ran(3*time.Minute + time.Second).Conclusion("failure")
+	run.Job(id*10+4, "e2e").Ran(30 * time.Second)
+	run.Job(id*10+5, "deploy").Ran(time.Minute)
+	return run.Conclusion("failure")
+}
+
+func TestWorkflowRun(t *testing.T) {
+	t.Parallel()
+
+	const owner, repo = "kalverra", "gather-workflow-run"
+	server := fakegithub.New()
+	t.Cleanup(server.Close)
+	server.MaxPerPage = 2
+	server.AddRuns(owner, repo, testRun(1))
+	// A server error is retried
+	server.Fail("/repos/kalverra/gather-workflow-run/actions/runs/1/jobs", 502)
+
+	workflowRun, err := gather.WorkflowRun(server.Client(), owner, repo, 1, false)
+	require.NoError(t, err, "failed to gather workflow run")
+	assert.Equal(t, int64(1), workflowRun.GetID(), "wrong workflow run")
+	assert.False(t, workflowRun.Partial, "completed workflow run shouldn't be partial")
+	assert.Nil(t, workflowRun.MonitorObservations, "workflow run shouldn't have observations unless they're looked for")
+	assert.Zero(t, countRequests(server, "GET /repos/kalverra/gather-workflow-run/actions/runs/1/artifacts"),
+		"artifacts shouldn't be listed unless monitor artifacts are looked for")
+	assert.Equal(t, 4, countRequests(server, "GET /repos/kalverra/gather-workflow-run/actions/runs/1/jobs"),
+		"expected a retry of the failed first page, then the other 2 pages of jobs")
+
+	require.Len(t, workflowRun.Jobs, 5, "expected every page of jobs")
+	want := []struct {
+		name            string
+		runner          string
+		billableMinutes int64
+		cost            int64
+	}{
+		{"lint", "UBUNTU", 2, 16},
+		{"build", "UBUNTU_4_CORE", 1, 16},
+		{"test", "UBUNTU", 4, 32},
+		{"e2e", "UBUNTU", 1, 8},
+		{"deploy", "UBUNTU", 1, 8},
+	}
+	for i, job := range workflowRun.Jobs {
+		assert.Equal(t, want[i].name, job.GetName(), "jobs should be in the order they started")
+		assert.Equal(t, want[i].runner, job.Runner, "wrong runner for job %s", job.GetName())
+		assert.Equal(t, want[i].billableMinutes, job.GetBillableMinutes(), "wrong billable minutes for job %s", job.GetName())
+		assert.Equal(t, want[i].cost, job.Cost, "wrong cost for job %s", job.GetName())
+	}
+
+	requests := len(server.Requests())
+	stored, err := gather.WorkflowRun(server.Client(), owner, repo, 1, false)
+	require.NoError(t, err, "failed to read gathered workflow run")
+	assert.Len(t, server.Requests(), requests, "gathered workflow runs should be read from the store")
+	assert.Len(t, stored.Jobs, 5, "stored workflow run should have every job")
+}
+
+func TestWorkflowRunWithoutBilling(t *testing.T) {
+	t.Parallel()
+
+	const owner, repo = "kalverra", "gather-without-billing"
+	server := fakegithub.New()
+	t.Cleanup(server.Close)
+	server.AddRuns(owner, repo, testRun(1).WithoutBilling())
+
+	workflowRun, err := gather.WorkflowRun(server.Client(), owner, repo, 1, false)
+	require.NoError(t, err, "workflow runs without billing data should still be gathered")
+	require.Len(t, workflowRun.Jobs, 5, "expected every job")
+	for _, job := range workflowRun.Jobs {
+		assert.Equal(t, gather.UnknownRunner, job.Runner, "jobs without billing data should have an unknown runner")
+		assert.Zero(t, job.Cost, "jobs without billing data shouldn't have a cost")
+	}
+}
+
+func TestWorkflowRunErrors(t *testing.T) {
+	t.Parallel()
+
+	const owner, repo = "kalverra", "gather-errors"
+	server := fakegithub.New()
+	t.Cleanup(server.Close)
+	inProgress := fakegithub.Run(2)
+	inProgress.Job(21, "build").InProgress()
+	server.AddRuns(owner, repo, inProgress.InProgress())
+
+	_, err := gather.WorkflowRun(server.Client(), owner, repo, 1, false)
+	require.ErrorIs(t, err, gather.ErrNotFound, "expected missing workflow run to not be found")
+	_, err = gather.WorkflowRun(server.Client(), owner, repo, 2, false)
+	require.ErrorIs(t, err, gather.ErrInProgress, "expected in-progress workflow run to fail without waiting or partial")
+}
+
+// Partial is set for the whole package, so this can't run in parallel with the other tests
+//
+//nolint:paralleltest
+func TestWorkflowRunPartialSnapshot(t *testing.T) {
+	gather.SetPartial(true)
+	t.Cleanup(func() { gather.SetPartial(false) })
+
+	const owner, repo = "kalverra", "gather-partial"
+	server := fakegithub.New()
+	t.Cleanup(server.Close)
+	inProgress := fakegithub.Run(1)
+	inProgress.Job(11, "build")
+	inProgress.Job(12, "test").InProgress()
+	server.AddRuns(owner, repo, inProgress.InProgress())
+
+	for attempt := 1; attempt <= 2; attempt++ {
+		workflowRun, err := gather.WorkflowRun(server.Client(), owner, repo, 1, false)
+		require.NoError(t, err, "failed to snapshot in-progress workflow run on attempt %d", attempt)
+		require.NotNil(t, workflowRun, "expected a snapshot on attempt %d", attempt)
+		assert.True(t, workflowRun.Partial, "in-progress workflow run should be partial on attempt %d", attempt)
+		assert.Len(t, workflowRun.Jobs, 2, "snapshot should have the jobs so far on attempt %d", attempt)
+	}
+	assert.Equal(t, 2, countRequests(server, "GET /repos/kalverra/gather-partial/actions/runs/1"),
+		"partial snapshots should be refetched")
+
+	server.AddRuns(owner, repo, testRun(1))
+	workflowRun, err := gather.WorkflowRun(server.Client(), owner, repo, 1, false)
+	require.NoError(t, err, "failed to gather completed workflow run")
+	assert.False(t, workflowRun.Partial, "completed workflow run should replace the partial snapshot")
+	assert.Len(t, workflowRun.Jobs, 5, "completed workflow run should have every job")
+}
+
+//nolint:paralleltest // Sets whether monitor artifacts are looked for, which every gather reads
+func TestWorkflowRunMonitorObservations(t *testing.T) {
+	gather.SetMonitorArtifacts(true)
+	t.Cleanup(func() { gather.SetMonitorArtifacts(false) })
+
+	const owner, repo = "kalverra", "gather-monitor"
+	sampled := time.Date(2025, time.January, 1, 12, 0, 30, 0, time.UTC)
+	observations := &monitor.Observations{Samples: []monitor.Sample{
+		{Time: sampled, Process: "go", PID: 42, CPUPercent: 97.5, MemPercent: 12.5},
+	}}
+	server := fakegithub.New()
+	t.Cleanup(server.Close)
+	server.MaxPerPage = 1
+	server.AddRuns(owner, repo, testRun(1).
+		Artifact(100, "coverage", []byte("not the monitor")).
+		Artifact(101, monitor.ArtifactName, monitorArtifact(t, observations)),
+	)
+
+	workflowRun, err := gather.WorkflowRun(server.Client(), owner, repo, 1, false)
+	require.NoError(t, err, "failed to gather workflow run")
+	require.NotNil(t, workflowRun.MonitorObservations, "expected observations from the monitor artifact")
+	assert.Equal(t, observations.Samples, workflowRun.MonitorObservations.Samples, "wrong monitor samples")
+}
+
+// monitorArtifact zips observations like the monitor command's artifact
+func monitorArtifact(t *testing.T, observations *monitor.Observations) []byte {
+	t.Helper()
+
+	var buf bytes.Buffer
+	zipWriter := zip.NewWriter(&buf)
+	file, err := zipWriter.Create(monitor.FileName)
+	require.NoError(t, err, "failed to create monitor file in artifact")
+	require.NoError(t, json.NewEncoder(file).Encode(observations), "failed to write monitor file")
+	require.NoError(t, zipWriter.Close(), "failed to zip artifact")
+	return buf.Bytes()
+}
+
+func TestWorkflowRuns(t *testing.T) {
+	t.Parallel()
+
+	const owner, repo = "kalverra", "gather-workflow-runs"
+	server := fakegithub.New()
+	t.Cleanup(server.Close)
+	server.AddRuns(owner, repo, testRun(1), testRun(2), testRun(3))
+
+	workflowRuns, err := gather.WorkflowRuns(server.Client(), owner, repo, []int64{3, 1, 404, 3}, false)
+	var batchErr *gather.BatchError
+	require.ErrorAs(t, err, &batchErr, "expected a batch error for the missing workflow run")
+	assert.Equal(t, 3, batchErr.Total, "duplicate workflow runs should only be gathered once")
+	require.Len(t, batchErr.Failed, 1, "expected only the missing workflow run to fail")
+	assert.Equal(t, int64(404), batchErr.Failed[0].WorkflowRunID, "wrong failed workflow run")
+	require.ErrorIs(t, err, gather.ErrNotFound, "expected the failure to be not found")
+
+	require.Len(t, workflowRuns, 2, "expected the other workflow runs to be gathered")
+	assert.Equal(t, int64(3), workflowRuns[0].GetID(), "workflow runs should be in the order they were given")
+	assert.Equal(t, int64(1), workflowRuns[1].GetID(), "workflow runs should be in the order they were given")
+}
+
+func TestWorkflowRunsBudgetExhausted(t *testing.T) {
+	t.Parallel()
+
+	const owner, repo = "kalverra", "gather-budget-exhausted"
+	server := fakegithub.New()
+	t.Cleanup(server.Close)
+	server.AddRuns(owner, repo, testRun(1))
+	client, err := github.NewClient(&http.Client{Transport: transport.NewBudget(nil, 1, 0)}).
+		WithEnterpriseURLs(server.URL, server.URL)
+	require.NoError(t, err, "failed to create budgeted client")
+
+	_, err = gather.WorkflowRuns(client, owner, repo, []int64{1}, false)
+	var batchErr *gather.BatchError
+	require.ErrorAs(t, err, &batchErr, "expected a batch error once the budget is spent")
+	require.ErrorIs(t, err, transport.ErrBudgetExhausted, "expected the failure to be the budget")
+	assert.Equal(t, "1 budget exhausted", batchErr.Summary(), "wrong failure reason")
+}
+
+func TestPullRequest(t *testing.T) {
+	t.Parallel()
+
+	const owner, repo = "kalverra", "gather-pull-request"
+	server := fakegithub.New()
+	t.Cleanup(server.Close)
+	first, second, other := testRun(1), testRun(2), testRun(3)
+	server.AddRuns(owner, repo, first, second, other)
+	server.AddPullRequests(owner, repo, fakegithub.PullRequest(7).Commits(first, second))
+
+	pullRequest, err := gather.PullRequest(server.Client(), owner, repo, 7, false)
+	require.NoError(t, err, "failed to gather pull request")
+	assert.Equal(t, []int64{1, 2}, pullRequest.WorkflowRunIDs, "expected the workflow runs of the pull request's commits")
+	require.Len(t, pullRequest.WorkflowRuns, 2, "expected the workflow runs to be gathered")
+	for _, workflowRun := range pullRequest.WorkflowRuns {
+		assert.Equal(t, "pull_request", workflowRun.GetEvent(), "wrong event for workflow run %d", workflowRun.GetID())
+		assert.Len(t, workflowRun.Jobs, 5, "expected every job of workflow run %d", workflowRun.GetID())
+	}
+
+	requests := len(server.Requests())
+	stored, err := gather.PullRequest(server.Client(), owner, repo, 7, false)
+	require.NoError(t, err, "failed to read gathered pull request")
+	assert.Len(t, server.Requests(), requests, "closed pull requests should be read from the store")
+	assert.Equal(t, pullRequest.WorkflowRunIDs, stored.WorkflowRunIDs, "stored pull request should have the same workflow runs")
+}
+
+func TestObserveAndExport(t *testing.T) {
+	t.Parallel()
+
+	const owner, repo = "kalverra", "observe-and-export"
+	server := fakegithub.New()
+	t.Cleanup(server.Close)
+	server.AddRuns(owner, repo, testRun(1), testRun(2).Created(fakegithub.BaseTime.Add(24*time.Hour)))
+	_, err := gather.WorkflowRuns(server.Client(), owner, repo, []int64{1, 2}, false)
+	require.NoError(t, err, "failed to gather workflow runs")
+
+	require.NoError(t, observe.WorkflowRun(server.Client(), owner, repo, 1, []string{"md", "csv"}), "failed to observe workflow run")
+	md, err := testStore.Get(owner, repo, store.Observations, "workflow_run_1.md")
+	require.NoError(t, err, "failed to read markdown observation")
+	assert.True(t, strings.HasPrefix(string(md), "```mermaid\n"), "markdown should be a mermaid chart")
+	for _, job := range []string{"lint", "build", "test", "e2e", "deploy"} {
+		assert.Contains(t, string(md), job, "chart should have job %s", job)
+	}
+
+	csv, err := testStore.Get(owner, repo, store.Observations, "workflow_run_1.csv")
+	require.NoError(t, err, "failed to read csv observation")
+	lines := strings.Split(strings.TrimSpace(string(csv)), "\n")
+	require.Len(t, lines, 6, "expected a header and a row per job")
+	assert.Equal(t,
+		"run_id,workflow,branch,event,job,runner,queued_at,started_at,completed_at,duration_seconds,billable_minutes,cost_usd,conclusion",
+		lines[0], "wrong csv header",
+	)
+	assert.Equal(t,
+		"1,CI,main,push,lint,UBUNTU,2025-01-01T12:00:00Z,2025-01-01T12:00:00Z,2025-01-01T12:01:30Z,90,2,0.016,success",
+		lines[1], "wrong csv row for lint",
+	)
+
+	exportDir := t.TempDir()
+	require.NoError(t, export.WorkflowRuns(owner, repo, exportDir, export.FormatNDJSON), "failed to export ndjson")
+	partition := filepath.Join("repo="+owner+"__"+repo, "date=2025-01-01")
+	runs := readNDJSON[export.RunRow](t, filepath.Join(exportDir, "runs", partition, "part-0.ndjson"))
+	require.Len(t, runs, 1, "expected a single run on the first day")
+	assert.Equal(t, int64(1), runs[0].ID, "wrong run")
+	assert.Equal(t, int64(5), runs[0].JobCount, "wrong job count")
+	assert.Equal(t, int64(80), runs[0].Cost, "run cost should be the sum of its jobs")
+	jobs := readNDJSON[export.JobRow](t, filepath.Join(exportDir, "jobs", partition, "part-0.ndjson"))
+	assert.Len(t, jobs, 5, "expected a row per job")
+	_, err = os.Stat(filepath.Join(exportDir, "runs", "repo="+owner+"__"+repo, "date=2025-01-02", "part-0.ndjson"))
+	require.NoError(t, err, "expected the second run in the next day's partition")
+
+	require.NoError(t, export.WorkflowRuns(owner, repo, exportDir, export.FormatParquet), "failed to export parquet")
+	info, err := os.Stat(filepath.Join(exportDir, "jobs", partition, "part-0.parquet"))
+	require.NoError(t, err, "expected a parquet file")
+	assert.Positive(t, info.Size(), "parquet file shouldn't be empty")
+}
+
+// readNDJSON reads every row of an exported NDJSON file
+func readNDJSON[T any](t *testing.T, file string) []T {
+	t.Helper()
+
+	f, err := os.Open(file)
+	require.NoError(t, err, "failed to open '%s'", file)
+	defer f.Close()
+
+	var rows []T
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var row T
+		require.NoError(t, json.Unmarshal(scanner.Bytes(), &row), "failed to decode row of '%s'", file)
+		rows = append(rows, row)
+	}
+	require.NoError(t, scanner.Err(), "failed to read '%s'", file)
+	return rows
+}
@@ -0,0 +1,122 @@
+package gather
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/google/go-github/v70/github"
+	"github.com/kalverra/workflow-metrics/store"
+	"github.com/rs/zerolog/log"
+)
+
+// jobEventsLock serializes recording job events, which read, append to, and rewrite a workflow run's events
+var jobEventsLock sync.Mutex
+
+// JobTransition is a job's status change, as received live from a workflow_job webhook
+type JobTransition struct {
+	// Status is the job's new status, e.g. "queued", "in_progress", or "completed"
+	Status string `json:"status"`
+	// ReceivedAt is when the webhook was received, which is more precise than the job's REST timestamps
+	ReceivedAt      time.Time `json:"received_at"`
+	RunnerName      string    `json:"runner_name,omitempty"`
+	RunnerGroupName string    `json:"runner_group_name,omitempty"`
+	Labels          []string  `json:"labels,omitempty"`
+}
+
+// JobEvent is a transition of a single job in a workflow run
+type JobEvent struct {
+	JobID   int64  `json:"job_id"`
+	JobName string `json:"job_name"`
+	JobTransition
+}
+
+// RecordJobEvent stores a job's status change from a workflow_job webhook, received at receivedAt
+func RecordJobEvent(owner, repo string, job *github.WorkflowJob, receivedAt time.Time) error {
+	jobEventsLock.Lock()
+	defer jobEventsLock.Unlock()
+
+	name := fmt.Sprintf("%d.json", job.GetRunID())
+	events, err := readJobEvents(owner, repo, job.GetRunID())
+	if err != nil && !errors.Is(err, store.ErrNotFound) {
+		return err
+	}
+	events = append(events, &JobEvent{
+		JobID:   job.GetID(),
+		JobName: job.GetName(),
+		JobTransition: JobTransition{
+			Status:          job.GetStatus(),
+			ReceivedAt:      receivedAt.UTC(),
+			RunnerName:      job.GetRunnerName(),
+			RunnerGroupName: job.GetRunnerGroupName(),
+			Labels:          job.Labels,
+		},
+	})
+
+	data, err := encode(events)
+	if err != nil {
+		return fmt.Errorf("failed to marshal job events for workflow run '%d': %w", job.GetRunID(), err)
+	}
+	err = dataStore.Put(owner, repo, store.JobEvents, name, data)
+	if err != nil {
+		return fmt.Errorf("failed to store job events for workflow run '%d': %w", job.GetRunID(), err)
+	}
+	log.Debug().
+		Int64("workflow_run_id", job.GetRunID()).
+		Int64("job_id", job.GetID()).
+		Str("status", job.GetStatus()).
+		Msg("Recorded job event")
+	return nil
+}
+
+// readJobEvents reads the recorded job events of a workflow run
+func readJobEvents(owner, repo string, workflowRunID int64) ([]*JobEvent, error) {
+	name := fmt.Sprintf("%d.json", workflowRunID)
+	raw, err := dataStore.Get(owner, repo, store.JobEvents, name)
+	if err != nil {
+		return nil, err
+	}
+	events := []*JobEvent{}
+	err = decode(store.JobEvents, raw, &events)
+	if err != nil {
+		return nil, fmt.Errorf("failed to unmarshal job events '%s': %w", dataStore.Location(owner, repo, store.JobEvents, name), err)
+	}
+	return events, nil
+}
+
+// mergeJobEvents attaches recorded job events to the jobs of a workflow run, filling in the runner of jobs that
+// the API didn't report one for
+func mergeJobEvents(owner, repo string, workflowRunData *WorkflowRunData) error {
+	events, err := readJobEvents(owner, repo, workflowRunData.GetID())
+	if errors.Is(err, store.ErrNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	transitionsByJob := map[int64][]JobTransition{}
+	for _, event := range events {
+		transitionsByJob[event.JobID] = append(transitionsByJob[event.JobID], event.JobTransition)
+	}
+	for _, job := range workflowRunData.Jobs {
+		transitions := transitionsByJob[job.GetID()]
+		sort.SliceStable(transitions, func(i, j int) bool {
+			return transitions[i].ReceivedAt.Before(transitions[j].ReceivedAt)
+		})
+		job.Transitions = transitions
+		for _, transition := range transitions {
+			if job.GetRunnerName() == "" && transition.RunnerName != "" {
+				job.RunnerName = github.Ptr(transition.RunnerName)
+				job.RunnerGroupName = github.Ptr(transition.RunnerGroupName)
+			}
+		}
+	}
+	log.Debug().
+		Int64("workflow_run_id", workflowRunData.GetID()).
+		Int("job_event_count", len(events)).
+		Msg("Merged job events")
+	return nil
+}
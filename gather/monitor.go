@@ -0,0 +1,103 @@
+package gather
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+
+	"github.com/google/go-github/v70/github"
+	"github.com/kalverra/workflow-metrics/monitor"
+)
+
+// maxMonitorArtifactSize caps how much of a monitor artifact is downloaded
+const maxMonitorArtifactSize = 100 << 20
+
+// monitorArtifacts is whether workflow runs' monitor artifacts are looked for, which costs an API call per workflow run
+var monitorArtifacts bool
+
+// SetMonitorArtifacts sets whether to attach the observations of the monitor command from workflow runs' artifacts
+func SetMonitorArtifacts(m bool) {
+	monitorArtifacts = m
+}
+
+// monitorObservations reads the observations of the monitor command from the workflow run's monitor artifact, or
+// returns nil if the workflow run didn't upload one
+func monitorObservations(client *github.Client, owner, repo string, workflowRunID int64) (*monitor.Observations, error) {
+	var (
+		artifact *github.Artifact
+		listOpts = &github.ListOptions{PerPage: 100}
+	)
+	for artifact == nil { // Paginate through all artifacts looking for the monitor's
+		artifacts, resp, err := callGitHub(func(ctx context.Context) (*github.ArtifactList, *github.Response, error) {
+			return client.Actions.ListWorkflowRunArtifacts(ctx, owner, repo, workflowRunID, listOpts)
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to list artifacts: %w", err)
+		}
+		for _, a := range artifacts.Artifacts {
+			if a.GetName() == monitor.ArtifactName && !a.GetExpired() {
+				artifact = a
+				break
+			}
+		}
+		if resp.NextPage == 0 {
+			break
+		}
+		listOpts.Page = resp.NextPage
+	}
+	if artifact == nil {
+		return nil, nil
+	}
+
+	downloadURL, _, err := callGitHub(func(ctx context.Context) (string, *github.Response, error) {
+		u, resp, err := client.Actions.DownloadArtifact(ctx, owner, repo, artifact.GetID(), 1)
+		if err != nil {
+			return "", resp, err
+		}
+		return u.String(), resp, nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get download URL of artifact '%d': %w", artifact.GetID(), err)
+	}
+
+	// Downloaded with the client's transport, so it's recorded, replayed, and counted like API calls. The client's
+	// transport only sends credentials to the GitHub API, not to the pre-signed blob storage URL.
+	ctx, cancel := context.WithTimeoutCause(ghCtx, timeoutDur, errGitHubTimeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, downloadURL, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create artifact download request: %w", err)
+	}
+	resp, err := client.Client().Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to download artifact '%d': %w", artifact.GetID(), err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("failed to download artifact '%d': %s", artifact.GetID(), resp.Status)
+	}
+	archive, err := io.ReadAll(io.LimitReader(resp.Body, maxMonitorArtifactSize))
+	if err != nil {
+		return nil, fmt.Errorf("failed to download artifact '%d': %w", artifact.GetID(), err)
+	}
+
+	zipReader, err := zip.NewReader(bytes.NewReader(archive), int64(len(archive)))
+	if err != nil {
+		return nil, fmt.Errorf("failed to unzip artifact '%d': %w", artifact.GetID(), err)
+	}
+	file, err := zipReader.Open(monitor.FileName)
+	if err != nil {
+		return nil, fmt.Errorf("failed to find '%s' in artifact '%d': %w", monitor.FileName, artifact.GetID(), err)
+	}
+	defer file.Close()
+
+	observations := &monitor.Observations{}
+	if err := json.NewDecoder(file).Decode(observations); err != nil {
+		return nil, fmt.Errorf("failed to decode '%s' in artifact '%d': %w", monitor.FileName, artifact.GetID(), err)
+	}
+	return observations, nil
+}
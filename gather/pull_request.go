@@ -0,0 +1,172 @@
+package gather
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/google/go-github/v70/github"
+	"github.com/kalverra/workflow-metrics/store"
+	"github.com/rs/zerolog/log"
+)
+
+// PullRequestData wraps standard GitHub PullRequest data with the workflow runs that ran for its commits
+type PullRequestData struct {
+	*github.PullRequest
+	// WorkflowRunIDs are the IDs of all completed workflow runs for any commit of the pull request
+	WorkflowRunIDs []int64 `json:"workflow_run_ids"`
+	// WorkflowRuns are the gathered workflow runs, stored separately in the workflow runs data dir
+	WorkflowRuns []*WorkflowRunData `json:"-"`
+}
+
+// PullRequest gathers all completed workflow runs for every commit of a pull request.
+// Open pull requests are always refreshed from GitHub, as they may have gained new commits or runs.
+// Workflow runs that fail to gather don't stop the others, the pull request data is returned with the workflow runs
+// that were gathered alongside an error for those that weren't.
+func PullRequest(client *github.Client, owner, repo string, pullRequestNumber int, forceUpdate bool) (*PullRequestData, error) {
+	var (
+		pullRequestData = &PullRequestData{}
+		targetName      = fmt.Sprintf("%d.json", pullRequestNumber)
+	)
+
+	startTime := time.Now()
+	log.Info().Int("pull_request_number", pullRequestNumber).Msg("Gathering pull request data")
+
+	if !forceUpdate {
+		location := dataStore.Location(owner, repo, store.PullRequests, targetName)
+		pullRequestBytes, err := dataStore.Get(owner, repo, store.PullRequests, targetName)
+		if err != nil && !errors.Is(err, store.ErrNotFound) {
+			return nil, fmt.Errorf("failed to read pull request '%s': %w", location, err)
+		}
+		if err == nil {
+			log.Debug().Str("location", location).Int("pull_request_number", pullRequestNumber).Msg("Reading pull request data from store")
+			err = decode(store.PullRequests, pullRequestBytes, pullRequestData)
+			if err != nil {
+				return nil, fmt.Errorf("failed to unmarshal pull request '%s': %w", location, err)
+			}
+		}
+	}
+
+	if pullRequestData.PullRequest == nil || pullRequestData.GetState() != "closed" {
+		log.Debug().Int("pull_request_number", pullRequestNumber).Msg("Fetching pull request data from GitHub")
+		var err error
+		pullRequestData, err = fetchPullRequest(client, owner, repo, pullRequestNumber)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	workflowRuns, runErr := WorkflowRuns(client, owner, repo, pullRequestData.WorkflowRunIDs, forceUpdate)
+	pullRequestData.WorkflowRuns = workflowRuns
+	if runErr != nil {
+		runErr = fmt.Errorf("failed to gather workflow runs for pull request '%d': %w", pullRequestNumber, runErr)
+	}
+
+	data, err := encode(pullRequestData)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal pull request data to json for pull request '%d': %w", pullRequestNumber, err)
+	}
+	err = dataStore.Put(owner, repo, store.PullRequests, targetName, data)
+	if err != nil {
+		return nil, fmt.Errorf("failed to store pull request data for pull request '%d': %w", pullRequestNumber, err)
+	}
+
+	log.Info().
+		Str("duration", time.Since(startTime).String()).
+		Int("pull_request_number", pullRequestNumber).
+		Int("workflow_run_count", len(pullRequestData.WorkflowRuns)).
+		Msg("Gathered pull request data")
+	return pullRequestData, runErr
+}
+
+// fetchPullRequest fetches a pull request and the IDs of all completed workflow runs for its commits from GitHub
+func fetchPullRequest(client *github.Client, owner, repo string, pullRequestNumber int) (*PullRequestData, error) {
+	pullRequest, _, err := callGitHub(func(ctx context.Context) (*github.PullRequest, *github.Response, error) {
+		return client.PullRequests.Get(ctx, owner, repo, pullRequestNumber)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get pull request '%d': %w", pullRequestNumber, err)
+	}
+
+	commitSHAs, err := pullRequestCommits(client, owner, repo, pullRequestNumber)
+	if err != nil {
+		return nil, err
+	}
+
+	pullRequestData := &PullRequestData{PullRequest: pullRequest}
+	for _, sha := range commitSHAs {
+		workflowRunIDs, err := completedWorkflowRunIDs(client, owner, repo, sha)
+		if err != nil {
+			return nil, err
+		}
+		pullRequestData.WorkflowRunIDs = append(pullRequestData.WorkflowRunIDs, workflowRunIDs...)
+	}
+	sort.Slice(pullRequestData.WorkflowRunIDs, func(i, j int) bool {
+		return pullRequestData.WorkflowRunIDs[i] < pullRequestData.WorkflowRunIDs[j]
+	})
+	return pullRequestData, nil
+}
+
+// pullRequestCommits fetches the SHAs of all commits in a pull request
+func pullRequestCommits(client *github.Client, owner, repo string, pullRequestNumber int) ([]string, error) {
+	var (
+		shas     = []string{}
+		listOpts = &github.ListOptions{PerPage: 100}
+	)
+
+	for { // Paginate through all commits
+		commits, resp, err := callGitHub(func(ctx context.Context) ([]*github.RepositoryCommit, *github.Response, error) {
+			return client.PullRequests.ListCommits(ctx, owner, repo, pullRequestNumber, listOpts)
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to list commits for pull request '%d': %w", pullRequestNumber, err)
+		}
+		for _, commit := range commits {
+			shas = append(shas, commit.GetSHA())
+		}
+		if resp.NextPage == 0 {
+			break
+		}
+		listOpts.Page = resp.NextPage
+	}
+	return shas, nil
+}
+
+// completedWorkflowRunIDs fetches the IDs of all completed workflow runs for a commit
+func completedWorkflowRunIDs(client *github.Client, owner, repo, sha string) ([]int64, error) {
+	var (
+		workflowRunIDs = []int64{}
+		listOpts       = &github.ListWorkflowRunsOptions{
+			HeadSHA: sha,
+			ListOptions: github.ListOptions{
+				PerPage: 100,
+			},
+		}
+	)
+
+	for { // Paginate through all workflow runs
+		workflowRuns, resp, err := callGitHub(func(ctx context.Context) (*github.WorkflowRuns, *github.Response, error) {
+			return client.Actions.ListRepositoryWorkflowRuns(ctx, owner, repo, listOpts)
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to list workflow runs for commit '%s': %w", sha, err)
+		}
+		for _, workflowRun := range workflowRuns.WorkflowRuns {
+			if workflowRun.GetStatus() != "completed" && !gathersInProgress() {
+				log.Warn().
+					Int64("workflow_run_id", workflowRun.GetID()).
+					Str("head_sha", sha).
+					Msg("Skipping workflow run that is still in progress")
+				continue
+			}
+			workflowRunIDs = append(workflowRunIDs, workflowRun.GetID())
+		}
+		if resp.NextPage == 0 {
+			break
+		}
+		listOpts.Page = resp.NextPage
+	}
+	return workflowRunIDs, nil
+}
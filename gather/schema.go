@@ -0,0 +1,178 @@
+package gather
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"time"
+
+	"github.com/kalverra/workflow-metrics/store"
+	"github.com/rs/zerolog/log"
+)
+
+// SchemaVersion is the version of the on-disk format written by this version of workflow-metrics.
+// Bump it and add a migration to every kind in migrations whenever stored data changes shape.
+const SchemaVersion = 1
+
+// envelope wraps stored data with the schema version it was written with
+type envelope struct {
+	SchemaVersion int             `json:"schema_version"`
+	Data          json.RawMessage `json:"data"`
+}
+
+// migration upgrades stored data by a single schema version
+type migration func(data json.RawMessage) (json.RawMessage, error)
+
+// migrations for each kind of stored data. migrations[kind][i] upgrades data from version i to version i+1.
+var migrations = map[store.Kind][]migration{
+	store.WorkflowRuns: {
+		migrateUnversioned,
+	},
+	store.PullRequests: {
+		migrateUnversioned,
+	},
+	store.JobEvents: {
+		migrateUnversioned,
+	},
+}
+
+// migrateUnversioned upgrades data written before schema versions existed. The data itself didn't change,
+// it only gains an envelope.
+func migrateUnversioned(data json.RawMessage) (json.RawMessage, error) {
+	return data, nil
+}
+
+// encode wraps data in an envelope of the current schema version, in the configured storage format
+func encode(v any) ([]byte, error) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	return encodeRaw(data)
+}
+
+// encodeRaw wraps already marshalled data in an envelope of the current schema version, in the configured
+// storage format
+func encodeRaw(data json.RawMessage) ([]byte, error) {
+	wrapped, err := json.Marshal(envelope{SchemaVersion: SchemaVersion, Data: data})
+	if err != nil {
+		return nil, err
+	}
+	return compact(wrapped)
+}
+
+// decode unwraps stored data, upgrading it to the current schema version if needed
+func decode(kind store.Kind, raw []byte, v any) error {
+	data, _, err := migrate(kind, raw)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, v)
+}
+
+// migrate upgrades raw stored data to the current schema version, returning the unwrapped data and the version
+// it was stored with
+func migrate(kind store.Kind, raw []byte) (json.RawMessage, int, error) {
+	var (
+		env     envelope
+		version int
+		data    json.RawMessage
+	)
+	raw, err := expand(raw)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to decompress '%s': %w", kind, err)
+	}
+	// Unversioned data has no envelope, and is itself the data
+	if err := json.Unmarshal(raw, &env); err == nil && env.SchemaVersion > 0 && len(env.Data) > 0 {
+		version, data = env.SchemaVersion, env.Data
+	} else {
+		version, data = 0, bytes.Clone(raw)
+	}
+
+	if version > SchemaVersion {
+		return nil, version, fmt.Errorf(
+			"data has schema version %d, but this version of workflow-metrics only supports up to %d, please upgrade",
+			version, SchemaVersion,
+		)
+	}
+
+	kindMigrations, ok := migrations[kind]
+	if !ok {
+		return nil, version, fmt.Errorf("no migrations for '%s'", kind)
+	}
+	for v := version; v < SchemaVersion; v++ {
+		var err error
+		data, err = kindMigrations[v](data)
+		if err != nil {
+			return nil, version, fmt.Errorf("failed to migrate '%s' from schema version %d to %d: %w", kind, v, v+1, err)
+		}
+	}
+	return data, version, nil
+}
+
+// Migrate rewrites all stored data for a repo in the current schema version and storage format, returning the
+// number of items that were rewritten. With dryRun, nothing is rewritten.
+func Migrate(owner, repo string, dryRun bool) (int, error) {
+	var (
+		startTime = time.Now()
+		migrated  int
+		errs      error
+	)
+
+	for kind := range migrations {
+		names, err := dataStore.List(owner, repo, kind)
+		if err != nil {
+			return migrated, fmt.Errorf("failed to list stored %s: %w", kind, err)
+		}
+		for _, name := range names {
+			if filepath.Ext(name) != ".json" {
+				continue
+			}
+			location := dataStore.Location(owner, repo, kind, name)
+			raw, err := dataStore.Get(owner, repo, kind, name)
+			if err != nil {
+				errs = errors.Join(errs, fmt.Errorf("failed to read '%s': %w", location, err))
+				continue
+			}
+			data, version, err := migrate(kind, raw)
+			if err != nil {
+				errs = errors.Join(errs, fmt.Errorf("failed to migrate '%s': %w", location, err))
+				continue
+			}
+			if version == SchemaVersion && isStorageFormat(raw) {
+				continue
+			}
+
+			log.Debug().
+				Str("location", location).
+				Int("from_schema_version", version).
+				Int("to_schema_version", SchemaVersion).
+				Str("storage_format", storageFormat).
+				Bool("dry_run", dryRun).
+				Msg("Migrating stored data")
+			migrated++
+			if dryRun {
+				continue
+			}
+			upgraded, err := encodeRaw(data)
+			if err != nil {
+				errs = errors.Join(errs, fmt.Errorf("failed to marshal '%s': %w", location, err))
+				continue
+			}
+			if err := dataStore.Put(owner, repo, kind, name, upgraded); err != nil {
+				errs = errors.Join(errs, fmt.Errorf("failed to write '%s': %w", location, err))
+			}
+		}
+	}
+
+	log.Info().
+		Str("owner", owner).
+		Str("repo", repo).
+		Int("migrated", migrated).
+		Bool("dry_run", dryRun).
+		Str("duration", time.Since(startTime).String()).
+		Msg("Migrated stored data")
+	return migrated, errs
+}
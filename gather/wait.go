@@ -0,0 +1,93 @@
+package gather
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/google/go-github/v70/github"
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	initialPollInterval = 10 * time.Second
+	maxPollInterval     = 2 * time.Minute
+
+	// githubRunIDEnvVar is set by GitHub Actions to the ID of the workflow run a job is part of
+	githubRunIDEnvVar = "GITHUB_RUN_ID"
+)
+
+var (
+	// maxWait is how long to poll an in-progress workflow run for until it completes, 0 to not wait
+	maxWait time.Duration
+	// partial stores a snapshot of in-progress workflow runs instead of failing to gather them
+	partial bool
+)
+
+// SetWait makes gathering an in-progress workflow run poll until it completes, for at most wait
+func SetWait(wait time.Duration) {
+	maxWait = wait
+}
+
+// SetPartial makes gathering an in-progress workflow run store a snapshot of its jobs so far, marked as partial,
+// instead of failing
+func SetPartial(p bool) {
+	partial = p
+}
+
+// gathersInProgress checks if in-progress workflow runs can be gathered, by waiting for them or snapshotting them
+func gathersInProgress() bool {
+	return maxWait > 0 || partial
+}
+
+// isCurrentWorkflowRun checks if this is running in a job of the workflow run, which can't complete while it waits
+func isCurrentWorkflowRun(workflowRunID int64) bool {
+	currentID, err := strconv.ParseInt(os.Getenv(githubRunIDEnvVar), 10, 64)
+	return err == nil && currentID == workflowRunID
+}
+
+// waitForWorkflowRun polls an in-progress workflow run with backoff until it completes or the max wait runs out,
+// returning the latest state of the run
+func waitForWorkflowRun(client *github.Client, owner, repo string, workflowRun *github.WorkflowRun) (*github.WorkflowRun, error) {
+	var (
+		startTime = time.Now()
+		deadline  = startTime.Add(maxWait)
+		interval  = initialPollInterval
+	)
+
+	for workflowRun.GetStatus() != "completed" {
+		remaining := time.Until(deadline)
+		if remaining <= 0 {
+			log.Warn().
+				Int64("workflow_run_id", workflowRun.GetID()).
+				Str("status", workflowRun.GetStatus()).
+				Str("max_wait", maxWait.String()).
+				Msg("Workflow run did not complete in time")
+			return workflowRun, nil
+		}
+
+		log.Info().
+			Int64("workflow_run_id", workflowRun.GetID()).
+			Str("status", workflowRun.GetStatus()).
+			Str("next_poll", min(interval, remaining).String()).
+			Msg("Waiting for workflow run to complete")
+		time.Sleep(min(interval, remaining))
+		interval = min(interval*2, maxPollInterval)
+
+		polled, _, err := callGitHub(func(ctx context.Context) (*github.WorkflowRun, *github.Response, error) {
+			return client.Actions.GetWorkflowRunByID(ctx, owner, repo, workflowRun.GetID())
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to poll workflow run '%d': %w", workflowRun.GetID(), err)
+		}
+		workflowRun = polled
+	}
+
+	log.Debug().
+		Int64("workflow_run_id", workflowRun.GetID()).
+		Str("waited", time.Since(startTime).String()).
+		Msg("Workflow run completed")
+	return workflowRun, nil
+}
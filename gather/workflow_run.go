@@ -2,21 +2,21 @@ package gather
 
 import (
 	"context"
-	"encoding/json"
+	"errors"
 	"fmt"
-	"os"
+	"net/http"
 	"path/filepath"
 	"sort"
+	"strings"
 	"time"
 
 	"github.com/google/go-github/v70/github"
 	"github.com/kalverra/workflow-metrics/monitor"
+	"github.com/kalverra/workflow-metrics/store"
 	"github.com/rs/zerolog/log"
 	"golang.org/x/sync/errgroup"
 )
 
-const workflowRunsDir = "workflow_runs"
-
 // Mapping of how much a minute for each runner type costs
 // cost depicted in tenths of a cent
 // https://docs.github.com/en/billing/managing-billing-for-your-products/managing-billing-for-github-actions/about-billing-for-github-actions#per-minute-rates
@@ -40,6 +40,17 @@ var rateByRunner = map[string]int64{
 	"UBUNTU_64_CORE_ARM": 160, // $0.16
 }
 
+// SetRunnerRates overrides the per-minute rate of runners, in tenths of a cent, e.g. for negotiated pricing or
+// self-hosted runners that should be tracked at a cost
+func SetRunnerRates(rates map[string]int64) {
+	for runner, rate := range rates {
+		rateByRunner[strings.ToUpper(runner)] = rate
+	}
+}
+
+// UnknownRunner is the runner of jobs gathered without billing data
+const UnknownRunner = "Unknown"
+
 // JobsData wraps standard GitHub WorkflowJob data with additional cost fields
 type JobsData struct {
 	*github.WorkflowJob
@@ -47,12 +58,73 @@ type JobsData struct {
 	Runner string `json:"runner"`
 	// Cost is the cost of the job run in tenths of a cent
 	Cost int64 `json:"cost"`
+	// BillableMinutes is the number of minutes GitHub billed for the job run
+	BillableMinutes int64 `json:"billable_minutes"`
+	// Transitions are the job's status changes as received live by the webhook server, if it was running
+	Transitions []JobTransition `json:"transitions,omitempty"`
+}
+
+// QueueDuration returns how long the job waited for a runner. It's measured from webhook transitions when they
+// were received, and from the job's less precise REST timestamps otherwise.
+func (j *JobsData) QueueDuration() time.Duration {
+	if queued, ok := j.transitionsQueueDuration(); ok {
+		return queued
+	}
+	return j.GetStartedAt().Sub(j.GetCreatedAt().Time)
+}
+
+// QueueSeconds returns how long the job waited for a runner like QueueDuration, and whether it's known, as jobs that
+// never started and weren't seen by the webhook server have no queue time
+func (j *JobsData) QueueSeconds() (float64, bool) {
+	if queued, ok := j.transitionsQueueDuration(); ok {
+		return queued.Seconds(), true
+	}
+	if j.GetCreatedAt().IsZero() || j.GetStartedAt().IsZero() {
+		return 0, false
+	}
+	return j.GetStartedAt().Sub(j.GetCreatedAt().Time).Seconds(), true
+}
+
+// transitionsQueueDuration returns how long the job waited for a runner from its webhook transitions, if both its
+// queued and in_progress transitions were received
+func (j *JobsData) transitionsQueueDuration() (time.Duration, bool) {
+	var queuedAt, startedAt time.Time
+	for _, transition := range j.Transitions {
+		switch transition.Status {
+		case "queued":
+			if queuedAt.IsZero() {
+				queuedAt = transition.ReceivedAt
+			}
+		case "in_progress":
+			if startedAt.IsZero() {
+				startedAt = transition.ReceivedAt
+			}
+		}
+	}
+	if queuedAt.IsZero() || startedAt.IsZero() {
+		return 0, false
+	}
+	return startedAt.Sub(queuedAt), true
+}
+
+// GetBillableMinutes returns the number of minutes GitHub billed for the job run, deriving it from cost for
+// data gathered before billable minutes were recorded
+func (j *JobsData) GetBillableMinutes() int64 {
+	if j.BillableMinutes != 0 || j.Cost == 0 {
+		return j.BillableMinutes
+	}
+	if rate, ok := rateByRunner[j.Runner]; ok && rate > 0 {
+		return j.Cost / rate
+	}
+	return 0
 }
 
 type WorkflowRunData struct {
 	*github.WorkflowRun
 	Jobs                []*JobsData           `json:"jobs,omitempty"`
 	MonitorObservations *monitor.Observations `json:"monitor_observations,omitempty"`
+	// Partial marks a snapshot of a workflow run that was still in progress, without costs
+	Partial bool `json:"partial,omitempty"`
 }
 
 // PR Run: https://github.com/smartcontractkit/chainlink/actions/runs/14093870542
@@ -62,56 +134,67 @@ type WorkflowRunData struct {
 func WorkflowRun(client *github.Client, owner, repo string, workflowRunID int64, forceUpdate bool) (*WorkflowRunData, error) {
 	var (
 		workflowRunData = &WorkflowRunData{}
-		targetDir       = filepath.Join(dataDir, owner, repo, workflowRunsDir)
-		targetFile      = filepath.Join(targetDir, fmt.Sprintf("%d.json", workflowRunID))
-		fileExists      = false
+		targetName      = fmt.Sprintf("%d.json", workflowRunID)
 	)
 
-	err := os.MkdirAll(targetDir, 0755)
-	if err != nil {
-		return nil, fmt.Errorf("failed to make data dir '%s': %w", workflowRunsDir, err)
-	}
-
-	if _, err := os.Stat(targetFile); err == nil {
-		fileExists = true
-	}
-
 	startTime := time.Now()
 	log.Info().Int64("workflow_run_id", workflowRunID).Msg("Gathering workflow run data")
 	successLog := log.Info().
 		Str("duration", time.Since(startTime).String()).
 		Int64("workflow_run_id", workflowRunID)
 
-	if !forceUpdate && fileExists {
-		log.Debug().Str("file", targetFile).Int64("workflow_run_id", workflowRunID).Msg("Reading workflow run data from file")
-		workflowFileBytes, err := os.ReadFile(targetFile)
-		if err != nil {
-			return nil, fmt.Errorf("failed to open workflow run file: %w", err)
+	if !forceUpdate {
+		workflowRunData, err := readWorkflowRun(owner, repo, targetName)
+		switch {
+		// Partial snapshots are refetched, as the workflow run may have completed since
+		case err == nil && workflowRunData.Partial:
+			log.Debug().Int64("workflow_run_id", workflowRunID).Msg("Refetching partial snapshot of workflow run")
+		case err == nil:
+			successLog.Msg("Gathered workflow run data")
+			return workflowRunData, nil
+		case !errors.Is(err, store.ErrNotFound):
+			return nil, err
 		}
-		err = json.Unmarshal(workflowFileBytes, &workflowRunData)
-		successLog.Msg("Gathered workflow run data")
-		return workflowRunData, err
 	}
 
 	log.Debug().Int64("workflow_run_id", workflowRunID).Msg("Fetching workflow run data from GitHub")
 
-	ctx, cancel := context.WithTimeoutCause(ghCtx, timeoutDur, errGitHubTimeout)
-	workflowRun, _, err := client.Actions.GetWorkflowRunByID(ctx, owner, repo, workflowRunID)
+	workflowRun, _, err := callGitHub(func(ctx context.Context) (*github.WorkflowRun, *github.Response, error) {
+		return client.Actions.GetWorkflowRunByID(ctx, owner, repo, workflowRunID)
+	})
 	if err != nil {
-		cancel()
-		return nil, err
+		return nil, fmt.Errorf("failed to get workflow run '%d': %w", workflowRunID, err)
 	}
-	cancel()
 	if workflowRun == nil {
-		return nil, fmt.Errorf("workflow run '%d' not found on GitHub", workflowRunID)
+		return nil, fmt.Errorf("failed to get workflow run '%d': %w", workflowRunID, ErrNotFound)
+	}
+	if workflowRun.GetStatus() != "completed" && maxWait > 0 {
+		if isCurrentWorkflowRun(workflowRunID) {
+			if !partial {
+				return nil, fmt.Errorf("failed to gather workflow run '%d', it can't complete while a job of it waits: %w", workflowRunID, ErrInProgress)
+			}
+			log.Warn().
+				Int64("workflow_run_id", workflowRunID).
+				Msg("Not waiting for the workflow run this is running in, snapshotting it instead")
+		} else {
+			workflowRun, err = waitForWorkflowRun(client, owner, repo, workflowRun)
+			if err != nil {
+				return nil, err
+			}
+		}
 	}
-	if workflowRun.Status == nil || *workflowRun.Status != "completed" {
-		return nil, fmt.Errorf("workflow run '%d' is still in progress", workflowRunID)
+	if workflowRun.GetStatus() != "completed" {
+		if !partial {
+			return nil, fmt.Errorf("failed to gather workflow run '%d': %w", workflowRunID, ErrInProgress)
+		}
+		log.Info().
+			Int64("workflow_run_id", workflowRunID).
+			Str("status", workflowRun.GetStatus()).
+			Msg("Gathering partial snapshot of in-progress workflow run")
+		workflowRunData.Partial = true
 	}
 	workflowRunData.WorkflowRun = workflowRun
 
-	// TODO: Check for workflow-metrics artifact
-
 	var (
 		eg                  errgroup.Group
 		workflowRunJobs     []*github.WorkflowJob
@@ -125,40 +208,136 @@ func WorkflowRun(client *github.Client, owner, repo string, workflowRunID int64,
 	})
 
 	eg.Go(func() error {
+		// Billing data isn't final until the workflow run completes
+		if workflowRunData.Partial {
+			return nil
+		}
 		var billingErr error
 		workflowBillingData, billingErr = billingData(client, owner, repo, workflowRunID)
+		if errors.Is(billingErr, ErrBillingUnavailable) {
+			log.Warn().
+				Err(billingErr).
+				Int64("workflow_run_id", workflowRunID).
+				Msg("Billing data is unavailable, e.g. on GitHub Enterprise Server. Gathering without job costs")
+			workflowBillingData, billingErr = nil, nil
+		}
 		return billingErr
 	})
 
+	eg.Go(func() error {
+		if !monitorArtifacts {
+			return nil
+		}
+		observations, monitorErr := monitorObservations(client, owner, repo, workflowRunID)
+		if monitorErr != nil {
+			// Resource usage is a nice to have, so don't lose the workflow run over it
+			log.Warn().
+				Err(monitorErr).
+				Int64("workflow_run_id", workflowRunID).
+				Msg("Failed to read monitor observations, gathering without them")
+			return nil
+		}
+		workflowRunData.MonitorObservations = observations
+		return nil
+	})
+
 	if err := eg.Wait(); err != nil {
 		return nil, fmt.Errorf("failed to collect job and/or billing data for workflow run '%d': %w", workflowRunID, err)
 	}
 
 	for _, job := range workflowRunJobs {
-		runner, cost, err := calculateJobRunBilling(job.GetID(), workflowBillingData)
+		if workflowBillingData == nil || workflowBillingData.GetBillable() == nil {
+			workflowRunData.Jobs = append(workflowRunData.Jobs, &JobsData{
+				WorkflowJob: job,
+				Runner:      UnknownRunner,
+			})
+			continue
+		}
+		runner, billableMinutes, cost, err := calculateJobRunBilling(job.GetID(), workflowBillingData)
 		if err != nil {
-			return nil, fmt.Errorf("failed to calculate cost for job '%d': %w", job.GetID(), err)
+			// Keep the job without its cost rather than losing the whole workflow run
+			log.Warn().
+				Err(err).
+				Int64("workflow_run_id", workflowRunID).
+				Int64("job_id", job.GetID()).
+				Msg("Failed to calculate cost for job, gathering it without cost")
 		}
 		workflowRunData.Jobs = append(workflowRunData.Jobs, &JobsData{
-			WorkflowJob: job,
-			Runner:      runner,
-			Cost:        cost,
+			WorkflowJob:     job,
+			Runner:          runner,
+			Cost:            cost,
+			BillableMinutes: billableMinutes,
 		})
 	}
 
-	data, err := json.Marshal(workflowRunData)
+	err = mergeJobEvents(owner, repo, workflowRunData)
+	if err != nil {
+		return nil, fmt.Errorf("failed to merge job events for workflow run '%d': %w", workflowRunID, err)
+	}
+
+	data, err := encode(workflowRunData)
 	if err != nil {
 		return nil, fmt.Errorf("failed to marshal workflow run data to json for workflow run '%d': %w", workflowRunID, err)
 	}
-	err = os.WriteFile(targetFile, data, 0644)
+	err = dataStore.Put(owner, repo, store.WorkflowRuns, targetName, data)
 	if err != nil {
-		return nil, fmt.Errorf("failed to write workflow run data to file for workflow run '%d': %w", workflowRunID, err)
+		return nil, fmt.Errorf("failed to store workflow run data for workflow run '%d': %w", workflowRunID, err)
 	}
 
 	successLog.Msg("Gathered workflow run data")
 	return workflowRunData, nil
 }
 
+// LocalWorkflowRuns reads all workflow runs that have already been gathered for a repo. Partial snapshots of
+// in-progress workflow runs are skipped, as they'd skew reports over many runs.
+func LocalWorkflowRuns(owner, repo string) ([]*WorkflowRunData, error) {
+	names, err := dataStore.List(owner, repo, store.WorkflowRuns)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list stored workflow runs: %w", err)
+	}
+
+	workflowRuns := make([]*WorkflowRunData, 0, len(names))
+	for _, name := range names {
+		if filepath.Ext(name) != ".json" {
+			continue
+		}
+		workflowRunData, err := readWorkflowRun(owner, repo, name)
+		if err != nil {
+			return nil, err
+		}
+		if workflowRunData.Partial {
+			log.Debug().Int64("workflow_run_id", workflowRunData.GetID()).Msg("Skipping partial workflow run")
+			continue
+		}
+		workflowRuns = append(workflowRuns, workflowRunData)
+	}
+	sort.Slice(workflowRuns, func(i, j int) bool {
+		return workflowRuns[i].GetCreatedAt().Before(workflowRuns[j].GetCreatedAt().Time)
+	})
+	log.Debug().
+		Str("owner", owner).
+		Str("repo", repo).
+		Int("workflow_run_count", len(workflowRuns)).
+		Msg("Read local workflow runs")
+	return workflowRuns, nil
+}
+
+// readWorkflowRun reads a single gathered workflow run from the data store
+func readWorkflowRun(owner, repo, name string) (*WorkflowRunData, error) {
+	location := dataStore.Location(owner, repo, store.WorkflowRuns, name)
+	log.Debug().Str("location", location).Msg("Reading workflow run data from store")
+	workflowRunBytes, err := dataStore.Get(owner, repo, store.WorkflowRuns, name)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read workflow run '%s': %w", location, err)
+	}
+	workflowRunData := &WorkflowRunData{}
+	err = decode(store.WorkflowRuns, workflowRunBytes, workflowRunData)
+	if err != nil {
+		return nil, fmt.Errorf("failed to unmarshal workflow run '%s': %w", location, err)
+	}
+	return workflowRunData, nil
+}
+
 // jobsData fetches all jobs for a workflow run from GitHub
 func jobsData(client *github.Client, owner, repo string, workflowRunID int64) ([]*github.WorkflowJob, error) {
 	var (
@@ -180,13 +359,12 @@ func jobsData(client *github.Client, owner, repo string, workflowRunID int64) ([
 			jobs *github.Jobs
 		)
 
-		ctx, cancel := context.WithTimeoutCause(ghCtx, timeoutDur, errGitHubTimeout)
-		jobs, resp, err = client.Actions.ListWorkflowJobs(ctx, owner, repo, workflowRunID, listOpts)
+		jobs, resp, err = callGitHub(func(ctx context.Context) (*github.Jobs, *github.Response, error) {
+			return client.Actions.ListWorkflowJobs(ctx, owner, repo, workflowRunID, listOpts)
+		})
 		if err != nil {
-			cancel()
-			return nil, err
+			return nil, fmt.Errorf("failed to list jobs for workflow run '%d': %w", workflowRunID, err)
 		}
-		cancel()
 		workflowJobs = append(workflowJobs, jobs.Jobs...)
 		if resp.NextPage == 0 {
 			break
@@ -211,9 +389,12 @@ func jobsData(client *github.Client, owner, repo string, workflowRunID int64) ([
 // billingData fetches the billing data for a workflow run from GitHub
 func billingData(client *github.Client, owner, repo string, workflowRunID int64) (*github.WorkflowRunUsage, error) {
 	startTime := time.Now()
-	ctx, cancel := context.WithTimeoutCause(ghCtx, timeoutDur, errGitHubTimeout)
-	usage, resp, err := client.Actions.GetWorkflowRunUsageByID(ctx, owner, repo, workflowRunID)
-	cancel()
+	usage, resp, err := callGitHub(func(ctx context.Context) (*github.WorkflowRunUsage, *github.Response, error) {
+		return client.Actions.GetWorkflowRunUsageByID(ctx, owner, repo, workflowRunID)
+	})
+	if billingUnavailable(client, err) {
+		err = fmt.Errorf("%w: %w", ErrBillingUnavailable, err)
+	}
 	if err != nil {
 		return nil, fmt.Errorf("failed to get billing data for workflow run '%d': %w", workflowRunID, err)
 	}
@@ -228,23 +409,48 @@ func billingData(client *github.Client, owner, repo string, workflowRunID int64)
 	return usage, err
 }
 
-// calculateJobRunBilling calculates the cost of a job run based on the billing data
-func calculateJobRunBilling(jobID int64, billingData *github.WorkflowRunUsage) (runner string, costInTenthsOfCents int64, err error) {
+// githubAPIHost is the API host of github.com, rather than GitHub Enterprise Server
+const githubAPIHost = "api.github.com"
+
+// billingUnavailable checks if the billing data request failed because the GitHub instance doesn't provide it,
+// like GitHub Enterprise Server, rather than because of a transient error. Forbidden only counts on GitHub Enterprise
+// Server, as on github.com it means the token is missing permissions.
+func billingUnavailable(client *github.Client, err error) bool {
+	var ghErr *github.ErrorResponse
+	if !errors.As(err, &ghErr) || ghErr.Response == nil {
+		return false
+	}
+	switch ghErr.Response.StatusCode {
+	case http.StatusNotFound, http.StatusGone, http.StatusNotImplemented:
+		return true
+	case http.StatusForbidden:
+		return client.BaseURL.Host != githubAPIHost
+	default:
+		return false
+	}
+}
+
+// calculateJobRunBilling calculates the billable minutes and cost of a job run based on the billing data
+func calculateJobRunBilling(
+	jobID int64,
+	billingData *github.WorkflowRunUsage,
+) (runner string, billableMinutes int64, costInTenthsOfCents int64, err error) {
 	if billingData == nil || billingData.GetBillable() == nil {
-		return "", 0, fmt.Errorf("no billing data available")
+		return UnknownRunner, 0, 0, ErrBillingUnavailable
 	}
 	for runner, billData := range *billingData.GetBillable() {
-		if _, ok := rateByRunner[runner]; !ok {
-			return "", 0, fmt.Errorf("no rate available for runner %s", runner)
-		}
 		for _, job := range billData.JobRuns {
 			if int64(job.GetJobID()) == jobID {
-				billableMinutes := job.GetDurationMS() / 1000 / 60
-				costInTenthsOfCents = billableMinutes * rateByRunner[runner]
-				return runner, costInTenthsOfCents, nil
+				// GitHub bills every started minute
+				billableMinutes = (job.GetDurationMS() + 59999) / 60000
+				rate, ok := rateByRunner[runner]
+				if !ok {
+					return runner, billableMinutes, 0, fmt.Errorf("%w: no rate available for runner %s", ErrBillingUnavailable, runner)
+				}
+				return runner, billableMinutes, billableMinutes * rate, nil
 			}
 		}
 	}
 	// if we didn't find the job ID in billing data, it was free
-	return "Free", 0, nil
+	return "Free", 0, 0, nil
 }
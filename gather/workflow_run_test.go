@@ -0,0 +1,139 @@
+package gather
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/google/go-github/v70/github"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCalculateJobRunBilling(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		name        string
+		durationMS  int64
+		wantMinutes int64
+	}{
+		{name: "under a minute", durationMS: 1, wantMinutes: 1},
+		{name: "exactly a minute", durationMS: 60_000, wantMinutes: 1},
+		{name: "just over a minute", durationMS: 60_001, wantMinutes: 2},
+		{name: "just under two minutes", durationMS: 119_999, wantMinutes: 2},
+		{name: "no duration", durationMS: 0, wantMinutes: 0},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			billingData := &github.WorkflowRunUsage{
+				Billable: &github.WorkflowRunBillMap{
+					"UBUNTU": &github.WorkflowRunBill{
+						JobRuns: []*github.WorkflowRunJobRun{
+							{JobID: github.Ptr(1), DurationMS: github.Ptr(tc.durationMS)},
+						},
+					},
+				},
+			}
+			runner, billableMinutes, cost, err := calculateJobRunBilling(1, billingData)
+			require.NoError(t, err, "failed to calculate billing")
+			assert.Equal(t, "UBUNTU", runner, "wrong runner")
+			assert.Equal(t, tc.wantMinutes, billableMinutes, "wrong billable minutes")
+			assert.Equal(t, tc.wantMinutes*rateByRunner["UBUNTU"], cost, "cost should be billed on the rounded up minutes")
+		})
+	}
+}
+
+func TestBillingUnavailable(t *testing.T) {
+	t.Parallel()
+
+	enterpriseClient, err := github.NewClient(nil).WithEnterpriseURLs("https://github.example.com", "")
+	require.NoError(t, err, "failed to create enterprise client")
+
+	testCases := []struct {
+		name   string
+		client *github.Client
+		status int
+		want   bool
+	}{
+		{name: "not found", client: github.NewClient(nil), status: http.StatusNotFound, want: true},
+		{name: "gone", client: github.NewClient(nil), status: http.StatusGone, want: true},
+		{name: "not implemented", client: github.NewClient(nil), status: http.StatusNotImplemented, want: true},
+		{name: "forbidden on github.com", client: github.NewClient(nil), status: http.StatusForbidden, want: false},
+		{name: "forbidden on enterprise server", client: enterpriseClient, status: http.StatusForbidden, want: true},
+		{name: "server error", client: enterpriseClient, status: http.StatusInternalServerError, want: false},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			err := fmt.Errorf("failed to get billing data: %w", &github.ErrorResponse{
+				Response: &http.Response{StatusCode: tc.status},
+			})
+			assert.Equal(t, tc.want, billingUnavailable(tc.client, err))
+		})
+	}
+	assert.False(t, billingUnavailable(github.NewClient(nil), errors.New("connection reset")), "non GitHub errors aren't unavailable billing")
+}
+
+func TestQueueSeconds(t *testing.T) {
+	t.Parallel()
+
+	var (
+		created = time.Date(2025, time.January, 1, 12, 0, 0, 0, time.UTC)
+		started = created.Add(time.Minute)
+		// Transitions are received a little after the REST timestamps
+		transitions = []JobTransition{
+			{Status: "queued", ReceivedAt: created.Add(time.Second)},
+			{Status: "in_progress", ReceivedAt: created.Add(31 * time.Second)},
+		}
+	)
+	testCases := []struct {
+		name        string
+		job         *github.WorkflowJob
+		transitions []JobTransition
+		wantSeconds float64
+		wantKnown   bool
+	}{
+		{
+			name:        "transitions",
+			job:         &github.WorkflowJob{CreatedAt: &github.Timestamp{Time: created}, StartedAt: &github.Timestamp{Time: started}},
+			transitions: transitions,
+			wantSeconds: 30,
+			wantKnown:   true,
+		},
+		{
+			name:        "transitions without REST timestamps",
+			job:         &github.WorkflowJob{},
+			transitions: transitions,
+			wantSeconds: 30,
+			wantKnown:   true,
+		},
+		{
+			name:        "REST timestamps",
+			job:         &github.WorkflowJob{CreatedAt: &github.Timestamp{Time: created}, StartedAt: &github.Timestamp{Time: started}},
+			transitions: transitions[:1],
+			wantSeconds: 60,
+			wantKnown:   true,
+		},
+		{
+			name:      "never started",
+			job:       &github.WorkflowJob{CreatedAt: &github.Timestamp{Time: created}},
+			wantKnown: false,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			job := &JobsData{WorkflowJob: tc.job, Transitions: tc.transitions}
+			seconds, known := job.QueueSeconds()
+			assert.Equal(t, tc.wantKnown, known, "wrong whether queue time is known")
+			assert.InDelta(t, tc.wantSeconds, seconds, 0.001, "wrong queue seconds")
+		})
+	}
+}
@@ -1,6 +1,8 @@
 package monitor
 
 import (
+	"encoding/json"
+	"errors"
 	"fmt"
 	"os"
 	"os/signal"
@@ -14,10 +16,30 @@ import (
 	"github.com/shirou/gopsutil/v4/process"
 )
 
+const (
+	// ArtifactName is the name of the artifact that gather looks for monitor observations in
+	ArtifactName = "workflow-metrics-monitor"
+	// FileName is the name of the observations file inside the artifact
+	FileName = "monitor.json"
+)
+
+// Observations are the resource usage samples taken while monitoring a runner
 type Observations struct {
+	Samples []Sample `json:"samples,omitempty"`
+}
+
+// Sample is the resource usage of a single process at a point in time
+type Sample struct {
+	Time       time.Time `json:"time"`
+	Process    string    `json:"process"`
+	PID        int32     `json:"pid"`
+	CPUPercent float64   `json:"cpu_percent"`
+	MemPercent float32   `json:"mem_percent"`
 }
 
-func Monitor(interval time.Duration) error {
+// Monitor samples the resource usage of every process at an interval until interrupted, then writes the observations
+// to outputFile. Upload the file in an artifact named ArtifactName for gather to attach it to the workflow run.
+func Monitor(interval time.Duration, outputFile string) error {
 	interruptChan := make(chan os.Signal, 1)
 	signal.Notify(interruptChan, os.Interrupt, syscall.SIGTERM)
 
@@ -29,59 +51,89 @@ func Monitor(interval time.Duration) error {
 		log.Info().Str("name", c.ModelName).Int32("cores", c.Cores).Msg("CPU Info")
 	}
 
-	var monitorErrs error
+	var (
+		monitorErrs  error
+		observations = &Observations{}
+	)
 	ticker := time.NewTicker(interval)
 	defer ticker.Stop()
 
 	for {
 		select {
 		case <-interruptChan:
-			log.Info().Msg("Stopping Monitoring")
-			return monitorErrs
+			log.Info().Int("sample_count", len(observations.Samples)).Msg("Stopping Monitoring")
+			return errors.Join(monitorErrs, writeObservations(outputFile, observations))
 		case <-ticker.C:
-			if err := monitor(); err != nil {
+			samples, err := monitor()
+			if err != nil {
 				log.Error().Err(err).Msg("Error monitoring")
-				if monitorErrs == nil {
-					monitorErrs = err
-				} else {
-					monitorErrs = fmt.Errorf("%w; %w", monitorErrs, err)
-				}
+				monitorErrs = errors.Join(monitorErrs, err)
 			}
+			observations.Samples = append(observations.Samples, samples...)
 		}
 	}
 }
 
-func monitor() error {
+// writeObservations writes observations as JSON to a file
+func writeObservations(outputFile string, observations *Observations) error {
+	data, err := json.Marshal(observations)
+	if err != nil {
+		return fmt.Errorf("failed to marshal monitor observations: %w", err)
+	}
+	if err := os.WriteFile(outputFile, data, 0644); err != nil {
+		return fmt.Errorf("failed to write monitor observations to '%s': %w", outputFile, err)
+	}
+	log.Info().Str("file", outputFile).Msg("Wrote monitor observations")
+	return nil
+}
+
+// monitor samples the resource usage of every process
+func monitor() ([]Sample, error) {
 	v, err := mem.VirtualMemory()
 	if err != nil {
-		return err
+		return nil, err
 	}
-	log.Info().Uint64("Available", v.Available).Uint64("Used", v.Used).Msg("Virtual Memory")
+	log.Debug().Uint64("Available", v.Available).Uint64("Used", v.Used).Msg("Virtual Memory")
 
 	processes, err := process.Processes()
 	if err != nil {
-		return err
+		return nil, err
 	}
+	var (
+		now     = time.Now()
+		samples = make([]Sample, 0, len(processes))
+	)
 	for _, p := range processes {
+		// Processes can exit, or deny access, between being listed and sampled
 		name, err := p.Exe() // Name has a bug on Mac: https://github.com/shirou/gopsutil/issues/1803
 		if err != nil {
-			return fmt.Errorf("error getting process name: %w", err)
+			log.Debug().Err(err).Int32("pid", p.Pid).Msg("Skipping process without a name")
+			continue
 		}
 		name = filepath.Base(name)
 		cpuPercent, err := p.CPUPercent()
 		if err != nil {
-			return fmt.Errorf("error getting process CPU percent: %w", err)
+			log.Debug().Err(err).Int32("pid", p.Pid).Msg("Skipping process without CPU percent")
+			continue
 		}
 		memPercent, err := p.MemoryPercent()
 		if err != nil {
-			return fmt.Errorf("error getting process memory percent: %w", err)
+			log.Debug().Err(err).Int32("pid", p.Pid).Msg("Skipping process without memory percent")
+			continue
 		}
-		log.Info().
+		log.Trace().
 			Str("name", name).
 			Float64("cpu_pct", cpuPercent).
 			Float32("mem_pct", memPercent).
 			Int32("pid", p.Pid).
 			Msg("Process")
+		samples = append(samples, Sample{
+			Time:       now,
+			Process:    name,
+			PID:        p.Pid,
+			CPUPercent: cpuPercent,
+			MemPercent: memPercent,
+		})
 	}
-	return nil
+	return samples, nil
 }
@@ -0,0 +1,434 @@
+package observe
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/go-github/v70/github"
+	"github.com/kalverra/workflow-metrics/gather"
+	"github.com/kalverra/workflow-metrics/store"
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/log"
+)
+
+// Statuses of a budget
+const (
+	BudgetOK       = "ok"
+	BudgetWarning  = "warning"
+	BudgetExceeded = "exceeded"
+)
+
+const (
+	// budgetIssueTitlePrefix starts the title of issues opened for exceeded budgets, to find and update them later
+	budgetIssueTitlePrefix = "CI budget exceeded: "
+	// budgetIssueMarkerPrefix starts the hidden marker of the budget's status and spend in budget issues and their
+	// comments, so unchanged budgets aren't commented on again
+	budgetIssueMarkerPrefix = "<!-- workflow-metrics:budget "
+	// budgetAlertsName is the observation that holds the alert state of budgets last posted to a webhook
+	budgetAlertsName = "budget_alerts.json"
+	// budgetIssueTimeout is how long to wait for GitHub when reading or writing budget issues
+	budgetIssueTimeout = 10 * time.Second
+)
+
+// Budget is a limit on CI spend over a period, for a repo, workflow, or runner SKU
+type Budget struct {
+	Name string
+	// Repo is the owner/repo the budget covers, or empty for every repo checked
+	Repo string
+	// Workflow only counts runs of a workflow name, path, or file name
+	Workflow string
+	// Runner only counts jobs on a runner SKU, e.g. UBUNTU_4_CORE
+	Runner string
+	// Period is day, week, month, or quarter to date, or a rolling window like 30d or 168h
+	Period string
+	// Limit is the most that can be spent in the period, in dollars
+	Limit float64
+	// WarnPercent warns once this much of the limit is spent, 0 to not warn
+	WarnPercent float64
+}
+
+// BudgetResult is how much of a budget was spent in its current period
+type BudgetResult struct {
+	Budget Budget
+	From   time.Time
+	To     time.Time
+	Runs   int
+	// Spent is in tenths of a cent, like job costs
+	Spent int64
+	// Percent is how much of the limit was spent
+	Percent float64
+	Status  string
+}
+
+// FormattedSpent is the spend in dollars
+func (r *BudgetResult) FormattedSpent() string {
+	return formatCost(float64(r.Spent))
+}
+
+// FormattedLimit is the limit in dollars
+func (r *BudgetResult) FormattedLimit() string {
+	return formatCost(r.Budget.Limit * 1000)
+}
+
+// alertState is the budget's status and spend, which are only alerted on again once they change
+func (r *BudgetResult) alertState() string {
+	return fmt.Sprintf("status=%s spent=%d", r.Status, r.Spent)
+}
+
+// Scope describes what the budget covers, e.g. "kalverra/workflow-metrics ci.yml on UBUNTU_4_CORE"
+func (r *BudgetResult) Scope() string {
+	scope := []string{}
+	if r.Budget.Repo != "" {
+		scope = append(scope, r.Budget.Repo)
+	} else {
+		scope = append(scope, "all repos")
+	}
+	if r.Budget.Workflow != "" {
+		scope = append(scope, r.Budget.Workflow)
+	}
+	if r.Budget.Runner != "" {
+		scope = append(scope, "on "+r.Budget.Runner)
+	}
+	return strings.Join(scope, " ")
+}
+
+// CheckBudgets evaluates the budgets against the locally gathered runs of repos, as of now. Budgets for a single repo
+// only check that repo.
+func CheckBudgets(budgets []Budget, repos []store.Repo, now time.Time) ([]*BudgetResult, error) {
+	var (
+		startTime    = time.Now()
+		results      = make([]*BudgetResult, 0, len(budgets))
+		workflowRuns = map[store.Repo][]*gather.WorkflowRunData{}
+	)
+	localWorkflowRuns := func(r store.Repo) ([]*gather.WorkflowRunData, error) {
+		if runs, ok := workflowRuns[r]; ok {
+			return runs, nil
+		}
+		runs, err := gather.LocalWorkflowRuns(r.Owner, r.Repo)
+		if err != nil {
+			return nil, err
+		}
+		workflowRuns[r] = runs
+		return runs, nil
+	}
+
+	for _, budget := range budgets {
+		if budget.Limit <= 0 {
+			return nil, fmt.Errorf("budget '%s' must have a limit above 0", budget.Name)
+		}
+		from, err := budgetPeriodStart(budget.Period, now)
+		if err != nil {
+			return nil, fmt.Errorf("invalid period for budget '%s': %w", budget.Name, err)
+		}
+
+		budgetRepos := repos
+		if budget.Repo != "" {
+			owner, repo, ok := strings.Cut(budget.Repo, "/")
+			if !ok || owner == "" || repo == "" {
+				return nil, fmt.Errorf("invalid repo '%s' for budget '%s', must be owner/repo", budget.Repo, budget.Name)
+			}
+			budgetRepos = []store.Repo{{Owner: owner, Repo: repo}}
+		}
+
+		result := &BudgetResult{Budget: budget, From: from, To: now}
+		for _, r := range budgetRepos {
+			runs, err := localWorkflowRuns(r)
+			if err != nil {
+				return nil, err
+			}
+			for _, workflowRun := range runs {
+				created := workflowRun.GetCreatedAt().Time
+				if created.Before(from) || created.After(now) || !matchesWorkflow(workflowRun, budget.Workflow) {
+					continue
+				}
+				counted := false
+				for _, job := range workflowRun.Jobs {
+					if budget.Runner != "" && !strings.EqualFold(job.Runner, budget.Runner) {
+						continue
+					}
+					result.Spent += job.Cost
+					counted = true
+				}
+				if counted {
+					result.Runs++
+				}
+			}
+		}
+
+		result.Percent = float64(result.Spent) / (budget.Limit * 1000) * 100
+		switch {
+		case result.Percent > 100:
+			result.Status = BudgetExceeded
+		case budget.WarnPercent > 0 && result.Percent >= budget.WarnPercent:
+			result.Status = BudgetWarning
+		default:
+			result.Status = BudgetOK
+		}
+		results = append(results, result)
+
+		log.WithLevel(budgetLogLevel(result.Status)).
+			Str("budget", budget.Name).
+			Str("scope", result.Scope()).
+			Time("from", from).
+			Int("workflow_run_count", result.Runs).
+			Str("spent", result.FormattedSpent()).
+			Str("limit", result.FormattedLimit()).
+			Str("percent", strconv.FormatFloat(result.Percent, 'f', 1, 64)).
+			Str("status", result.Status).
+			Msg("Checked budget")
+	}
+
+	log.Debug().
+		Int("budget_count", len(budgets)).
+		Int("repo_count", len(repos)).
+		Str("duration", time.Since(startTime).String()).
+		Msg("Checked budgets")
+	return results, nil
+}
+
+// budgetPeriodStart is when the budget's current period started. Calendar periods start in UTC.
+func budgetPeriodStart(period string, now time.Time) (time.Time, error) {
+	now = now.UTC()
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
+	switch period {
+	case "day":
+		return today, nil
+	case "week":
+		// Weeks start on Monday
+		return today.AddDate(0, 0, -((int(today.Weekday()) + 6) % 7)), nil
+	case "", "month":
+		return time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, time.UTC), nil
+	case "quarter":
+		return time.Date(now.Year(), now.Month()-(now.Month()-1)%3, 1, 0, 0, 0, 0, time.UTC), nil
+	}
+
+	if days, ok := strings.CutSuffix(period, "d"); ok {
+		if n, err := strconv.Atoi(days); err == nil && n > 0 {
+			return now.AddDate(0, 0, -n), nil
+		}
+	}
+	if d, err := time.ParseDuration(period); err == nil && d > 0 {
+		return now.Add(-d), nil
+	}
+	return time.Time{}, fmt.Errorf("unknown period '%s', must be day, week, month, quarter, or a window like 30d or 168h", period)
+}
+
+func budgetLogLevel(status string) zerolog.Level {
+	switch status {
+	case BudgetExceeded:
+		return zerolog.ErrorLevel
+	case BudgetWarning:
+		return zerolog.WarnLevel
+	default:
+		return zerolog.InfoLevel
+	}
+}
+
+// BudgetAlertMarkdown summarizes the budgets that need attention
+func BudgetAlertMarkdown(results []*BudgetResult) string {
+	var md strings.Builder
+	for _, result := range results {
+		if result.Status == BudgetOK {
+			continue
+		}
+		emoji := ":warning:"
+		if result.Status == BudgetExceeded {
+			emoji = ":rotating_light:"
+		}
+		fmt.Fprintf(&md, "%s *%s* budget %s: %s of %s (%.1f%%) for %s since %s\n",
+			emoji, result.Budget.Name, result.Status, result.FormattedSpent(), result.FormattedLimit(), result.Percent,
+			result.Scope(), result.From.Format(time.DateOnly),
+		)
+	}
+	return md.String()
+}
+
+// PostBudgetWebhook posts the budgets that need attention to a Slack compatible incoming webhook, if their status or
+// spend changed since they were last posted for owner/repo
+func PostBudgetWebhook(webhookURL, owner, repo string, results []*BudgetResult) error {
+	posted, err := readBudgetAlerts(owner, repo)
+	if err != nil {
+		return err
+	}
+
+	changed := []*BudgetResult{}
+	for _, result := range results {
+		if posted[result.Budget.Name] != result.alertState() {
+			changed = append(changed, result)
+		}
+		posted[result.Budget.Name] = result.alertState()
+	}
+	if text := BudgetAlertMarkdown(changed); text != "" {
+		if err := postWebhook(webhookURL, map[string]string{"text": text}); err != nil {
+			return fmt.Errorf("failed to post budget alert: %w", err)
+		}
+		log.Info().Int("budget_count", len(changed)).Msg("Posted budget alert to webhook")
+	} else {
+		log.Debug().Msg("No budget changed since the last alert, not posting to webhook")
+	}
+	// Budgets back to ok are saved too, so they're alerted on again if they need attention later
+	return writeBudgetAlerts(owner, repo, posted)
+}
+
+// readBudgetAlerts reads the alert state of each budget last posted to a webhook for owner/repo
+func readBudgetAlerts(owner, repo string) (map[string]string, error) {
+	posted := map[string]string{}
+	data, err := dataStore.Get(owner, repo, store.Observations, budgetAlertsName)
+	if errors.Is(err, store.ErrNotFound) {
+		return posted, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read posted budget alerts: %w", err)
+	}
+	if err := json.Unmarshal(data, &posted); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal posted budget alerts '%s': %w", dataStore.Location(owner, repo, store.Observations, budgetAlertsName), err)
+	}
+	return posted, nil
+}
+
+// writeBudgetAlerts saves the alert state of each budget posted to a webhook for owner/repo
+func writeBudgetAlerts(owner, repo string, posted map[string]string) error {
+	data, err := json.Marshal(posted)
+	if err != nil {
+		return err
+	}
+	if err := dataStore.Put(owner, repo, store.Observations, budgetAlertsName, data); err != nil {
+		return fmt.Errorf("failed to save posted budget alerts: %w", err)
+	}
+	return nil
+}
+
+// OpenBudgetIssues opens an issue for each exceeded budget, or comments on the issue that's already open for it.
+// Budgets for a single repo open issues in that repo, others in owner/repo.
+func OpenBudgetIssues(client *github.Client, owner, repo string, results []*BudgetResult) error {
+	for _, result := range results {
+		if result.Status != BudgetExceeded {
+			continue
+		}
+		issueOwner, issueRepo := owner, repo
+		if result.Budget.Repo != "" {
+			issueOwner, issueRepo, _ = strings.Cut(result.Budget.Repo, "/")
+		}
+		if issueOwner == "" || issueRepo == "" {
+			return fmt.Errorf("no repo to open an issue for budget '%s' in, set the budget's repo or provide owner and repo", result.Budget.Name)
+		}
+		issueNumber, err := upsertBudgetIssue(client, issueOwner, issueRepo, result)
+		if err != nil {
+			return fmt.Errorf("failed to open issue for budget '%s': %w", result.Budget.Name, err)
+		}
+		log.Info().
+			Str("budget", result.Budget.Name).
+			Str("owner", issueOwner).
+			Str("repo", issueRepo).
+			Int("issue_number", issueNumber).
+			Msg("Opened budget issue")
+	}
+	return nil
+}
+
+// upsertBudgetIssue comments on the open issue for an exceeded budget if its status or spend changed since the last
+// update, or opens one if there isn't one
+func upsertBudgetIssue(client *github.Client, owner, repo string, result *BudgetResult) (int, error) {
+	var (
+		title  = budgetIssueTitlePrefix + result.Budget.Name
+		marker = budgetIssueMarkerPrefix + result.alertState() + " -->"
+		body   = fmt.Sprintf(
+			"The **%s** budget for %s is exceeded: %s spent of %s (%.1f%%) in %d runs since %s.\n%s\n",
+			result.Budget.Name, result.Scope(), result.FormattedSpent(), result.FormattedLimit(), result.Percent,
+			result.Runs, result.From.Format(time.DateOnly), marker,
+		)
+		listOpts = &github.IssueListByRepoOptions{
+			State:       "open",
+			ListOptions: github.ListOptions{PerPage: 100},
+		}
+	)
+
+	for { // Paginate through all open issues looking for the budget's
+		ctx, cancel := context.WithTimeout(context.Background(), budgetIssueTimeout)
+		issues, resp, err := client.Issues.ListByRepo(ctx, owner, repo, listOpts)
+		cancel()
+		if err != nil {
+			return 0, fmt.Errorf("failed to list issues: %w", err)
+		}
+		for _, issue := range issues {
+			if issue.GetTitle() != title || issue.IsPullRequest() {
+				continue
+			}
+			lastMarker, err := lastBudgetMarker(client, owner, repo, issue)
+			if err != nil {
+				return 0, err
+			}
+			if lastMarker == marker {
+				log.Debug().
+					Str("budget", result.Budget.Name).
+					Int("issue_number", issue.GetNumber()).
+					Msg("Budget unchanged since the last update of its issue, not commenting")
+				return issue.GetNumber(), nil
+			}
+			ctx, cancel := context.WithTimeout(context.Background(), budgetIssueTimeout)
+			_, _, err = client.Issues.CreateComment(ctx, owner, repo, issue.GetNumber(), &github.IssueComment{Body: github.Ptr(body)})
+			cancel()
+			if err != nil {
+				return 0, fmt.Errorf("failed to comment on issue '%d': %w", issue.GetNumber(), err)
+			}
+			return issue.GetNumber(), nil
+		}
+		if resp.NextPage == 0 {
+			break
+		}
+		listOpts.Page = resp.NextPage
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), budgetIssueTimeout)
+	issue, _, err := client.Issues.Create(ctx, owner, repo, &github.IssueRequest{Title: github.Ptr(title), Body: github.Ptr(body)})
+	cancel()
+	if err != nil {
+		return 0, fmt.Errorf("failed to create issue: %w", err)
+	}
+	return issue.GetNumber(), nil
+}
+
+// lastBudgetMarker finds the budget marker of the latest update of a budget issue, from its comments or its body
+func lastBudgetMarker(client *github.Client, owner, repo string, issue *github.Issue) (string, error) {
+	var (
+		lastMarker = budgetMarker(issue.GetBody())
+		listOpts   = &github.IssueListCommentsOptions{
+			ListOptions: github.ListOptions{PerPage: 100},
+		}
+	)
+	for { // Paginate through all comments, oldest first, keeping the latest marker
+		ctx, cancel := context.WithTimeout(context.Background(), budgetIssueTimeout)
+		comments, resp, err := client.Issues.ListComments(ctx, owner, repo, issue.GetNumber(), listOpts)
+		cancel()
+		if err != nil {
+			return "", fmt.Errorf("failed to list comments of issue '%d': %w", issue.GetNumber(), err)
+		}
+		for _, comment := range comments {
+			if marker := budgetMarker(comment.GetBody()); marker != "" {
+				lastMarker = marker
+			}
+		}
+		if resp.NextPage == 0 {
+			return lastMarker, nil
+		}
+		listOpts.Page = resp.NextPage
+	}
+}
+
+// budgetMarker returns the budget marker in an issue or comment body, or an empty string if it has none
+func budgetMarker(body string) string {
+	start := strings.Index(body, budgetIssueMarkerPrefix)
+	if start < 0 {
+		return ""
+	}
+	end := strings.Index(body[start:], "-->")
+	if end < 0 {
+		return ""
+	}
+	return body[start : start+end+len("-->")]
+}
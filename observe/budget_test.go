@@ -0,0 +1,196 @@
+package observe
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/go-github/v70/github"
+	"github.com/kalverra/workflow-metrics/store"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeIssues serves a repo's issues and their comments, recording created ones
+type fakeIssues struct {
+	mu       sync.Mutex
+	issues   []*github.Issue
+	comments map[string][]*github.IssueComment
+}
+
+func newFakeIssues(t *testing.T) (*fakeIssues, *github.Client) {
+	t.Helper()
+
+	f := &fakeIssues{comments: map[string][]*github.IssueComment{}}
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /repos/{owner}/{repo}/issues", func(w http.ResponseWriter, r *http.Request) {
+		f.mu.Lock()
+		defer f.mu.Unlock()
+		writeJSON(t, w, f.issues)
+	})
+	mux.HandleFunc("POST /repos/{owner}/{repo}/issues", func(w http.ResponseWriter, r *http.Request) {
+		f.mu.Lock()
+		defer f.mu.Unlock()
+		issue := &github.Issue{}
+		assert.NoError(t, json.NewDecoder(r.Body).Decode(issue), "failed to decode issue")
+		issue.Number = github.Ptr(len(f.issues) + 1)
+		f.issues = append(f.issues, issue)
+		writeJSON(t, w, issue)
+	})
+	mux.HandleFunc("GET /repos/{owner}/{repo}/issues/{number}/comments", func(w http.ResponseWriter, r *http.Request) {
+		f.mu.Lock()
+		defer f.mu.Unlock()
+		writeJSON(t, w, f.comments[r.PathValue("number")])
+	})
+	mux.HandleFunc("POST /repos/{owner}/{repo}/issues/{number}/comments", func(w http.ResponseWriter, r *http.Request) {
+		f.mu.Lock()
+		defer f.mu.Unlock()
+		comment := &github.IssueComment{}
+		assert.NoError(t, json.NewDecoder(r.Body).Decode(comment), "failed to decode comment")
+		f.comments[r.PathValue("number")] = append(f.comments[r.PathValue("number")], comment)
+		writeJSON(t, w, comment)
+	})
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+
+	client := github.NewClient(nil)
+	baseURL, err := url.Parse(server.URL + "/")
+	require.NoError(t, err, "failed to parse server URL")
+	client.BaseURL = baseURL
+	return f, client
+}
+
+// snapshot returns the issues and comments served so far
+func (f *fakeIssues) snapshot() ([]*github.Issue, map[string][]*github.IssueComment) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	comments := make(map[string][]*github.IssueComment, len(f.comments))
+	for number, c := range f.comments {
+		comments[number] = append([]*github.IssueComment(nil), c...)
+	}
+	return append([]*github.Issue(nil), f.issues...), comments
+}
+
+func writeJSON(t *testing.T, w http.ResponseWriter, v any) {
+	t.Helper()
+	w.Header().Set("Content-Type", "application/json")
+	assert.NoError(t, json.NewEncoder(w).Encode(v), "failed to encode response")
+}
+
+func TestUpsertBudgetIssue(t *testing.T) {
+	t.Parallel()
+
+	fake, client := newFakeIssues(t)
+	result := &BudgetResult{
+		Budget:  Budget{Name: "ci", Limit: 10},
+		From:    time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC),
+		Runs:    3,
+		Spent:   12_000,
+		Percent: 120,
+		Status:  BudgetExceeded,
+	}
+
+	number, err := upsertBudgetIssue(client, "kalverra", "workflow-metrics", result)
+	require.NoError(t, err, "failed to open budget issue")
+	issues, comments := fake.snapshot()
+	assert.Equal(t, 1, number, "wrong issue number")
+	require.Len(t, issues, 1, "expected an issue to be opened")
+	assert.Equal(t, budgetIssueTitlePrefix+"ci", issues[0].GetTitle(), "wrong issue title")
+	assert.Empty(t, comments, "a new issue shouldn't be commented on")
+
+	result.Runs++
+	number, err = upsertBudgetIssue(client, "kalverra", "workflow-metrics", result)
+	require.NoError(t, err, "failed to update budget issue")
+	issues, comments = fake.snapshot()
+	assert.Equal(t, 1, number, "wrong issue number")
+	assert.Len(t, issues, 1, "the open issue should be reused")
+	assert.Empty(t, comments["1"], "unchanged spend shouldn't be commented on")
+
+	result.Spent = 15_000
+	_, err = upsertBudgetIssue(client, "kalverra", "workflow-metrics", result)
+	require.NoError(t, err, "failed to update budget issue")
+	_, comments = fake.snapshot()
+	require.Len(t, comments["1"], 1, "changed spend should be commented on")
+	assert.Contains(t, comments["1"][0].GetBody(), "$15.000 spent", "comment should have the new spend")
+
+	_, err = upsertBudgetIssue(client, "kalverra", "workflow-metrics", result)
+	require.NoError(t, err, "failed to update budget issue")
+	issues, comments = fake.snapshot()
+	assert.Len(t, comments["1"], 1, "spend unchanged since the last comment shouldn't be commented on")
+	assert.Len(t, issues, 1, "the open issue should be reused")
+}
+
+// The store is set for the whole process, so this can't run in parallel
+func TestPostBudgetWebhookOnlyChanges(t *testing.T) {
+	dir := t.TempDir()
+	SetStore(store.NewFileSystem(filepath.Join(dir, "data"), filepath.Join(dir, "observe_output")))
+
+	var (
+		mu     sync.Mutex
+		posted []string
+	)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		payload := map[string]string{}
+		assert.NoError(t, json.NewDecoder(r.Body).Decode(&payload), "failed to decode posted payload")
+		mu.Lock()
+		defer mu.Unlock()
+		posted = append(posted, payload["text"])
+	}))
+	t.Cleanup(server.Close)
+
+	result := func(name string, spent int64, status string) *BudgetResult {
+		return &BudgetResult{Budget: Budget{Name: name, Limit: 10}, Spent: spent, Percent: float64(spent) / 100, Status: status}
+	}
+	checks := []struct {
+		name     string
+		results  []*BudgetResult
+		wantPost []string
+	}{
+		{
+			name:     "first warning",
+			results:  []*BudgetResult{result("ci", 9_000, BudgetWarning), result("nightly", 1_000, BudgetOK)},
+			wantPost: []string{"*ci* budget warning"},
+		},
+		{
+			name:    "unchanged",
+			results: []*BudgetResult{result("ci", 9_000, BudgetWarning), result("nightly", 1_000, BudgetOK)},
+		},
+		{
+			name:     "more spent",
+			results:  []*BudgetResult{result("ci", 11_000, BudgetExceeded), result("nightly", 9_500, BudgetWarning)},
+			wantPost: []string{"*ci* budget exceeded", "*nightly* budget warning"},
+		},
+		{
+			name:    "back to ok",
+			results: []*BudgetResult{result("ci", 11_000, BudgetExceeded), result("nightly", 0, BudgetOK)},
+		},
+		{
+			name:     "warning again",
+			results:  []*BudgetResult{result("ci", 11_000, BudgetExceeded), result("nightly", 9_500, BudgetWarning)},
+			wantPost: []string{"*nightly* budget warning"},
+		},
+	}
+	for _, check := range checks {
+		mu.Lock()
+		posted = nil
+		mu.Unlock()
+		require.NoError(t, PostBudgetWebhook(server.URL, "kalverra", "workflow-metrics", check.results), "failed to post %s", check.name)
+
+		mu.Lock()
+		if len(check.wantPost) == 0 {
+			assert.Empty(t, posted, "nothing changed to post for %s", check.name)
+		} else if assert.Len(t, posted, 1, "expected a post for %s", check.name) {
+			for _, want := range check.wantPost {
+				assert.Contains(t, posted[0], want, "changed budget should be posted for %s", check.name)
+			}
+			assert.Equal(t, len(check.wantPost), strings.Count(posted[0], "\n"), "only changed budgets should be posted for %s", check.name)
+		}
+		mu.Unlock()
+	}
+}
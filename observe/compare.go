@@ -0,0 +1,416 @@
+package observe
+
+import (
+	"bytes"
+	"fmt"
+	htmlTemplate "html/template"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/google/go-github/v70/github"
+	"github.com/kalverra/workflow-metrics/gather"
+	"github.com/rs/zerolog/log"
+)
+
+// Statuses of a job or step when comparing two workflow runs
+const (
+	compareStatusNew       = "new"
+	compareStatusRemoved   = "removed"
+	compareStatusRegressed = "regressed"
+	compareStatusImproved  = "improved"
+	compareStatusUnchanged = "unchanged"
+)
+
+// CompareWorkflowRuns compares two workflow runs, matching jobs and steps by name, and writes the results
+// in the requested output types. regressionThreshold is the percentage a job or step's duration must grow by
+// to be flagged as regressed.
+func CompareWorkflowRuns(
+	client *github.Client,
+	owner, repo string,
+	baseWorkflowRunID, headWorkflowRunID int64,
+	regressionThreshold float64,
+	outputTypes []string,
+) error {
+	baseRun, err := gather.WorkflowRun(client, owner, repo, baseWorkflowRunID, false)
+	if err != nil {
+		return fmt.Errorf("failed to gather base workflow run '%d': %w", baseWorkflowRunID, err)
+	}
+	headRun, err := gather.WorkflowRun(client, owner, repo, headWorkflowRunID, false)
+	if err != nil {
+		return fmt.Errorf("failed to gather head workflow run '%d': %w", headWorkflowRunID, err)
+	}
+
+	var (
+		startTime   = time.Now()
+		outputFiles = make([]string, 0, len(outputTypes))
+		comparison  = compareWorkflowRuns(baseRun, headRun, regressionThreshold)
+		targetName  = fmt.Sprintf("compare_%d_%d", baseWorkflowRunID, headWorkflowRunID)
+	)
+
+	for _, outputType := range outputTypes {
+		var rendered string
+		switch outputType {
+		case "html":
+			rendered, err = comparisonRenderHTML(comparison)
+			if err != nil {
+				return fmt.Errorf("failed to render HTML: %w", err)
+			}
+		case "md":
+			rendered = comparisonRenderMarkdown(comparison)
+		default:
+			return fmt.Errorf("unknown output type '%s'", outputType)
+		}
+
+		outputFile, err := writeObservation(owner, repo, fmt.Sprintf("%s.%s", targetName, outputType), rendered)
+		if err != nil {
+			return fmt.Errorf("failed to write %s file: %w", outputType, err)
+		}
+		outputFiles = append(outputFiles, outputFile)
+	}
+
+	log.Info().
+		Int64("base_workflow_run_id", baseWorkflowRunID).
+		Int64("head_workflow_run_id", headWorkflowRunID).
+		Strs("output_files", outputFiles).
+		Str("duration", time.Since(startTime).String()).
+		Msg("Compared workflow runs")
+	return nil
+}
+
+// comparison holds the differences between a base and a head workflow run
+type comparison struct {
+	Base          *gather.WorkflowRunData
+	Head          *gather.WorkflowRunData
+	Threshold     float64
+	Duration      delta
+	Cost          delta
+	Jobs          []*jobComparison
+	NewJobs       int
+	RemovedJobs   int
+	RegressedJobs int
+}
+
+// jobComparison holds the differences of a single job between two workflow runs
+type jobComparison struct {
+	Name     string
+	Status   string
+	Duration delta
+	Cost     delta
+	Steps    []*stepComparison
+}
+
+// stepComparison holds the differences of a single step between two workflow runs
+type stepComparison struct {
+	Name     string
+	Status   string
+	Duration delta
+}
+
+// delta describes the change of a single value between a base and a head workflow run
+type delta struct {
+	Base float64
+	Head float64
+}
+
+// Diff returns the absolute change from base to head
+func (d delta) Diff() float64 {
+	return d.Head - d.Base
+}
+
+// Percent returns the change from base to head as a percentage of base
+func (d delta) Percent() float64 {
+	if d.Base == 0 {
+		if d.Head == 0 {
+			return 0
+		}
+		return 100
+	}
+	return (d.Head - d.Base) / d.Base * 100
+}
+
+func compareWorkflowRuns(baseRun, headRun *gather.WorkflowRunData, regressionThreshold float64) *comparison {
+	comp := &comparison{
+		Base:      baseRun,
+		Head:      headRun,
+		Threshold: regressionThreshold,
+		Duration: delta{
+			Base: workflowRunDuration(baseRun).Seconds(),
+			Head: workflowRunDuration(headRun).Seconds(),
+		},
+	}
+
+	baseJobs, baseJobNames := jobsByName(baseRun)
+	headJobs, headJobNames := jobsByName(headRun)
+
+	for _, name := range headJobNames {
+		headJob := headJobs[name]
+		comp.Cost.Head += float64(headJob.Cost)
+		baseJob, ok := baseJobs[name]
+		if !ok {
+			comp.NewJobs++
+			comp.Jobs = append(comp.Jobs, &jobComparison{
+				Name:     name,
+				Status:   compareStatusNew,
+				Duration: delta{Head: jobDuration(headJob).Seconds()},
+				Cost:     delta{Head: float64(headJob.Cost)},
+				Steps:    compareSteps(nil, headJob.Steps, regressionThreshold),
+			})
+			continue
+		}
+
+		jobComp := &jobComparison{
+			Name: name,
+			Duration: delta{
+				Base: jobDuration(baseJob).Seconds(),
+				Head: jobDuration(headJob).Seconds(),
+			},
+			Cost: delta{
+				Base: float64(baseJob.Cost),
+				Head: float64(headJob.Cost),
+			},
+			Steps: compareSteps(baseJob.Steps, headJob.Steps, regressionThreshold),
+		}
+		jobComp.Status = durationStatus(jobComp.Duration, regressionThreshold)
+		if jobComp.Status == compareStatusRegressed {
+			comp.RegressedJobs++
+		}
+		comp.Jobs = append(comp.Jobs, jobComp)
+	}
+
+	for _, name := range baseJobNames {
+		baseJob := baseJobs[name]
+		comp.Cost.Base += float64(baseJob.Cost)
+		if _, ok := headJobs[name]; ok {
+			continue
+		}
+		comp.RemovedJobs++
+		comp.Jobs = append(comp.Jobs, &jobComparison{
+			Name:     name,
+			Status:   compareStatusRemoved,
+			Duration: delta{Base: jobDuration(baseJob).Seconds()},
+			Cost:     delta{Base: float64(baseJob.Cost)},
+			Steps:    compareSteps(baseJob.Steps, nil, regressionThreshold),
+		})
+	}
+
+	return comp
+}
+
+func compareSteps(baseSteps, headSteps []*github.TaskStep, regressionThreshold float64) []*stepComparison {
+	var (
+		stepComps             = []*stepComparison{}
+		baseByName, baseNames = stepsByName(baseSteps)
+		headByName, headNames = stepsByName(headSteps)
+	)
+
+	for _, name := range headNames {
+		headStep := headByName[name]
+		baseStep, ok := baseByName[name]
+		if !ok {
+			stepComps = append(stepComps, &stepComparison{
+				Name:     name,
+				Status:   compareStatusNew,
+				Duration: delta{Head: stepDuration(headStep).Seconds()},
+			})
+			continue
+		}
+		stepComp := &stepComparison{
+			Name: name,
+			Duration: delta{
+				Base: stepDuration(baseStep).Seconds(),
+				Head: stepDuration(headStep).Seconds(),
+			},
+		}
+		stepComp.Status = durationStatus(stepComp.Duration, regressionThreshold)
+		stepComps = append(stepComps, stepComp)
+	}
+
+	for _, name := range baseNames {
+		if _, ok := headByName[name]; ok {
+			continue
+		}
+		stepComps = append(stepComps, &stepComparison{
+			Name:     name,
+			Status:   compareStatusRemoved,
+			Duration: delta{Base: stepDuration(baseByName[name]).Seconds()},
+		})
+	}
+	return stepComps
+}
+
+// durationStatus determines if a duration has regressed, improved, or stayed the same
+func durationStatus(d delta, regressionThreshold float64) string {
+	switch {
+	case d.Percent() > regressionThreshold:
+		return compareStatusRegressed
+	case d.Percent() < -regressionThreshold:
+		return compareStatusImproved
+	default:
+		return compareStatusUnchanged
+	}
+}
+
+// jobsByName maps the jobs of the latest attempt of a workflow run by name, returning the names in run order.
+// Duplicate names are disambiguated by their order of appearance.
+func jobsByName(workflowRun *gather.WorkflowRunData) (map[string]*gather.JobsData, []string) {
+	var (
+		jobs  = map[string]*gather.JobsData{}
+		names = []string{}
+	)
+	for _, job := range workflowRun.Jobs {
+		if job.GetRunAttempt() != 0 && job.GetRunAttempt() != int64(workflowRun.GetRunAttempt()) {
+			continue
+		}
+		name := uniqueName(job.GetName(), jobs)
+		jobs[name] = job
+		names = append(names, name)
+	}
+	return jobs, names
+}
+
+// stepsByName maps steps by name, returning the names in run order.
+// Duplicate names are disambiguated by their order of appearance.
+func stepsByName(steps []*github.TaskStep) (map[string]*github.TaskStep, []string) {
+	var (
+		byName = map[string]*github.TaskStep{}
+		names  = []string{}
+	)
+	for _, step := range steps {
+		name := uniqueName(step.GetName(), byName)
+		byName[name] = step
+		names = append(names, name)
+	}
+	return byName, names
+}
+
+func uniqueName[T any](name string, existing map[string]T) string {
+	if _, ok := existing[name]; !ok {
+		return name
+	}
+	for i := 2; ; i++ {
+		candidate := fmt.Sprintf("%s #%d", name, i)
+		if _, ok := existing[candidate]; !ok {
+			return candidate
+		}
+	}
+}
+
+func workflowRunDuration(workflowRun *gather.WorkflowRunData) time.Duration {
+	return workflowRun.GetUpdatedAt().Sub(workflowRun.GetRunStartedAt().Time) // TODO: UpdatedAt is probably inaccurate
+}
+
+func jobDuration(job *gather.JobsData) time.Duration {
+	if job.GetStartedAt().IsZero() || job.GetCompletedAt().IsZero() {
+		return 0
+	}
+	return job.GetCompletedAt().Sub(job.GetStartedAt().Time)
+}
+
+func stepDuration(step *github.TaskStep) time.Duration {
+	if step.GetStartedAt().IsZero() || step.GetCompletedAt().IsZero() {
+		return 0
+	}
+	return step.GetCompletedAt().Sub(step.GetStartedAt().Time)
+}
+
+// formatCost formats a cost in tenths of a cent as dollars
+func formatCost(costInTenthsOfCents float64) string {
+	return fmt.Sprintf("$%.3f", costInTenthsOfCents/1000)
+}
+
+// formatSeconds formats a number of seconds as a duration
+func formatSeconds(seconds float64) string {
+	return (time.Duration(seconds) * time.Second).String()
+}
+
+// formatDurationDelta formats the change in a duration with its percentage
+func formatDurationDelta(d delta) string {
+	return fmt.Sprintf("%s%s (%+.1f%%)", sign(d.Diff()), formatSeconds(abs(d.Diff())), d.Percent())
+}
+
+// formatCostDelta formats the change in a cost with its percentage
+func formatCostDelta(d delta) string {
+	return fmt.Sprintf("%s%s (%+.1f%%)", sign(d.Diff()), formatCost(abs(d.Diff())), d.Percent())
+}
+
+func sign(f float64) string {
+	if f < 0 {
+		return "-"
+	}
+	return "+"
+}
+
+func abs(f float64) float64 {
+	if f < 0 {
+		return -f
+	}
+	return f
+}
+
+var compareStatusEmoji = map[string]string{
+	compareStatusNew:       "🆕",
+	compareStatusRemoved:   "🗑️",
+	compareStatusRegressed: "🔺",
+	compareStatusImproved:  "🔻",
+	compareStatusUnchanged: "",
+}
+
+var comparisonTemplateFuncs = map[string]any{
+	"cost":          formatCost,
+	"seconds":       formatSeconds,
+	"durationDelta": formatDurationDelta,
+	"costDelta":     formatCostDelta,
+	"statusEmoji":   func(status string) string { return compareStatusEmoji[status] },
+}
+
+func comparisonRenderMarkdown(comp *comparison) string {
+	var md strings.Builder
+
+	fmt.Fprintf(&md, "# Workflow Run Comparison: %d vs %d\n\n", comp.Base.GetID(), comp.Head.GetID())
+	fmt.Fprintf(&md, "| | Base ([%d](%s)) | Head ([%d](%s)) | Change |\n", comp.Base.GetID(), comp.Base.GetHTMLURL(), comp.Head.GetID(), comp.Head.GetHTMLURL())
+	md.WriteString("|---|---|---|---|\n")
+	fmt.Fprintf(&md, "| Duration | %s | %s | %s |\n", formatSeconds(comp.Duration.Base), formatSeconds(comp.Duration.Head), formatDurationDelta(comp.Duration))
+	fmt.Fprintf(&md, "| Cost | %s | %s | %s |\n\n", formatCost(comp.Cost.Base), formatCost(comp.Cost.Head), formatCostDelta(comp.Cost))
+	fmt.Fprintf(&md, "**%d** new, **%d** removed, **%d** regressed (>%.1f%% slower) jobs\n\n", comp.NewJobs, comp.RemovedJobs, comp.RegressedJobs, comp.Threshold)
+
+	md.WriteString("## Jobs\n\n")
+	md.WriteString("| Job | Status | Base Duration | Head Duration | Duration Change | Base Cost | Head Cost | Cost Change |\n")
+	md.WriteString("|---|---|---|---|---|---|---|---|\n")
+	for _, job := range comp.Jobs {
+		fmt.Fprintf(&md, "| %s | %s %s | %s | %s | %s | %s | %s | %s |\n",
+			job.Name, compareStatusEmoji[job.Status], job.Status,
+			formatSeconds(job.Duration.Base), formatSeconds(job.Duration.Head), formatDurationDelta(job.Duration),
+			formatCost(job.Cost.Base), formatCost(job.Cost.Head), formatCostDelta(job.Cost),
+		)
+	}
+
+	md.WriteString("\n## Steps\n")
+	for _, job := range comp.Jobs {
+		fmt.Fprintf(&md, "\n<details>\n<summary>%s</summary>\n\n", job.Name)
+		md.WriteString("| Step | Status | Base Duration | Head Duration | Duration Change |\n")
+		md.WriteString("|---|---|---|---|---|\n")
+		for _, step := range job.Steps {
+			fmt.Fprintf(&md, "| %s | %s %s | %s | %s | %s |\n",
+				step.Name, compareStatusEmoji[step.Status], step.Status,
+				formatSeconds(step.Duration.Base), formatSeconds(step.Duration.Head), formatDurationDelta(step.Duration),
+			)
+		}
+		md.WriteString("\n</details>\n")
+	}
+	return md.String()
+}
+
+func comparisonRenderHTML(comp *comparison) (string, error) {
+	tmpl, err := htmlTemplate.New("compare").Funcs(comparisonTemplateFuncs).ParseFiles(filepath.Join(templatesDir, "compare.html"))
+	if err != nil {
+		return "", fmt.Errorf("failed to parse HTML template: %w", err)
+	}
+
+	var html bytes.Buffer
+	err = tmpl.Execute(&html, comp)
+	if err != nil {
+		return "", fmt.Errorf("failed to execute HTML template: %w", err)
+	}
+	return html.String(), nil
+}
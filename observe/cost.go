@@ -0,0 +1,364 @@
+package observe
+
+import (
+	"bytes"
+	"encoding/csv"
+	"fmt"
+	htmlTemplate "html/template"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/kalverra/workflow-metrics/gather"
+	"github.com/rs/zerolog/log"
+)
+
+// Dimensions that cost can be grouped by
+const (
+	CostByWorkflow = "workflow"
+	CostByJob      = "job"
+	CostByBranch   = "branch"
+	CostByEvent    = "event"
+	CostByActor    = "actor"
+	CostByRunner   = "runner"
+)
+
+// CostGroupings are all the dimensions cost can be grouped by, in the order they're reported
+var CostGroupings = []string{CostByWorkflow, CostByJob, CostByBranch, CostByEvent, CostByActor, CostByRunner}
+
+var costCSVHeader = []string{
+	"group_by",
+	"key",
+	"runs",
+	"jobs",
+	"billable_minutes",
+	"cost_usd",
+	"cost_percent",
+}
+
+// CostFilter selects the locally gathered runs to roll up costs for. Empty fields include everything.
+type CostFilter struct {
+	Workflow string
+	Branch   string
+	// Since and Until bound when runs were created
+	Since time.Time
+	Until time.Time
+}
+
+// Cost rolls up the cost of locally gathered runs by each of the groupings, with totals and each group's share of them
+func Cost(owner, repo string, filter CostFilter, groupings, outputTypes []string) error {
+	for _, grouping := range groupings {
+		if !slices.Contains(CostGroupings, grouping) {
+			return fmt.Errorf("unknown cost grouping '%s', must be one of %s", grouping, strings.Join(CostGroupings, ", "))
+		}
+	}
+
+	workflowRuns, err := gather.LocalWorkflowRuns(owner, repo)
+	if err != nil {
+		return err
+	}
+
+	var (
+		startTime   = time.Now()
+		outputFiles = make([]string, 0, len(outputTypes))
+		filtered    = make([]*gather.WorkflowRunData, 0, len(workflowRuns))
+	)
+	for _, workflowRun := range workflowRuns {
+		created := workflowRun.GetCreatedAt().Time
+		if matchesWorkflow(workflowRun, filter.Workflow) &&
+			(filter.Branch == "" || workflowRun.GetHeadBranch() == filter.Branch) &&
+			(filter.Since.IsZero() || !created.Before(filter.Since)) &&
+			(filter.Until.IsZero() || created.Before(filter.Until)) {
+			filtered = append(filtered, workflowRun)
+		}
+	}
+
+	report := buildCostReport(filtered, groupings)
+	report.Owner, report.Repo, report.Workflow, report.Branch = owner, repo, filter.Workflow, filter.Branch
+	if !filter.Since.IsZero() {
+		report.Since = filter.Since.UTC().Format(time.RFC3339)
+	}
+	if !filter.Until.IsZero() {
+		report.Until = filter.Until.UTC().Format(time.RFC3339)
+	}
+
+	targetName := "cost"
+	if filter.Workflow != "" {
+		targetName = fmt.Sprintf("%s_%s", targetName, fileSafeName(filter.Workflow))
+	}
+	if filter.Branch != "" {
+		targetName = fmt.Sprintf("%s_%s", targetName, fileSafeName(filter.Branch))
+	}
+	for _, outputType := range outputTypes {
+		var rendered string
+		switch outputType {
+		case "html":
+			rendered, err = costRenderHTML(report)
+			if err != nil {
+				return fmt.Errorf("failed to render HTML: %w", err)
+			}
+		case "md":
+			rendered = costRenderMarkdown(report)
+		case "csv":
+			rendered, err = costRenderCSV(report)
+			if err != nil {
+				return fmt.Errorf("failed to render CSV: %w", err)
+			}
+		default:
+			return fmt.Errorf("unknown output type '%s'", outputType)
+		}
+
+		outputFile, err := writeObservation(owner, repo, fmt.Sprintf("%s.%s", targetName, outputType), rendered)
+		if err != nil {
+			return fmt.Errorf("failed to write %s file: %w", outputType, err)
+		}
+		outputFiles = append(outputFiles, outputFile)
+	}
+
+	log.Info().
+		Str("workflow", filter.Workflow).
+		Str("branch", filter.Branch).
+		Int("workflow_run_count", len(filtered)).
+		Str("total_cost", formatCost(float64(report.Cost))).
+		Strs("output_files", outputFiles).
+		Str("duration", time.Since(startTime).String()).
+		Msg("Built cost report")
+	return nil
+}
+
+// costReport holds the total cost of a set of workflow runs, and how it splits by each grouping
+type costReport struct {
+	Owner           string
+	Repo            string
+	Workflow        string
+	Branch          string
+	Since           string
+	Until           string
+	RunCount        int
+	JobCount        int
+	BillableMinutes int64
+	Cost            int64
+	// UnbilledJobs are jobs without billing data, e.g. from GitHub Enterprise Server, which count as free
+	UnbilledJobs int
+	Groups       []*costGroup
+}
+
+// costGroup is the cost of workflow runs grouped by a single dimension
+type costGroup struct {
+	By   string
+	Rows []*costRow
+}
+
+// costRow is the cost of everything sharing a key of a grouping, e.g. a single branch
+type costRow struct {
+	Key             string
+	Runs            int
+	Jobs            int
+	BillableMinutes int64
+	Cost            int64
+	// Percent is the row's share of the total cost
+	Percent float64
+
+	runIDs map[int64]bool
+}
+
+// FormattedCost is the row's cost in dollars
+func (r *costRow) FormattedCost() string {
+	return formatCost(float64(r.Cost))
+}
+
+// FormattedCost is the total cost in dollars
+func (r *costReport) FormattedCost() string {
+	return formatCost(float64(r.Cost))
+}
+
+// Percent is the total's share of the total cost, like the rows' shares, so it's 0 when nothing cost anything
+func (r *costReport) Percent() float64 {
+	return costShare(r.Cost, r.Cost)
+}
+
+// costShare is the percentage of total that cost is, or 0 if total is 0
+func costShare(cost, total int64) float64 {
+	if total <= 0 {
+		return 0
+	}
+	return float64(cost) / float64(total) * 100
+}
+
+// Title is the display name of the grouping
+func (g *costGroup) Title() string {
+	switch g.By {
+	case CostByRunner:
+		return "Runner SKU"
+	default:
+		return strings.ToUpper(g.By[:1]) + g.By[1:]
+	}
+}
+
+func buildCostReport(workflowRuns []*gather.WorkflowRunData, groupings []string) *costReport {
+	report := &costReport{RunCount: len(workflowRuns)}
+	groups := make(map[string]map[string]*costRow, len(groupings))
+	for _, grouping := range groupings {
+		groups[grouping] = map[string]*costRow{}
+	}
+
+	for _, workflowRun := range workflowRuns {
+		for _, job := range workflowRun.Jobs {
+			report.JobCount++
+			report.BillableMinutes += job.GetBillableMinutes()
+			report.Cost += job.Cost
+			if job.Runner == "" || job.Runner == gather.UnknownRunner {
+				report.UnbilledJobs++
+			}
+
+			for _, grouping := range groupings {
+				key := costKey(grouping, workflowRun, job)
+				row, ok := groups[grouping][key]
+				if !ok {
+					row = &costRow{Key: key, runIDs: map[int64]bool{}}
+					groups[grouping][key] = row
+				}
+				row.runIDs[workflowRun.GetID()] = true
+				row.Jobs++
+				row.BillableMinutes += job.GetBillableMinutes()
+				row.Cost += job.Cost
+			}
+		}
+	}
+
+	for _, grouping := range groupings {
+		group := &costGroup{By: grouping, Rows: make([]*costRow, 0, len(groups[grouping]))}
+		for _, row := range groups[grouping] {
+			row.Runs = len(row.runIDs)
+			row.Percent = costShare(row.Cost, report.Cost)
+			group.Rows = append(group.Rows, row)
+		}
+		// Most expensive first
+		sort.Slice(group.Rows, func(i, j int) bool {
+			if group.Rows[i].Cost != group.Rows[j].Cost {
+				return group.Rows[i].Cost > group.Rows[j].Cost
+			}
+			if group.Rows[i].BillableMinutes != group.Rows[j].BillableMinutes {
+				return group.Rows[i].BillableMinutes > group.Rows[j].BillableMinutes
+			}
+			return group.Rows[i].Key < group.Rows[j].Key
+		})
+		report.Groups = append(report.Groups, group)
+	}
+	return report
+}
+
+// costKey is the key a job's cost is grouped under
+func costKey(grouping string, workflowRun *gather.WorkflowRunData, job *gather.JobsData) string {
+	var key string
+	switch grouping {
+	case CostByWorkflow:
+		key = filepath.Base(workflowRun.GetPath())
+		if workflowRun.GetPath() == "" {
+			key = workflowRun.GetName()
+		}
+	case CostByJob:
+		key = fmt.Sprintf("%s / %s", workflowRun.GetName(), job.GetName())
+	case CostByBranch:
+		key = workflowRun.GetHeadBranch()
+	case CostByEvent:
+		key = workflowRun.GetEvent()
+	case CostByActor:
+		key = workflowRun.GetTriggeringActor().GetLogin()
+		if key == "" {
+			key = workflowRun.GetActor().GetLogin()
+		}
+	case CostByRunner:
+		key = job.Runner
+	}
+	if key == "" {
+		return "unknown"
+	}
+	return key
+}
+
+func costRenderMarkdown(report *costReport) string {
+	var md strings.Builder
+
+	md.WriteString("# Cost Report\n\n")
+	fmt.Fprintf(&md, "Rolled up **%d** jobs in **%d** runs of `%s/%s`", report.JobCount, report.RunCount, report.Owner, report.Repo)
+	if report.Workflow != "" {
+		fmt.Fprintf(&md, " for workflow `%s`", report.Workflow)
+	}
+	if report.Branch != "" {
+		fmt.Fprintf(&md, " on branch `%s`", report.Branch)
+	}
+	if report.Since != "" {
+		fmt.Fprintf(&md, " since %s", report.Since)
+	}
+	if report.Until != "" {
+		fmt.Fprintf(&md, " until %s", report.Until)
+	}
+	md.WriteString("\n\n")
+	fmt.Fprintf(&md, "**Total:** %s for %d billable minutes\n", report.FormattedCost(), report.BillableMinutes)
+	if report.UnbilledJobs > 0 {
+		fmt.Fprintf(&md, "\n%d jobs have no billing data and count as free\n", report.UnbilledJobs)
+	}
+
+	for _, group := range report.Groups {
+		fmt.Fprintf(&md, "\n## By %s\n\n", group.Title())
+		fmt.Fprintf(&md, "| %s | Runs | Jobs | Billable Minutes | Cost | %% of Cost |\n", group.Title())
+		md.WriteString("|---|---|---|---|---|---|\n")
+		for _, row := range group.Rows {
+			fmt.Fprintf(&md, "| %s | %d | %d | %d | %s | %.1f%% |\n",
+				row.Key, row.Runs, row.Jobs, row.BillableMinutes, row.FormattedCost(), row.Percent,
+			)
+		}
+		fmt.Fprintf(&md, "| **Total** | %d | %d | %d | %s | %.1f%% |\n",
+			report.RunCount, report.JobCount, report.BillableMinutes, report.FormattedCost(), report.Percent(),
+		)
+	}
+	return md.String()
+}
+
+func costRenderHTML(report *costReport) (string, error) {
+	tmpl, err := htmlTemplate.New("cost").ParseFiles(filepath.Join(templatesDir, "cost.html"))
+	if err != nil {
+		return "", fmt.Errorf("failed to parse HTML template: %w", err)
+	}
+
+	var html bytes.Buffer
+	err = tmpl.Execute(&html, report)
+	if err != nil {
+		return "", fmt.Errorf("failed to execute HTML template: %w", err)
+	}
+	return html.String(), nil
+}
+
+// costRenderCSV renders one row per key of each grouping
+func costRenderCSV(report *costReport) (string, error) {
+	var (
+		buf bytes.Buffer
+		w   = csv.NewWriter(&buf)
+	)
+
+	if err := w.Write(costCSVHeader); err != nil {
+		return "", err
+	}
+	for _, group := range report.Groups {
+		for _, row := range group.Rows {
+			err := w.Write([]string{
+				group.By,
+				row.Key,
+				strconv.Itoa(row.Runs),
+				strconv.Itoa(row.Jobs),
+				strconv.FormatInt(row.BillableMinutes, 10),
+				strconv.FormatFloat(float64(row.Cost)/1000, 'f', 3, 64),
+				strconv.FormatFloat(row.Percent, 'f', 2, 64),
+			})
+			if err != nil {
+				return "", err
+			}
+		}
+	}
+	w.Flush()
+	return buf.String(), w.Error()
+}
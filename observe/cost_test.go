@@ -0,0 +1,35 @@
+package observe
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCostRenderMarkdownTotalShare(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name      string
+		cost      int64
+		wantTotal string
+	}{
+		{name: "cost", cost: 16, wantTotal: "| **Total** | 1 | 1 | 2 | $0.016 | 100.0% |"},
+		{name: "free", cost: 0, wantTotal: "| **Total** | 1 | 1 | 2 | $0.000 | 0.0% |"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+
+			row := &costRow{Key: "CI", Runs: 1, Jobs: 1, BillableMinutes: 2, Cost: test.cost, Percent: costShare(test.cost, test.cost)}
+			report := &costReport{
+				RunCount:        1,
+				JobCount:        1,
+				BillableMinutes: 2,
+				Cost:            test.cost,
+				Groups:          []*costGroup{{By: CostByWorkflow, Rows: []*costRow{row}}},
+			}
+			assert.Contains(t, costRenderMarkdown(report), test.wantTotal, "total should have the same share as its rows")
+		})
+	}
+}
@@ -0,0 +1,116 @@
+package observe
+
+import (
+	"bytes"
+	"encoding/csv"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/kalverra/workflow-metrics/gather"
+	"github.com/rs/zerolog/log"
+)
+
+var jobsCSVHeader = []string{
+	"run_id",
+	"workflow",
+	"branch",
+	"event",
+	"job",
+	"runner",
+	"queued_at",
+	"started_at",
+	"completed_at",
+	"duration_seconds",
+	"billable_minutes",
+	"cost_usd",
+	"conclusion",
+}
+
+// JobsCSV writes a single CSV with one row per job for all locally gathered runs. An empty workflow or branch
+// includes all workflows or branches.
+func JobsCSV(owner, repo, workflow, branch string) error {
+	workflowRuns, err := gather.LocalWorkflowRuns(owner, repo)
+	if err != nil {
+		return err
+	}
+
+	var (
+		startTime = time.Now()
+		filtered  = make([]*gather.WorkflowRunData, 0, len(workflowRuns))
+	)
+	for _, workflowRun := range workflowRuns {
+		if matchesWorkflow(workflowRun, workflow) && (branch == "" || workflowRun.GetHeadBranch() == branch) {
+			filtered = append(filtered, workflowRun)
+		}
+	}
+
+	rendered, err := jobsRenderCSV(filtered...)
+	if err != nil {
+		return fmt.Errorf("failed to render CSV: %w", err)
+	}
+
+	targetName := "jobs"
+	if workflow != "" {
+		targetName = fmt.Sprintf("%s_%s", targetName, fileSafeName(workflow))
+	}
+	if branch != "" {
+		targetName = fmt.Sprintf("%s_%s", targetName, fileSafeName(branch))
+	}
+	outputFile, err := writeObservation(owner, repo, targetName+".csv", rendered)
+	if err != nil {
+		return fmt.Errorf("failed to write csv file: %w", err)
+	}
+
+	log.Info().
+		Str("workflow", workflow).
+		Str("branch", branch).
+		Int("workflow_run_count", len(filtered)).
+		Str("output_file", outputFile).
+		Str("duration", time.Since(startTime).String()).
+		Msg("Wrote jobs CSV")
+	return nil
+}
+
+// jobsRenderCSV renders one row per job of the workflow runs
+func jobsRenderCSV(workflowRuns ...*gather.WorkflowRunData) (string, error) {
+	var (
+		buf bytes.Buffer
+		w   = csv.NewWriter(&buf)
+	)
+
+	if err := w.Write(jobsCSVHeader); err != nil {
+		return "", err
+	}
+	for _, workflowRun := range workflowRuns {
+		for _, job := range workflowRun.Jobs {
+			err := w.Write([]string{
+				strconv.FormatInt(workflowRun.GetID(), 10),
+				workflowRun.GetName(),
+				workflowRun.GetHeadBranch(),
+				workflowRun.GetEvent(),
+				job.GetName(),
+				job.Runner,
+				formatCSVTime(job.GetCreatedAt().Time),
+				formatCSVTime(job.GetStartedAt().Time),
+				formatCSVTime(job.GetCompletedAt().Time),
+				strconv.FormatFloat(jobDuration(job).Seconds(), 'f', -1, 64),
+				strconv.FormatInt(job.GetBillableMinutes(), 10),
+				strconv.FormatFloat(float64(job.Cost)/1000, 'f', 3, 64),
+				job.GetConclusion(),
+			})
+			if err != nil {
+				return "", err
+			}
+		}
+	}
+	w.Flush()
+	return buf.String(), w.Error()
+}
+
+func formatCSVTime(t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+	return t.UTC().Format(time.RFC3339)
+}
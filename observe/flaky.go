@@ -0,0 +1,319 @@
+package observe
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	htmlTemplate "html/template"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/kalverra/workflow-metrics/gather"
+	"github.com/rs/zerolog/log"
+)
+
+// maxFlakyExamples is the most example runs shown for each flaky job or step
+const maxFlakyExamples = 5
+
+// Flaky finds jobs and steps in locally gathered runs that both failed and succeeded for the same commit,
+// either through re-run attempts or separate runs. An empty workflow or branch includes all workflows or branches.
+func Flaky(owner, repo, workflow, branch string, outputTypes []string) error {
+	workflowRuns, err := gather.LocalWorkflowRuns(owner, repo)
+	if err != nil {
+		return err
+	}
+
+	var (
+		startTime   = time.Now()
+		outputFiles = make([]string, 0, len(outputTypes))
+		filtered    = make([]*gather.WorkflowRunData, 0, len(workflowRuns))
+	)
+	for _, workflowRun := range workflowRuns {
+		if matchesWorkflow(workflowRun, workflow) && (branch == "" || workflowRun.GetHeadBranch() == branch) {
+			filtered = append(filtered, workflowRun)
+		}
+	}
+
+	report := buildFlakyReport(filtered)
+	report.Owner, report.Repo, report.Workflow, report.Branch = owner, repo, workflow, branch
+
+	targetName := "flaky"
+	if workflow != "" {
+		targetName = fmt.Sprintf("%s_%s", targetName, fileSafeName(workflow))
+	}
+	if branch != "" {
+		targetName = fmt.Sprintf("%s_%s", targetName, fileSafeName(branch))
+	}
+	for _, outputType := range outputTypes {
+		var rendered string
+		switch outputType {
+		case "html":
+			rendered, err = flakyRenderHTML(report)
+			if err != nil {
+				return fmt.Errorf("failed to render HTML: %w", err)
+			}
+		case "md":
+			rendered = flakyRenderMarkdown(report)
+		case "json":
+			rendered, err = flakyRenderJSON(report)
+			if err != nil {
+				return fmt.Errorf("failed to render JSON: %w", err)
+			}
+		default:
+			return fmt.Errorf("unknown output type '%s'", outputType)
+		}
+
+		outputFile, err := writeObservation(owner, repo, fmt.Sprintf("%s.%s", targetName, outputType), rendered)
+		if err != nil {
+			return fmt.Errorf("failed to write %s file: %w", outputType, err)
+		}
+		outputFiles = append(outputFiles, outputFile)
+	}
+
+	log.Info().
+		Str("workflow", workflow).
+		Str("branch", branch).
+		Int("workflow_run_count", len(filtered)).
+		Int("flaky_job_count", len(report.Jobs)).
+		Int("flaky_step_count", len(report.Steps)).
+		Strs("output_files", outputFiles).
+		Str("duration", time.Since(startTime).String()).
+		Msg("Built flaky report")
+	return nil
+}
+
+// flakyReport holds all flaky jobs and steps found in a set of workflow runs
+type flakyReport struct {
+	Owner    string         `json:"owner"`
+	Repo     string         `json:"repo"`
+	Workflow string         `json:"workflow,omitempty"`
+	Branch   string         `json:"branch,omitempty"`
+	RunCount int            `json:"run_count"`
+	Jobs     []*flakyResult `json:"jobs"`
+	Steps    []*flakyResult `json:"steps"`
+}
+
+// flakyResult describes how flaky a single job or step is
+type flakyResult struct {
+	Workflow string `json:"workflow"`
+	Job      string `json:"job"`
+	Step     string `json:"step,omitempty"`
+	// Commits is the number of distinct commits the job or step ran on with a success or failure
+	Commits int `json:"commits"`
+	// FlakyCommits is the number of those commits where the job or step both failed and succeeded
+	FlakyCommits int `json:"flaky_commits"`
+	// Flips is the number of times the outcome changed between consecutive executions on the same commit
+	Flips int `json:"flips"`
+	// Score is the percentage of commits where the job or step was flaky
+	Score    float64         `json:"score"`
+	Examples []*flakyExample `json:"examples"`
+}
+
+// flakyExample is a single commit where a job or step was flaky
+type flakyExample struct {
+	HeadSHA    string            `json:"head_sha"`
+	Executions []*flakyExecution `json:"executions"`
+}
+
+// flakyExecution is a single execution of a job or step
+type flakyExecution struct {
+	WorkflowRunID int64     `json:"workflow_run_id"`
+	RunAttempt    int64     `json:"run_attempt"`
+	Conclusion    string    `json:"conclusion"`
+	StartedAt     time.Time `json:"started_at"`
+	URL           string    `json:"url"`
+}
+
+// flakyKey identifies a job or step on a single commit
+type flakyKey struct {
+	workflow string
+	job      string
+	step     string
+}
+
+func buildFlakyReport(workflowRuns []*gather.WorkflowRunData) *flakyReport {
+	var (
+		report = &flakyReport{RunCount: len(workflowRuns), Jobs: []*flakyResult{}, Steps: []*flakyResult{}}
+		// executions of each job and step, grouped by commit
+		executions = map[flakyKey]map[string][]*flakyExecution{}
+	)
+
+	record := func(key flakyKey, sha string, execution *flakyExecution) {
+		if execution.Conclusion != "success" && execution.Conclusion != "failure" {
+			return
+		}
+		if _, ok := executions[key]; !ok {
+			executions[key] = map[string][]*flakyExecution{}
+		}
+		executions[key][sha] = append(executions[key][sha], execution)
+	}
+
+	for _, workflowRun := range workflowRuns {
+		sha := workflowRun.GetHeadSHA()
+		for _, job := range workflowRun.Jobs {
+			jobKey := flakyKey{workflow: workflowRun.GetName(), job: job.GetName()}
+			record(jobKey, sha, &flakyExecution{
+				WorkflowRunID: workflowRun.GetID(),
+				RunAttempt:    job.GetRunAttempt(),
+				Conclusion:    job.GetConclusion(),
+				StartedAt:     job.GetStartedAt().Time,
+				URL:           job.GetHTMLURL(),
+			})
+			for _, step := range job.Steps {
+				stepKey := flakyKey{workflow: jobKey.workflow, job: jobKey.job, step: step.GetName()}
+				record(stepKey, sha, &flakyExecution{
+					WorkflowRunID: workflowRun.GetID(),
+					RunAttempt:    job.GetRunAttempt(),
+					Conclusion:    step.GetConclusion(),
+					StartedAt:     step.GetStartedAt().Time,
+					URL:           fmt.Sprintf("%s#step:%d:1", job.GetHTMLURL(), step.GetNumber()),
+				})
+			}
+		}
+	}
+
+	for key, byCommit := range executions {
+		result := &flakyResult{
+			Workflow: key.workflow,
+			Job:      key.job,
+			Step:     key.step,
+			Commits:  len(byCommit),
+			Examples: []*flakyExample{},
+		}
+		for sha, commitExecutions := range byCommit {
+			sort.Slice(commitExecutions, func(i, j int) bool {
+				return commitExecutions[i].StartedAt.Before(commitExecutions[j].StartedAt)
+			})
+			flips := 0
+			for i := 1; i < len(commitExecutions); i++ {
+				if commitExecutions[i].Conclusion != commitExecutions[i-1].Conclusion {
+					flips++
+				}
+			}
+			if flips == 0 {
+				continue
+			}
+			result.FlakyCommits++
+			result.Flips += flips
+			result.Examples = append(result.Examples, &flakyExample{HeadSHA: sha, Executions: commitExecutions})
+		}
+		if result.FlakyCommits == 0 {
+			continue
+		}
+		result.Score = float64(result.FlakyCommits) / float64(result.Commits) * 100
+		sort.Slice(result.Examples, func(i, j int) bool {
+			return result.Examples[i].Executions[0].StartedAt.After(result.Examples[j].Executions[0].StartedAt)
+		})
+		if len(result.Examples) > maxFlakyExamples {
+			result.Examples = result.Examples[:maxFlakyExamples]
+		}
+
+		if key.step == "" {
+			report.Jobs = append(report.Jobs, result)
+		} else {
+			report.Steps = append(report.Steps, result)
+		}
+	}
+
+	sortFlakyResults(report.Jobs)
+	sortFlakyResults(report.Steps)
+	return report
+}
+
+// sortFlakyResults sorts the flakiest results first
+func sortFlakyResults(results []*flakyResult) {
+	sort.Slice(results, func(i, j int) bool {
+		if results[i].Score != results[j].Score {
+			return results[i].Score > results[j].Score
+		}
+		if results[i].FlakyCommits != results[j].FlakyCommits {
+			return results[i].FlakyCommits > results[j].FlakyCommits
+		}
+		return results[i].Name() < results[j].Name()
+	})
+}
+
+// Name is the display name of the flaky job or step
+func (f *flakyResult) Name() string {
+	name := fmt.Sprintf("%s / %s", f.Workflow, f.Job)
+	if f.Step != "" {
+		name = fmt.Sprintf("%s / %s", name, f.Step)
+	}
+	return name
+}
+
+// ShortSHA is the abbreviated commit SHA
+func (e *flakyExample) ShortSHA() string {
+	if len(e.HeadSHA) > 7 {
+		return e.HeadSHA[:7]
+	}
+	return e.HeadSHA
+}
+
+func flakyRenderMarkdown(report *flakyReport) string {
+	var md strings.Builder
+
+	md.WriteString("# Flaky Jobs and Steps\n\n")
+	fmt.Fprintf(&md, "Analyzed **%d** runs of `%s/%s`", report.RunCount, report.Owner, report.Repo)
+	if report.Workflow != "" {
+		fmt.Fprintf(&md, " for workflow `%s`", report.Workflow)
+	}
+	if report.Branch != "" {
+		fmt.Fprintf(&md, " on branch `%s`", report.Branch)
+	}
+	fmt.Fprintf(&md, ", found **%d** flaky jobs and **%d** flaky steps\n", len(report.Jobs), len(report.Steps))
+
+	for _, section := range []struct {
+		title   string
+		results []*flakyResult
+	}{
+		{"Jobs", report.Jobs},
+		{"Steps", report.Steps},
+	} {
+		fmt.Fprintf(&md, "\n## %s\n\n", section.title)
+		if len(section.results) == 0 {
+			md.WriteString("None found\n")
+			continue
+		}
+		md.WriteString("| Name | Score | Flaky Commits | Flips | Examples |\n")
+		md.WriteString("|---|---|---|---|---|\n")
+		for _, result := range section.results {
+			examples := make([]string, 0, len(result.Examples))
+			for _, example := range result.Examples {
+				runs := make([]string, 0, len(example.Executions))
+				for _, execution := range example.Executions {
+					runs = append(runs, fmt.Sprintf("[%s](%s)", execution.Conclusion, execution.URL))
+				}
+				examples = append(examples, fmt.Sprintf("`%s`: %s", example.ShortSHA(), strings.Join(runs, " → ")))
+			}
+			fmt.Fprintf(&md, "| %s | %.1f%% | %d/%d | %d | %s |\n",
+				result.Name(), result.Score, result.FlakyCommits, result.Commits, result.Flips, strings.Join(examples, "<br>"),
+			)
+		}
+	}
+	return md.String()
+}
+
+func flakyRenderHTML(report *flakyReport) (string, error) {
+	tmpl, err := htmlTemplate.New("flaky").ParseFiles(filepath.Join(templatesDir, "flaky.html"))
+	if err != nil {
+		return "", fmt.Errorf("failed to parse HTML template: %w", err)
+	}
+
+	var html bytes.Buffer
+	err = tmpl.Execute(&html, report)
+	if err != nil {
+		return "", fmt.Errorf("failed to execute HTML template: %w", err)
+	}
+	return html.String(), nil
+}
+
+func flakyRenderJSON(report *flakyReport) (string, error) {
+	data, err := json.MarshalIndent(report, "", "  ")
+	if err != nil {
+		return "", err
+	}
+	return string(data), nil
+}
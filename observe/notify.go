@@ -0,0 +1,361 @@
+package observe
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"slices"
+	"sort"
+	"strings"
+	textTemplate "text/template"
+	"time"
+
+	"github.com/google/go-github/v70/github"
+	"github.com/kalverra/workflow-metrics/gather"
+	"github.com/rs/zerolog/log"
+)
+
+// webhookTimeout is how long to wait for a chat webhook to accept a message
+const webhookTimeout = 10 * time.Second
+
+// Kinds of chat webhooks that can be notified
+const (
+	NotifySlack = "slack"
+	NotifyTeams = "teams"
+)
+
+// NotifyKinds are all the kinds of chat webhooks that can be notified
+var NotifyKinds = []string{NotifySlack, NotifyTeams}
+
+var (
+	// slackTextEscaper escapes the control characters of Slack's mrkdwn in text. Slack has no escape for |, which
+	// would end link text, so it's swapped for a look-alike.
+	slackTextEscaper = strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;", "|", "∣")
+	// slackURLEscaper escapes the control characters of Slack's mrkdwn in link URLs
+	slackURLEscaper = strings.NewReplacer("&", "&amp;", "<", "%3C", ">", "%3E", "|", "%7C")
+)
+
+// failedConclusions are the conclusions of jobs and runs that count as failures in notifications
+var failedConclusions = []string{"failure", "timed_out", "startup_failure"}
+
+// notifyRunTemplate is the default message for a workflow run
+var notifyRunTemplate = `{{ if .Failed }}❌{{ else }}✅{{ end }} {{ bold (printf "%s #%d" .Name .Number) }} {{ escape .Conclusion }} on {{ escape .Branch }} in {{ escape .Owner }}/{{ escape .Repo }}
+Duration: {{ .Duration }} | Cost: {{ .Cost }} | {{ link .URL "View run" }}{{ if .ReportURL }} | {{ link .ReportURL "Report" }}{{ end }}
+{{- if .FailedJobs }}
+Failed jobs:
+{{- range .FailedJobs }}
+• {{ link .URL .Name }} ({{ escape .Conclusion }})
+{{- end }}
+{{- end }}
+`
+
+// notifyDigestTemplate is the default message for a digest of workflow runs
+var notifyDigestTemplate = `📊 {{ bold "CI health" }} for {{ escape .Owner }}/{{ escape .Repo }}{{ if .Workflow }} {{ escape .Workflow }}{{ end }}{{ if .Branch }} on {{ escape .Branch }}{{ end }} since {{ .Since.Format "2006-01-02 15:04 MST" }}
+Runs: {{ .Runs }} | Success rate: {{ printf "%.1f" .SuccessRate }}% | Avg duration: {{ .AvgDuration }} | Cost: {{ .Cost }}{{ if .ReportURL }} | {{ link .ReportURL "Report" }}{{ end }}
+{{- if .FailedRuns }}
+Failed runs:
+{{- range .FailedRuns }}
+• {{ link .URL (printf "%s #%d" .Name .Number) }} on {{ escape .Branch }}{{ if .FailedJobs }}: {{ range $i, $job := .FailedJobs }}{{ if $i }}, {{ end }}{{ escape $job.Name }}{{ end }}{{ end }}
+{{- end }}
+{{- end }}
+`
+
+// Notifier posts summaries of workflow runs to a chat webhook
+type Notifier struct {
+	// Kind is the kind of chat webhook, slack or teams
+	Kind       string
+	WebhookURL string
+	// Template is a text/template file for the message, instead of the default
+	Template string
+	// ReportURL links to the HTML report, e.g. where observe output is published
+	ReportURL string
+}
+
+// notifyRun summarizes a workflow run for a notification
+type notifyRun struct {
+	Owner      string
+	Repo       string
+	ID         int64
+	Name       string
+	Number     int
+	URL        string
+	Branch     string
+	Event      string
+	Conclusion string
+	Failed     bool
+	Duration   time.Duration
+	Cost       string
+	FailedJobs []notifyJob
+	ReportURL  string
+}
+
+// notifyJob is a failed job of a workflow run
+type notifyJob struct {
+	Name       string
+	URL        string
+	Conclusion string
+}
+
+// notifyDigest summarizes many workflow runs for a notification
+type notifyDigest struct {
+	Owner       string
+	Repo        string
+	Workflow    string
+	Branch      string
+	Since       time.Time
+	Until       time.Time
+	Runs        int
+	Successes   int
+	SuccessRate float64
+	AvgDuration time.Duration
+	Cost        string
+	FailedRuns  []*notifyRun
+	ReportURL   string
+}
+
+// NotifyWorkflowRun posts a summary of a workflow run's duration, cost, and failed jobs
+func NotifyWorkflowRun(client *github.Client, notifier Notifier, owner, repo string, workflowRunID int64) error {
+	workflowRun, err := gather.WorkflowRun(client, owner, repo, workflowRunID, false)
+	if err != nil {
+		return err
+	}
+
+	startTime := time.Now()
+	run := buildNotifyRun(owner, repo, workflowRun)
+	run.ReportURL = notifier.ReportURL
+	if err := notifier.post(notifyRunTemplate, run, fmt.Sprintf("%s #%d %s", run.Name, run.Number, run.Conclusion)); err != nil {
+		return err
+	}
+
+	log.Info().
+		Int64("workflow_run_id", workflowRunID).
+		Str("kind", notifier.Kind).
+		Int("failed_job_count", len(run.FailedJobs)).
+		Str("duration", time.Since(startTime).String()).
+		Msg("Notified workflow run")
+	return nil
+}
+
+// NotifyDigest posts a digest of the locally gathered runs created between since and until, e.g. a daily CI health
+// summary
+func NotifyDigest(notifier Notifier, owner, repo, workflow, branch string, since, until time.Time) error {
+	workflowRuns, err := gather.LocalWorkflowRuns(owner, repo)
+	if err != nil {
+		return err
+	}
+
+	var (
+		startTime     = time.Now()
+		totalCost     int64
+		totalDuration time.Duration
+		digest        = &notifyDigest{
+			Owner:     owner,
+			Repo:      repo,
+			Workflow:  workflow,
+			Branch:    branch,
+			Since:     since,
+			Until:     until,
+			ReportURL: notifier.ReportURL,
+		}
+	)
+	for _, workflowRun := range workflowRuns {
+		created := workflowRun.GetCreatedAt().Time
+		if created.Before(since) || !created.Before(until) || workflowRun.Partial ||
+			!matchesWorkflow(workflowRun, workflow) || (branch != "" && workflowRun.GetHeadBranch() != branch) {
+			continue
+		}
+
+		run := buildNotifyRun(owner, repo, workflowRun)
+		digest.Runs++
+		totalDuration += run.Duration
+		for _, job := range workflowRun.Jobs {
+			totalCost += job.Cost
+		}
+		if workflowRun.GetConclusion() == "success" {
+			digest.Successes++
+		}
+		if run.Failed {
+			digest.FailedRuns = append(digest.FailedRuns, run)
+		}
+	}
+	if digest.Runs > 0 {
+		digest.SuccessRate = float64(digest.Successes) / float64(digest.Runs) * 100
+		digest.AvgDuration = (totalDuration / time.Duration(digest.Runs)).Round(time.Second)
+	}
+	digest.Cost = formatCost(float64(totalCost))
+	// Most recent failures first
+	sort.Slice(digest.FailedRuns, func(i, j int) bool {
+		return digest.FailedRuns[i].ID > digest.FailedRuns[j].ID
+	})
+
+	if err := notifier.post(notifyDigestTemplate, digest, fmt.Sprintf("CI health for %s/%s", owner, repo)); err != nil {
+		return err
+	}
+
+	log.Info().
+		Str("workflow", workflow).
+		Str("branch", branch).
+		Str("kind", notifier.Kind).
+		Int("workflow_run_count", digest.Runs).
+		Int("failed_run_count", len(digest.FailedRuns)).
+		Str("duration", time.Since(startTime).String()).
+		Msg("Notified digest")
+	return nil
+}
+
+func buildNotifyRun(owner, repo string, workflowRun *gather.WorkflowRunData) *notifyRun {
+	run := &notifyRun{
+		Owner:      owner,
+		Repo:       repo,
+		ID:         workflowRun.GetID(),
+		Name:       workflowRun.GetName(),
+		Number:     workflowRun.GetRunNumber(),
+		URL:        workflowRun.GetHTMLURL(),
+		Branch:     workflowRun.GetHeadBranch(),
+		Event:      workflowRun.GetEvent(),
+		Conclusion: workflowRun.GetConclusion(),
+		Failed:     slices.Contains(failedConclusions, workflowRun.GetConclusion()),
+		Duration:   workflowRunDuration(workflowRun).Round(time.Second),
+	}
+	var cost int64
+	for _, job := range workflowRun.Jobs {
+		cost += job.Cost
+		if slices.Contains(failedConclusions, job.GetConclusion()) {
+			run.FailedJobs = append(run.FailedJobs, notifyJob{
+				Name:       job.GetName(),
+				URL:        job.GetHTMLURL(),
+				Conclusion: job.GetConclusion(),
+			})
+		}
+	}
+	run.Cost = formatCost(float64(cost))
+	return run
+}
+
+// render executes the notifier's template, or the default one, with data. Templates can use link and bold to format
+// for the kind of webhook, and escape to escape any other field, so names like <!channel> can't ping the channel.
+func (n Notifier) render(defaultTemplate string, data any) (string, error) {
+	text := defaultTemplate
+	if n.Template != "" {
+		custom, err := os.ReadFile(n.Template)
+		if err != nil {
+			return "", fmt.Errorf("failed to read message template '%s': %w", n.Template, err)
+		}
+		text = string(custom)
+	}
+
+	funcs := textTemplate.FuncMap{
+		"escape": func(text string) string {
+			if n.Kind == NotifyTeams {
+				return text
+			}
+			return slackTextEscaper.Replace(text)
+		},
+		"link": func(url, text string) string {
+			switch {
+			case url == "" && n.Kind == NotifyTeams:
+				return text
+			case url == "":
+				return slackTextEscaper.Replace(text)
+			case n.Kind == NotifyTeams:
+				return fmt.Sprintf("[%s](%s)", text, url)
+			default:
+				return fmt.Sprintf("<%s|%s>", slackURLEscaper.Replace(url), slackTextEscaper.Replace(text))
+			}
+		},
+		"bold": func(text string) string {
+			if n.Kind == NotifyTeams {
+				return "**" + text + "**"
+			}
+			return "*" + slackTextEscaper.Replace(text) + "*"
+		},
+	}
+	tmpl, err := textTemplate.New("notify").Funcs(funcs).Parse(text)
+	if err != nil {
+		return "", fmt.Errorf("failed to parse message template: %w", err)
+	}
+	var message bytes.Buffer
+	if err := tmpl.Execute(&message, data); err != nil {
+		return "", fmt.Errorf("failed to execute message template: %w", err)
+	}
+	return message.String(), nil
+}
+
+// post renders a message and posts it to the webhook in the shape its kind expects
+func (n Notifier) post(defaultTemplate string, data any, summary string) error {
+	message, err := n.render(defaultTemplate, data)
+	if err != nil {
+		return err
+	}
+
+	var payload any
+	switch n.Kind {
+	case NotifySlack:
+		payload = map[string]string{"text": message}
+	case NotifyTeams:
+		payload = teamsCard(message, summary)
+	default:
+		return fmt.Errorf("unknown webhook kind '%s', must be one of %s", n.Kind, strings.Join(NotifyKinds, ", "))
+	}
+	if err := postWebhook(n.WebhookURL, payload); err != nil {
+		return fmt.Errorf("failed to post notification: %w", err)
+	}
+	return nil
+}
+
+// teamsCard wraps a message in the Adaptive Card message Teams webhooks expect, with a text block per line, as text
+// blocks only show markdown within a line
+func teamsCard(message, summary string) map[string]any {
+	body := []map[string]any{}
+	for _, line := range strings.Split(strings.TrimSpace(message), "\n") {
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+		body = append(body, map[string]any{
+			"type": "TextBlock",
+			"text": line,
+			"wrap": true,
+		})
+	}
+	return map[string]any{
+		"type": "message",
+		"attachments": []map[string]any{{
+			"contentType": "application/vnd.microsoft.card.adaptive",
+			"content": map[string]any{
+				"$schema":      "http://adaptivecards.io/schemas/adaptive-card.json",
+				"type":         "AdaptiveCard",
+				"version":      "1.4",
+				"fallbackText": summary,
+				"body":         body,
+			},
+		}},
+	}
+}
+
+// postWebhook posts a JSON payload to an incoming webhook
+func postWebhook(webhookURL string, payload any) error {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), webhookTimeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, webhookURL, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("failed to create webhook request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("webhook responded %s", resp.Status)
+	}
+	return nil
+}
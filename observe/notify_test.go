@@ -0,0 +1,158 @@
+package observe
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newTestWebhook serves an incoming webhook that responds with status, sending every posted body to the channel
+func newTestWebhook(t *testing.T, status int) (string, <-chan []byte) {
+	t.Helper()
+
+	posted := make(chan []byte, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "application/json", r.Header.Get("Content-Type"), "wrong content type")
+		body, err := io.ReadAll(r.Body)
+		assert.NoError(t, err, "failed to read posted body")
+		posted <- body
+		w.WriteHeader(status)
+	}))
+	t.Cleanup(server.Close)
+	return server.URL, posted
+}
+
+func testNotifyRun() *notifyRun {
+	return &notifyRun{
+		Owner:      "kalverra",
+		Repo:       "workflow-metrics",
+		ID:         1,
+		Name:       "CI <main> & friends",
+		Number:     7,
+		URL:        "https://github.com/kalverra/workflow-metrics/actions/runs/1?a=1&b=2",
+		Branch:     "<!channel>",
+		Conclusion: "failure",
+		Failed:     true,
+		Duration:   90 * time.Second,
+		Cost:       "$0.016",
+		FailedJobs: []notifyJob{
+			{Name: "test | unit", URL: "https://github.com/kalverra/workflow-metrics/actions/runs/1/job/2", Conclusion: "failure"},
+		},
+	}
+}
+
+func TestNotifierPost(t *testing.T) {
+	t.Parallel()
+
+	t.Run("slack", func(t *testing.T) {
+		t.Parallel()
+
+		url, posted := newTestWebhook(t, http.StatusOK)
+		notifier := Notifier{Kind: NotifySlack, WebhookURL: url}
+		require.NoError(t, notifier.post(notifyRunTemplate, testNotifyRun(), "summary"), "failed to post")
+
+		var payload map[string]string
+		require.NoError(t, json.Unmarshal(<-posted, &payload), "failed to decode posted payload")
+		require.Len(t, payload, 1, "slack payload should only have text")
+		assert.Equal(t, `❌ *CI &lt;main&gt; &amp; friends #7* failure on &lt;!channel&gt; in kalverra/workflow-metrics
+Duration: 1m30s | Cost: $0.016 | <https://github.com/kalverra/workflow-metrics/actions/runs/1?a=1&amp;b=2|View run>
+Failed jobs:
+• <https://github.com/kalverra/workflow-metrics/actions/runs/1/job/2|test ∣ unit> (failure)
+`, payload["text"], "wrong slack message")
+	})
+
+	t.Run("teams", func(t *testing.T) {
+		t.Parallel()
+
+		url, posted := newTestWebhook(t, http.StatusAccepted)
+		notifier := Notifier{Kind: NotifyTeams, WebhookURL: url}
+		require.NoError(t, notifier.post(notifyRunTemplate, testNotifyRun(), "CI #7 failure"), "failed to post")
+
+		assert.JSONEq(t, `{
+			"type": "message",
+			"attachments": [{
+				"contentType": "application/vnd.microsoft.card.adaptive",
+				"content": {
+					"$schema": "http://adaptivecards.io/schemas/adaptive-card.json",
+					"type": "AdaptiveCard",
+					"version": "1.4",
+					"fallbackText": "CI #7 failure",
+					"body": [
+						{"type": "TextBlock", "wrap": true, "text": "❌ **CI <main> & friends #7** failure on <!channel> in kalverra/workflow-metrics"},
+						{"type": "TextBlock", "wrap": true, "text": "Duration: 1m30s | Cost: $0.016 | [View run](https://github.com/kalverra/workflow-metrics/actions/runs/1?a=1&b=2)"},
+						{"type": "TextBlock", "wrap": true, "text": "Failed jobs:"},
+						{"type": "TextBlock", "wrap": true, "text": "• [test | unit](https://github.com/kalverra/workflow-metrics/actions/runs/1/job/2) (failure)"}
+					]
+				}
+			}]
+		}`, string(<-posted), "wrong teams card")
+	})
+
+	t.Run("custom template", func(t *testing.T) {
+		t.Parallel()
+
+		template := filepath.Join(t.TempDir(), "message.tmpl")
+		require.NoError(t, os.WriteFile(template, []byte(`{{ bold .Repo }} run {{ .Number }} took {{ .Duration }}: {{ link .URL "details" }}`), 0600))
+		url, posted := newTestWebhook(t, http.StatusOK)
+		notifier := Notifier{Kind: NotifySlack, WebhookURL: url, Template: template}
+		require.NoError(t, notifier.post(notifyRunTemplate, testNotifyRun(), "summary"), "failed to post")
+
+		var payload map[string]string
+		require.NoError(t, json.Unmarshal(<-posted, &payload), "failed to decode posted payload")
+		assert.Equal(t,
+			"*workflow-metrics* run 7 took 1m30s: <https://github.com/kalverra/workflow-metrics/actions/runs/1?a=1&amp;b=2|details>",
+			payload["text"], "wrong custom message",
+		)
+	})
+
+	t.Run("webhook error", func(t *testing.T) {
+		t.Parallel()
+
+		url, posted := newTestWebhook(t, http.StatusBadRequest)
+		notifier := Notifier{Kind: NotifySlack, WebhookURL: url}
+		err := notifier.post(notifyRunTemplate, testNotifyRun(), "summary")
+		require.Error(t, err, "expected error when the webhook doesn't accept the message")
+		assert.Contains(t, err.Error(), "400", "error should have the webhook's status")
+		<-posted
+	})
+
+	t.Run("unknown kind", func(t *testing.T) {
+		t.Parallel()
+
+		notifier := Notifier{Kind: "discord", WebhookURL: "http://localhost:1"}
+		require.Error(t, notifier.post(notifyRunTemplate, testNotifyRun(), "summary"), "expected error for unknown kind")
+	})
+}
+
+func TestNotifierRenderDigestEscapes(t *testing.T) {
+	t.Parallel()
+
+	digest := &notifyDigest{
+		Owner:       "kalverra",
+		Repo:        "workflow-metrics",
+		Workflow:    "CI & <release>",
+		Branch:      "<!channel>",
+		Since:       time.Date(2025, time.January, 1, 0, 0, 0, 0, time.UTC),
+		Runs:        2,
+		SuccessRate: 50,
+		AvgDuration: time.Minute,
+		Cost:        "$0.032",
+		FailedRuns:  []*notifyRun{testNotifyRun()},
+	}
+	message, err := Notifier{Kind: NotifySlack}.render(notifyDigestTemplate, digest)
+	require.NoError(t, err, "failed to render digest")
+	assert.Equal(t, `📊 *CI health* for kalverra/workflow-metrics CI &amp; &lt;release&gt; on &lt;!channel&gt; since 2025-01-01 00:00 UTC
+Runs: 2 | Success rate: 50.0% | Avg duration: 1m0s | Cost: $0.032
+Failed runs:
+• <https://github.com/kalverra/workflow-metrics/actions/runs/1?a=1&amp;b=2|CI &lt;main&gt; &amp; friends #7> on &lt;!channel&gt;: test ∣ unit
+`,
+		message, "every field should be escaped")
+}
@@ -1,12 +1,37 @@
 package observe
 
-import "time"
+import (
+	"time"
+
+	"github.com/kalverra/workflow-metrics/store"
+)
 
 const (
-	outputDir    = "observe_output"
 	templatesDir = "observe/templates"
+
+	// githubStepSummaryEnvVar is set by GitHub Actions to the file that holds the current job's summary
+	githubStepSummaryEnvVar = "GITHUB_STEP_SUMMARY"
+	// stepSummaryMaxSteps is the number of slowest steps shown in a job summary
+	stepSummaryMaxSteps = 10
 )
 
+// dataStore is where observations are written to
+var dataStore store.Store = store.NewFileSystem("data", "observe_output")
+
+// SetStore sets where observations are written to
+func SetStore(s store.Store) {
+	dataStore = s
+}
+
+// writeObservation stores a rendered observation, returning where it was stored
+func writeObservation(owner, repo, name, rendered string) (string, error) {
+	err := dataStore.Put(owner, repo, store.Observations, name, []byte(rendered))
+	if err != nil {
+		return "", err
+	}
+	return dataStore.Location(owner, repo, store.Observations, name), nil
+}
+
 func determineDateFormat(start, end time.Time) (mermaidDateFormat, mermaidAxisFormat, goDateFormat string) {
 	diff := end.Sub(start)
 	if diff.Hours() > 24 {
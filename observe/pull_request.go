@@ -0,0 +1,221 @@
+package observe
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/google/go-github/v70/github"
+	"github.com/kalverra/workflow-metrics/gather"
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	// pullRequestCommentMarker identifies the sticky comment workflow-metrics maintains on a pull request
+	pullRequestCommentMarker = "<!-- workflow-metrics:pull-request-summary -->"
+	// pullRequestMaxSlowJobs is the number of slowest jobs shown in a pull request comment
+	pullRequestMaxSlowJobs = 5
+)
+
+// markdownCellEscaper escapes workflow and job names for markdown table cells and link text, so names with |, ], or
+// other markdown can't break out of them
+var markdownCellEscaper = strings.NewReplacer(
+	`\`, `\\`, "|", `\|`, "[", `\[`, "]", `\]`, "*", `\*`, "_", `\_`, "`", "\\`", "<", "&lt;", ">", "&gt;", "\n", " ",
+)
+
+// PullRequestComment summarizes all CI runs of a pull request and creates or updates a single sticky comment
+// on it with the summary
+func PullRequestComment(client *github.Client, owner, repo string, pullRequestNumber int) error {
+	startTime := time.Now()
+
+	// Comment with the workflow runs that could be gathered, rather than none at all
+	pullRequest, err := gather.PullRequest(client, owner, repo, pullRequestNumber, false)
+	if pullRequest == nil {
+		return err
+	}
+	if err != nil {
+		log.Warn().Err(err).Int("pull_request_number", pullRequestNumber).Msg("Commenting without some workflow runs")
+	}
+	baseRuns, err := gather.LocalWorkflowRuns(owner, repo)
+	if err != nil {
+		return err
+	}
+
+	body := pullRequestRenderMarkdown(pullRequest, baseRuns)
+	commentID, err := upsertStickyComment(client, owner, repo, pullRequestNumber, body)
+	if err != nil {
+		return fmt.Errorf("failed to comment on pull request '%d': %w", pullRequestNumber, err)
+	}
+
+	log.Info().
+		Int("pull_request_number", pullRequestNumber).
+		Int64("comment_id", commentID).
+		Int("workflow_run_count", len(pullRequest.WorkflowRuns)).
+		Str("duration", time.Since(startTime).String()).
+		Msg("Commented on pull request")
+	return nil
+}
+
+// pullRequestWorkflowSummary compares the latest run of a workflow on a pull request to its base branch
+type pullRequestWorkflowSummary struct {
+	Name             string
+	Runs             int
+	Latest           *gather.WorkflowRunData
+	Duration         delta
+	Cost             delta
+	BaseRunsCompared int
+}
+
+func pullRequestRenderMarkdown(pullRequest *gather.PullRequestData, baseRuns []*gather.WorkflowRunData) string {
+	var (
+		md        strings.Builder
+		summaries = summarizePullRequestWorkflows(pullRequest, baseRuns)
+		totalCost int64
+		slowJobs  = []*gather.JobsData{}
+		start     time.Time
+		end       time.Time
+	)
+
+	for _, workflowRun := range pullRequest.WorkflowRuns {
+		if runStart := workflowRun.GetRunStartedAt().Time; start.IsZero() || runStart.Before(start) {
+			start = runStart
+		}
+		if runEnd := workflowRun.GetUpdatedAt().Time; runEnd.After(end) {
+			end = runEnd
+		}
+		for _, job := range workflowRun.Jobs {
+			totalCost += job.Cost
+		}
+	}
+	for _, summary := range summaries {
+		slowJobs = append(slowJobs, summary.Latest.Jobs...)
+	}
+	sort.Slice(slowJobs, func(i, j int) bool {
+		return jobDuration(slowJobs[i]) > jobDuration(slowJobs[j])
+	})
+	if len(slowJobs) > pullRequestMaxSlowJobs {
+		slowJobs = slowJobs[:pullRequestMaxSlowJobs]
+	}
+
+	md.WriteString(pullRequestCommentMarker + "\n")
+	md.WriteString("## CI Metrics\n\n")
+	fmt.Fprintf(&md, "**%d** runs across **%d** workflows | **Wall Time:** %s | **Total Cost:** %s\n\n",
+		len(pullRequest.WorkflowRuns), len(summaries), end.Sub(start).String(), formatCost(float64(totalCost)),
+	)
+
+	fmt.Fprintf(&md, "### Latest Runs vs `%s` Median\n\n", pullRequest.GetBase().GetRef())
+	md.WriteString("| Workflow | Runs | Duration | Duration Change | Cost | Cost Change |\n")
+	md.WriteString("|---|---|---|---|---|---|\n")
+	for _, summary := range summaries {
+		durationChange, costChange := "n/a", "n/a"
+		if summary.BaseRunsCompared > 0 {
+			durationChange, costChange = formatDurationDelta(summary.Duration), formatCostDelta(summary.Cost)
+		}
+		fmt.Fprintf(&md, "| [%s](%s) | %d | %s | %s | %s | %s |\n",
+			markdownCellEscaper.Replace(summary.Name), summary.Latest.GetHTMLURL(), summary.Runs,
+			formatSeconds(summary.Duration.Head), durationChange,
+			formatCost(summary.Cost.Head), costChange,
+		)
+	}
+
+	fmt.Fprintf(&md, "\n### Slowest %d Jobs\n\n", len(slowJobs))
+	md.WriteString("| Job | Duration | Cost |\n")
+	md.WriteString("|---|---|---|\n")
+	for _, job := range slowJobs {
+		fmt.Fprintf(&md, "| [%s](%s) | %s | %s |\n", markdownCellEscaper.Replace(job.GetName()), job.GetHTMLURL(), jobDuration(job).String(), formatCost(float64(job.Cost)))
+	}
+	return md.String()
+}
+
+// summarizePullRequestWorkflows compares the latest run of each workflow on the pull request to the median
+// of gathered runs of that workflow on the base branch
+func summarizePullRequestWorkflows(pullRequest *gather.PullRequestData, baseRuns []*gather.WorkflowRunData) []*pullRequestWorkflowSummary {
+	var (
+		byWorkflow = map[string]*pullRequestWorkflowSummary{}
+		summaries  = []*pullRequestWorkflowSummary{}
+		baseBranch = pullRequest.GetBase().GetRef()
+	)
+
+	for _, workflowRun := range pullRequest.WorkflowRuns {
+		name := workflowRun.GetName()
+		summary, ok := byWorkflow[name]
+		if !ok {
+			summary = &pullRequestWorkflowSummary{Name: name}
+			byWorkflow[name] = summary
+			summaries = append(summaries, summary)
+		}
+		summary.Runs++
+		if summary.Latest == nil || workflowRun.GetCreatedAt().After(summary.Latest.GetCreatedAt().Time) {
+			summary.Latest = workflowRun
+		}
+	}
+
+	for _, summary := range summaries {
+		var baseDurations, baseCosts []float64
+		for _, baseRun := range baseRuns {
+			if baseRun.GetName() != summary.Name || baseRun.GetHeadBranch() != baseBranch || baseRun.GetEvent() == "pull_request" {
+				continue
+			}
+			baseDurations = append(baseDurations, workflowRunDuration(baseRun).Seconds())
+			baseCosts = append(baseCosts, float64(workflowRunCost(baseRun)))
+		}
+		summary.BaseRunsCompared = len(baseDurations)
+		summary.Duration = delta{Base: percentile(baseDurations, 50), Head: workflowRunDuration(summary.Latest).Seconds()}
+		summary.Cost = delta{Base: percentile(baseCosts, 50), Head: float64(workflowRunCost(summary.Latest))}
+	}
+
+	sort.Slice(summaries, func(i, j int) bool { return summaries[i].Name < summaries[j].Name })
+	return summaries
+}
+
+// workflowRunCost is the total cost of all jobs in a workflow run in tenths of a cent
+func workflowRunCost(workflowRun *gather.WorkflowRunData) int64 {
+	var cost int64
+	for _, job := range workflowRun.Jobs {
+		cost += job.Cost
+	}
+	return cost
+}
+
+// upsertStickyComment updates the pull request comment holding the sticky marker, or creates it if it doesn't exist
+func upsertStickyComment(client *github.Client, owner, repo string, pullRequestNumber int, body string) (int64, error) {
+	listOpts := &github.IssueListCommentsOptions{
+		ListOptions: github.ListOptions{PerPage: 100},
+	}
+
+	for { // Paginate through all comments looking for our marker
+		ctx, cancel := gather.APIContext()
+		comments, resp, err := client.Issues.ListComments(ctx, owner, repo, pullRequestNumber, listOpts)
+		cancel()
+		if err != nil {
+			return 0, fmt.Errorf("failed to list comments: %w", err)
+		}
+		for _, comment := range comments {
+			if !strings.Contains(comment.GetBody(), pullRequestCommentMarker) {
+				continue
+			}
+			ctx, cancel := gather.APIContext()
+			edited, _, err := client.Issues.EditComment(ctx, owner, repo, comment.GetID(), &github.IssueComment{Body: github.Ptr(body)})
+			cancel()
+			if err != nil {
+				return 0, fmt.Errorf("failed to update comment '%d': %w", comment.GetID(), err)
+			}
+			log.Debug().Int64("comment_id", edited.GetID()).Msg("Updated sticky pull request comment")
+			return edited.GetID(), nil
+		}
+		if resp.NextPage == 0 {
+			break
+		}
+		listOpts.Page = resp.NextPage
+	}
+
+	ctx, cancel := gather.APIContext()
+	created, _, err := client.Issues.CreateComment(ctx, owner, repo, pullRequestNumber, &github.IssueComment{Body: github.Ptr(body)})
+	cancel()
+	if err != nil {
+		return 0, fmt.Errorf("failed to create comment: %w", err)
+	}
+	log.Debug().Int64("comment_id", created.GetID()).Msg("Created sticky pull request comment")
+	return created.GetID(), nil
+}
@@ -0,0 +1,42 @@
+package observe
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/go-github/v70/github"
+	"github.com/kalverra/workflow-metrics/gather"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPullRequestRenderMarkdownEscapesNames(t *testing.T) {
+	t.Parallel()
+
+	var (
+		started   = time.Date(2025, time.January, 1, 12, 0, 0, 0, time.UTC)
+		completed = started.Add(time.Minute)
+	)
+	pullRequest := &gather.PullRequestData{
+		PullRequest: &github.PullRequest{Base: &github.PullRequestBranch{Ref: github.Ptr("main")}},
+		WorkflowRuns: []*gather.WorkflowRunData{{
+			WorkflowRun: &github.WorkflowRun{
+				Name:         github.Ptr("CI | [nightly]"),
+				HTMLURL:      github.Ptr("https://github.com/kalverra/workflow-metrics/actions/runs/1"),
+				RunStartedAt: &github.Timestamp{Time: started},
+				UpdatedAt:    &github.Timestamp{Time: completed},
+			},
+			Jobs: []*gather.JobsData{{WorkflowJob: &github.WorkflowJob{
+				Name:        github.Ptr("test (*_linux_*) <arm>"),
+				HTMLURL:     github.Ptr("https://github.com/kalverra/workflow-metrics/actions/runs/1/job/2"),
+				StartedAt:   &github.Timestamp{Time: started},
+				CompletedAt: &github.Timestamp{Time: completed},
+			}}},
+		}},
+	}
+
+	md := pullRequestRenderMarkdown(pullRequest, nil)
+	assert.Contains(t, md, `| [CI \| \[nightly\]](https://github.com/kalverra/workflow-metrics/actions/runs/1) | 1 |`,
+		"workflow name should be escaped in its table cell and link text")
+	assert.Contains(t, md, `| [test (\*\_linux\_\*) &lt;arm&gt;](https://github.com/kalverra/workflow-metrics/actions/runs/1/job/2) | 1m0s |`,
+		"job name should be escaped in its table cell and link text")
+}
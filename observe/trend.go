@@ -0,0 +1,403 @@
+package observe
+
+import (
+	"bytes"
+	"fmt"
+	htmlTemplate "html/template"
+	"math"
+	"path/filepath"
+	"sort"
+	"strings"
+	textTemplate "text/template"
+	"time"
+
+	"github.com/kalverra/workflow-metrics/gather"
+	"github.com/rs/zerolog/log"
+)
+
+const trendDateFormat = "2006-01-02"
+
+// WorkflowTrend builds a report of how a workflow's jobs, cost, success rate, and queue times change over time
+// using all locally gathered runs of the workflow. workflow matches the workflow's name, path, or file name.
+// An empty branch includes runs from all branches.
+func WorkflowTrend(owner, repo, workflow, branch string, outputTypes []string) error {
+	workflowRuns, err := gather.LocalWorkflowRuns(owner, repo)
+	if err != nil {
+		return err
+	}
+
+	var (
+		startTime   = time.Now()
+		outputFiles = make([]string, 0, len(outputTypes))
+		filtered    = make([]*gather.WorkflowRunData, 0, len(workflowRuns))
+	)
+	for _, workflowRun := range workflowRuns {
+		if matchesWorkflow(workflowRun, workflow) && (branch == "" || workflowRun.GetHeadBranch() == branch) {
+			filtered = append(filtered, workflowRun)
+		}
+	}
+	if len(filtered) == 0 {
+		return fmt.Errorf("no gathered runs found for workflow '%s' on branch '%s', gather some runs first", workflow, branch)
+	}
+
+	trend := buildTrendReport(filtered)
+	trend.Owner, trend.Repo, trend.Workflow, trend.Branch = owner, repo, workflow, branch
+	trend.Charts, err = trendCharts(trend)
+	if err != nil {
+		return err
+	}
+
+	targetName := fmt.Sprintf("trend_%s", fileSafeName(workflow))
+	if branch != "" {
+		targetName = fmt.Sprintf("%s_%s", targetName, fileSafeName(branch))
+	}
+	for _, outputType := range outputTypes {
+		var rendered string
+		switch outputType {
+		case "html":
+			rendered, err = trendRenderHTML(trend)
+			if err != nil {
+				return fmt.Errorf("failed to render HTML: %w", err)
+			}
+		case "md":
+			rendered = trendRenderMarkdown(trend)
+		default:
+			return fmt.Errorf("unknown output type '%s'", outputType)
+		}
+
+		outputFile, err := writeObservation(owner, repo, fmt.Sprintf("%s.%s", targetName, outputType), rendered)
+		if err != nil {
+			return fmt.Errorf("failed to write %s file: %w", outputType, err)
+		}
+		outputFiles = append(outputFiles, outputFile)
+	}
+
+	log.Info().
+		Str("workflow", workflow).
+		Str("branch", branch).
+		Int("workflow_run_count", len(filtered)).
+		Strs("output_files", outputFiles).
+		Str("duration", time.Since(startTime).String()).
+		Msg("Built workflow trend report")
+	return nil
+}
+
+// trendReport holds the daily statistics of a workflow
+type trendReport struct {
+	Owner       string
+	Repo        string
+	Workflow    string
+	Branch      string
+	RunCount    int
+	SuccessRate float64
+	Cost        int64
+	Days        []*trendDay
+	Jobs        []*jobTrend
+	Charts      []*trendChart
+}
+
+// trendDay holds the statistics of all runs of a workflow on a single day
+type trendDay struct {
+	Date        string
+	Runs        int
+	Successes   int
+	Cost        int64
+	QueueP50    float64
+	QueueP90    float64
+	DurationP50 float64
+
+	queueTimes []float64
+	durations  []float64
+}
+
+// SuccessRate is the percentage of runs on the day that succeeded
+func (d *trendDay) SuccessRate() float64 {
+	if d.Runs == 0 {
+		return 0
+	}
+	return float64(d.Successes) / float64(d.Runs) * 100
+}
+
+// jobTrend holds the daily duration percentiles of a single job
+type jobTrend struct {
+	Name string
+	P50  float64
+	P90  float64
+	P99  float64
+	Days []*jobTrendDay
+
+	durations []float64
+}
+
+// jobTrendDay holds the duration percentiles of a single job on a single day
+type jobTrendDay struct {
+	Date  string
+	Count int
+	P50   float64
+	P90   float64
+	P99   float64
+
+	durations []float64
+}
+
+// trendChart is a rendered mermaid chart of one trend
+type trendChart struct {
+	Title string
+	Chart string
+}
+
+func buildTrendReport(workflowRuns []*gather.WorkflowRunData) *trendReport {
+	var (
+		trend     = &trendReport{RunCount: len(workflowRuns)}
+		days      = map[string]*trendDay{}
+		jobs      = map[string]*jobTrend{}
+		jobDays   = map[string]map[string]*jobTrendDay{}
+		successes int
+	)
+
+	for _, workflowRun := range workflowRuns {
+		date := workflowRun.GetCreatedAt().UTC().Format(trendDateFormat)
+		day, ok := days[date]
+		if !ok {
+			day = &trendDay{Date: date}
+			days[date] = day
+		}
+		day.Runs++
+		if workflowRun.GetConclusion() == "success" {
+			day.Successes++
+			successes++
+		}
+		day.durations = append(day.durations, workflowRunDuration(workflowRun).Seconds())
+
+		for _, job := range workflowRun.Jobs {
+			day.Cost += job.Cost
+			trend.Cost += job.Cost
+			if !job.GetStartedAt().IsZero() && !job.GetCreatedAt().IsZero() {
+				day.queueTimes = append(day.queueTimes, job.QueueDuration().Seconds())
+			}
+			duration := jobDuration(job)
+			if duration == 0 {
+				continue
+			}
+
+			name := job.GetName()
+			jt, ok := jobs[name]
+			if !ok {
+				jt = &jobTrend{Name: name}
+				jobs[name] = jt
+				jobDays[name] = map[string]*jobTrendDay{}
+			}
+			jt.durations = append(jt.durations, duration.Seconds())
+			jobDay, ok := jobDays[name][date]
+			if !ok {
+				jobDay = &jobTrendDay{Date: date}
+				jobDays[name][date] = jobDay
+			}
+			jobDay.Count++
+			jobDay.durations = append(jobDay.durations, duration.Seconds())
+		}
+	}
+
+	for _, day := range days {
+		day.QueueP50 = percentile(day.queueTimes, 50)
+		day.QueueP90 = percentile(day.queueTimes, 90)
+		day.DurationP50 = percentile(day.durations, 50)
+		trend.Days = append(trend.Days, day)
+	}
+	sort.Slice(trend.Days, func(i, j int) bool { return trend.Days[i].Date < trend.Days[j].Date })
+
+	for name, jt := range jobs {
+		jt.P50, jt.P90, jt.P99 = percentile(jt.durations, 50), percentile(jt.durations, 90), percentile(jt.durations, 99)
+		for _, jobDay := range jobDays[name] {
+			jobDay.P50 = percentile(jobDay.durations, 50)
+			jobDay.P90 = percentile(jobDay.durations, 90)
+			jobDay.P99 = percentile(jobDay.durations, 99)
+			jt.Days = append(jt.Days, jobDay)
+		}
+		sort.Slice(jt.Days, func(i, j int) bool { return jt.Days[i].Date < jt.Days[j].Date })
+		trend.Jobs = append(trend.Jobs, jt)
+	}
+	sort.Slice(trend.Jobs, func(i, j int) bool { return trend.Jobs[i].Name < trend.Jobs[j].Name })
+
+	if trend.RunCount > 0 {
+		trend.SuccessRate = float64(successes) / float64(trend.RunCount) * 100
+	}
+	return trend
+}
+
+// percentile calculates the nearest-rank percentile of values
+func percentile(values []float64, p float64) float64 {
+	if len(values) == 0 {
+		return 0
+	}
+	sorted := make([]float64, len(values))
+	copy(sorted, values)
+	sort.Float64s(sorted)
+	rank := int(math.Ceil(p / 100 * float64(len(sorted))))
+	if rank < 1 {
+		rank = 1
+	}
+	return sorted[rank-1]
+}
+
+// matchesWorkflow checks if a workflow run belongs to the workflow described by name, path, or file name
+func matchesWorkflow(workflowRun *gather.WorkflowRunData, workflow string) bool {
+	return workflow == "" ||
+		workflowRun.GetName() == workflow ||
+		workflowRun.GetPath() == workflow ||
+		filepath.Base(workflowRun.GetPath()) == workflow
+}
+
+// fileSafeName converts a name into something usable in a file name
+func fileSafeName(name string) string {
+	return strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '-', r == '_':
+			return r
+		default:
+			return '_'
+		}
+	}, name)
+}
+
+type xyChartData struct {
+	Title  string
+	YLabel string
+	XAxis  []string
+	Bar    []float64
+	Lines  [][]float64
+}
+
+var xyChartTemplate = `xychart-beta
+    title "{{ .Title }}"
+    x-axis [{{ range $i, $x := .XAxis }}{{ if $i }}, {{ end }}"{{ $x }}"{{ end }}]
+    y-axis "{{ .YLabel }}"
+    {{- if .Bar }}
+    bar [{{ range $i, $y := .Bar }}{{ if $i }}, {{ end }}{{ printf "%.3f" $y }}{{ end }}]
+    {{- end }}
+    {{- range .Lines }}
+    line [{{ range $i, $y := . }}{{ if $i }}, {{ end }}{{ printf "%.3f" $y }}{{ end }}]
+    {{- end }}`
+
+func trendCharts(trend *trendReport) ([]*trendChart, error) {
+	tmpl, err := textTemplate.New("xychart").Parse(xyChartTemplate)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse mermaid template: %w", err)
+	}
+
+	var (
+		dates       = make([]string, 0, len(trend.Days))
+		costs       = make([]float64, 0, len(trend.Days))
+		successRate = make([]float64, 0, len(trend.Days))
+		queueP50    = make([]float64, 0, len(trend.Days))
+		queueP90    = make([]float64, 0, len(trend.Days))
+		durationP50 = make([]float64, 0, len(trend.Days))
+	)
+	for _, day := range trend.Days {
+		dates = append(dates, day.Date)
+		costs = append(costs, float64(day.Cost)/1000)
+		successRate = append(successRate, day.SuccessRate())
+		queueP50 = append(queueP50, day.QueueP50)
+		queueP90 = append(queueP90, day.QueueP90)
+		durationP50 = append(durationP50, day.DurationP50)
+	}
+
+	chartData := []*xyChartData{
+		{Title: "Daily Cost", YLabel: "Dollars", XAxis: dates, Bar: costs},
+		{Title: "Success Rate", YLabel: "Percent", XAxis: dates, Lines: [][]float64{successRate}},
+		{Title: "Job Queue Time (p50, p90)", YLabel: "Seconds", XAxis: dates, Lines: [][]float64{queueP50, queueP90}},
+		{Title: "Workflow Duration (p50)", YLabel: "Seconds", XAxis: dates, Lines: [][]float64{durationP50}},
+	}
+	for _, jt := range trend.Jobs {
+		var (
+			jobDates = make([]string, 0, len(jt.Days))
+			p50      = make([]float64, 0, len(jt.Days))
+			p90      = make([]float64, 0, len(jt.Days))
+			p99      = make([]float64, 0, len(jt.Days))
+		)
+		for _, jobDay := range jt.Days {
+			jobDates = append(jobDates, jobDay.Date)
+			p50 = append(p50, jobDay.P50)
+			p90 = append(p90, jobDay.P90)
+			p99 = append(p99, jobDay.P99)
+		}
+		chartData = append(chartData, &xyChartData{
+			Title:  fmt.Sprintf("%s Duration (p50, p90, p99)", jt.Name),
+			YLabel: "Seconds",
+			XAxis:  jobDates,
+			Lines:  [][]float64{p50, p90, p99},
+		})
+	}
+
+	charts := make([]*trendChart, 0, len(chartData))
+	for _, data := range chartData {
+		// Double quotes end mermaid strings early
+		data.Title = strings.ReplaceAll(data.Title, `"`, "'")
+		var chart bytes.Buffer
+		err = tmpl.Execute(&chart, data)
+		if err != nil {
+			return nil, fmt.Errorf("failed to execute mermaid template: %w", err)
+		}
+		charts = append(charts, &trendChart{Title: data.Title, Chart: chart.String()})
+	}
+	return charts, nil
+}
+
+var trendTemplateFuncs = map[string]any{
+	"cost":    func(cost int64) string { return formatCost(float64(cost)) },
+	"seconds": formatSeconds,
+}
+
+func trendRenderMarkdown(trend *trendReport) string {
+	var md strings.Builder
+
+	fmt.Fprintf(&md, "# Workflow Trend: %s\n\n", trend.Workflow)
+	if trend.Branch != "" {
+		fmt.Fprintf(&md, "Branch: `%s`\n\n", trend.Branch)
+	}
+	fmt.Fprintf(&md, "**%d** runs over **%d** days, **%.1f%%** success rate, **%s** total cost\n\n",
+		trend.RunCount, len(trend.Days), trend.SuccessRate, formatCost(float64(trend.Cost)),
+	)
+
+	md.WriteString("## Daily\n\n")
+	md.WriteString("| Date | Runs | Success Rate | Cost | Duration p50 | Queue Time p50 | Queue Time p90 |\n")
+	md.WriteString("|---|---|---|---|---|---|---|\n")
+	for _, day := range trend.Days {
+		fmt.Fprintf(&md, "| %s | %d | %.1f%% | %s | %s | %s | %s |\n",
+			day.Date, day.Runs, day.SuccessRate(), formatCost(float64(day.Cost)),
+			formatSeconds(day.DurationP50), formatSeconds(day.QueueP50), formatSeconds(day.QueueP90),
+		)
+	}
+
+	md.WriteString("\n## Jobs\n\n")
+	md.WriteString("| Job | p50 | p90 | p99 | First Day p50 | Last Day p50 | Change |\n")
+	md.WriteString("|---|---|---|---|---|---|---|\n")
+	for _, jt := range trend.Jobs {
+		first, last := jt.Days[0], jt.Days[len(jt.Days)-1]
+		change := delta{Base: first.P50, Head: last.P50}
+		fmt.Fprintf(&md, "| %s | %s | %s | %s | %s | %s | %s |\n",
+			jt.Name, formatSeconds(jt.P50), formatSeconds(jt.P90), formatSeconds(jt.P99),
+			formatSeconds(first.P50), formatSeconds(last.P50), formatDurationDelta(change),
+		)
+	}
+
+	md.WriteString("\n## Charts\n")
+	for _, chart := range trend.Charts {
+		fmt.Fprintf(&md, "\n%s\n", workflowRunRenderMarkdown(chart.Chart))
+	}
+	return md.String()
+}
+
+func trendRenderHTML(trend *trendReport) (string, error) {
+	tmpl, err := htmlTemplate.New("trend").Funcs(trendTemplateFuncs).ParseFiles(filepath.Join(templatesDir, "trend.html"))
+	if err != nil {
+		return "", fmt.Errorf("failed to parse HTML template: %w", err)
+	}
+
+	var html bytes.Buffer
+	err = tmpl.Execute(&html, trend)
+	if err != nil {
+		return "", fmt.Errorf("failed to execute HTML template: %w", err)
+	}
+	return html.String(), nil
+}
@@ -6,6 +6,7 @@ import (
 	htmlTemplate "html/template"
 	"os"
 	"path/filepath"
+	"sort"
 	"strings"
 	textTemplate "text/template"
 	"time"
@@ -16,12 +17,6 @@ import (
 )
 
 func WorkflowRun(client *github.Client, owner, repo string, workflowRunID int64, outputTypes []string) error {
-	outputDir := filepath.Join(outputDir, owner, repo)
-	err := os.MkdirAll(outputDir, 0755)
-	if err != nil {
-		return fmt.Errorf("failed to create output directory: %w", err)
-	}
-
 	workflowRun, err := gather.WorkflowRun(client, owner, repo, workflowRunID, false)
 	if err != nil {
 		return err
@@ -37,7 +32,7 @@ func WorkflowRun(client *github.Client, owner, repo string, workflowRunID int64,
 		return fmt.Errorf("failed to generate mermaid chart: %w", err)
 	}
 
-	targetFile := filepath.Join(outputDir, fmt.Sprintf("workflow_run_%d", workflowRunID))
+	targetName := fmt.Sprintf("workflow_run_%d", workflowRunID)
 	for _, outputType := range outputTypes {
 		var rendered string
 		switch outputType {
@@ -46,22 +41,33 @@ func WorkflowRun(client *github.Client, owner, repo string, workflowRunID int64,
 			if err != nil {
 				return fmt.Errorf("failed to render HTML: %w", err)
 			}
-			err = os.WriteFile(targetFile+".html", []byte(rendered), 0644)
-			if err != nil {
-				return fmt.Errorf("failed to write HTML file: %w", err)
-			}
 		case "md":
 			rendered = workflowRunRenderMarkdown(workflowRunTemplateData.MermaidChart)
+		case "csv":
+			rendered, err = jobsRenderCSV(workflowRun)
+			if err != nil {
+				return fmt.Errorf("failed to render CSV: %w", err)
+			}
+		case "step-summary":
+			summaryFile := os.Getenv(githubStepSummaryEnvVar)
+			if summaryFile == "" {
+				return fmt.Errorf("output type '%s' requires %s to be set, are you running in GitHub Actions?", outputType, githubStepSummaryEnvVar)
+			}
+			err = appendToFile(summaryFile, workflowRunRenderStepSummary(workflowRun, workflowRunTemplateData.MermaidChart))
+			if err != nil {
+				return fmt.Errorf("failed to write step summary: %w", err)
+			}
+			outputFiles = append(outputFiles, summaryFile)
+			continue
 		default:
 			return fmt.Errorf("unknown output type '%s'", outputType)
 		}
 
-		finalFile := fmt.Sprintf("%s.%s", targetFile, outputType)
-		err := os.WriteFile(finalFile, []byte(rendered), 0644)
+		outputFile, err := writeObservation(owner, repo, fmt.Sprintf("%s.%s", targetName, outputType), rendered)
 		if err != nil {
 			return fmt.Errorf("failed to write %s file: %w", outputType, err)
 		}
-		outputFiles = append(outputFiles, finalFile)
+		outputFiles = append(outputFiles, outputFile)
 	}
 	log.Info().
 		Int64("workflow_run_id", workflowRunID).
@@ -105,7 +111,8 @@ func buildWorkflowRunTemplateData(workflowRun *gather.WorkflowRunData) (*workflo
 	for _, job := range workflowRun.Jobs {
 		startedAt := job.GetStartedAt().Time
 		duration := job.GetCompletedAt().Sub(startedAt)
-		if startedAt.IsZero() || duration == 0 {
+		// Jobs of in-progress workflow runs may not have finished yet
+		if startedAt.IsZero() || job.GetCompletedAt().IsZero() || duration == 0 {
 			continue
 		}
 
@@ -159,3 +166,75 @@ func workflowRunRenderHTML(templateData *workflowRunTemplateData) (string, error
 func workflowRunRenderMarkdown(mermaidChart string) string {
 	return fmt.Sprintf("```mermaid\n%s\n```", mermaidChart)
 }
+
+// workflowRunRenderStepSummary renders a compact markdown report suited for a GitHub job summary
+func workflowRunRenderStepSummary(workflowRun *gather.WorkflowRunData, mermaidChart string) string {
+	var (
+		md        strings.Builder
+		totalCost int64
+		steps     = []*jobStep{}
+	)
+
+	for _, job := range workflowRun.Jobs {
+		totalCost += job.Cost
+		for _, step := range job.Steps {
+			steps = append(steps, &jobStep{Job: job.GetName(), TaskStep: step})
+		}
+	}
+	sort.Slice(steps, func(i, j int) bool {
+		return stepDuration(steps[i].TaskStep) > stepDuration(steps[j].TaskStep)
+	})
+	if len(steps) > stepSummaryMaxSteps {
+		steps = steps[:stepSummaryMaxSteps]
+	}
+
+	fmt.Fprintf(&md, "## CI Performance: [%s #%d](%s)\n\n", workflowRun.GetName(), workflowRun.GetRunNumber(), workflowRun.GetHTMLURL())
+	if workflowRun.Partial {
+		// Billing data isn't available until the workflow run completes
+		fmt.Fprintf(&md, "**Duration so far:** %s | **Total Cost:** pending, the workflow run is still in progress\n\n", workflowRunDuration(workflowRun).String())
+	} else {
+		fmt.Fprintf(&md, "**Duration:** %s | **Total Cost:** %s\n\n", workflowRunDuration(workflowRun).String(), formatCost(float64(totalCost)))
+	}
+	md.WriteString(workflowRunRenderMarkdown(mermaidChart))
+
+	md.WriteString("\n\n### Jobs\n\n")
+	md.WriteString("| Job | Runner | Duration | Cost |\n")
+	md.WriteString("|---|---|---|---|\n")
+	for _, job := range workflowRun.Jobs {
+		cost := formatCost(float64(job.Cost))
+		if workflowRun.Partial {
+			cost = "pending"
+		}
+		fmt.Fprintf(&md, "| [%s](%s) | %s | %s | %s |\n",
+			job.GetName(), job.GetHTMLURL(), job.Runner, jobDuration(job).String(), cost,
+		)
+	}
+
+	fmt.Fprintf(&md, "\n### Slowest %d Steps\n\n", len(steps))
+	md.WriteString("| Job | Step | Duration |\n")
+	md.WriteString("|---|---|---|\n")
+	for _, step := range steps {
+		fmt.Fprintf(&md, "| %s | %s | %s |\n", step.Job, step.GetName(), stepDuration(step.TaskStep).String())
+	}
+	md.WriteString("\n")
+	return md.String()
+}
+
+// jobStep is a step along with the name of the job it ran in
+type jobStep struct {
+	*github.TaskStep
+	Job string
+}
+
+// appendToFile appends content to a file, creating it if it doesn't exist
+func appendToFile(file, content string) error {
+	f, err := os.OpenFile(file, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	_, err = f.WriteString(content)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
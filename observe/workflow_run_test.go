@@ -0,0 +1,45 @@
+package observe
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/kalverra/workflow-metrics/fakegithub"
+	"github.com/kalverra/workflow-metrics/gather"
+	"github.com/kalverra/workflow-metrics/store"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// The step summary file and partial gathering are set for the whole process, so this can't run in parallel
+func TestWorkflowRunStepSummaryInProgress(t *testing.T) {
+	dir := t.TempDir()
+	s := store.NewFileSystem(filepath.Join(dir, "data"), filepath.Join(dir, "observe_output"))
+	gather.SetStore(s)
+	SetStore(s)
+	gather.SetPartial(true)
+	t.Cleanup(func() { gather.SetPartial(false) })
+	summaryFile := filepath.Join(dir, "summary.md")
+	t.Setenv(githubStepSummaryEnvVar, summaryFile)
+
+	const owner, repo = "kalverra", "workflow-metrics"
+	server := fakegithub.New()
+	t.Cleanup(server.Close)
+	run := fakegithub.Run(1)
+	run.Job(11, "build")
+	run.Job(12, "summarize").InProgress()
+	server.AddRuns(owner, repo, run.InProgress())
+
+	// Each job of the workflow run can write its own summary
+	for attempt := 1; attempt <= 2; attempt++ {
+		err := WorkflowRun(server.Client(), owner, repo, 1, []string{"step-summary"})
+		require.NoError(t, err, "failed to write step summary on attempt %d", attempt)
+	}
+
+	summary, err := os.ReadFile(summaryFile)
+	require.NoError(t, err, "failed to read step summary")
+	assert.Equal(t, 2, strings.Count(string(summary), "**Duration so far:**"), "expected a summary of the in-progress run per attempt")
+	assert.Contains(t, string(summary), "build", "summary should have the completed job")
+}
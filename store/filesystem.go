@@ -0,0 +1,105 @@
+package store
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+)
+
+// FileSystem stores data as files on local disk
+type FileSystem struct {
+	dataDir   string
+	outputDir string
+}
+
+// NewFileSystem creates a store that writes gathered data under dataDir and observations under outputDir
+func NewFileSystem(dataDir, outputDir string) *FileSystem {
+	return &FileSystem{dataDir: dataDir, outputDir: outputDir}
+}
+
+// Get reads an item from disk
+func (f *FileSystem) Get(owner, repo string, kind Kind, name string) ([]byte, error) {
+	data, err := os.ReadFile(f.Location(owner, repo, kind, name))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, ErrNotFound
+	}
+	return data, err
+}
+
+// Put writes an item to disk, creating any missing directories
+func (f *FileSystem) Put(owner, repo string, kind Kind, name string, data []byte) error {
+	target := f.Location(owner, repo, kind, name)
+	err := os.MkdirAll(filepath.Dir(target), 0755)
+	if err != nil {
+		return fmt.Errorf("failed to make dir '%s': %w", filepath.Dir(target), err)
+	}
+	return os.WriteFile(target, data, 0644)
+}
+
+// List lists the files of a kind for a repo
+func (f *FileSystem) List(owner, repo string, kind Kind) ([]string, error) {
+	entries, err := os.ReadDir(f.dir(owner, repo, kind))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	names := make([]string, 0, len(entries))
+	for _, entry := range entries {
+		if entry.IsDir() {
+			continue
+		}
+		names = append(names, entry.Name())
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+// Repos lists the owner and repo directories under the data dir
+func (f *FileSystem) Repos() ([]Repo, error) {
+	owners, err := os.ReadDir(f.dataDir)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	repos := []Repo{}
+	for _, owner := range owners {
+		if !owner.IsDir() {
+			continue
+		}
+		ownerRepos, err := os.ReadDir(filepath.Join(f.dataDir, owner.Name()))
+		if err != nil {
+			return nil, err
+		}
+		for _, repo := range ownerRepos {
+			if repo.IsDir() {
+				repos = append(repos, Repo{Owner: owner.Name(), Repo: repo.Name()})
+			}
+		}
+	}
+	return repos, nil
+}
+
+// Location is the path of the item's file
+func (f *FileSystem) Location(owner, repo string, kind Kind, name string) string {
+	return filepath.Join(f.dir(owner, repo, kind), name)
+}
+
+// Close does nothing for a filesystem store
+func (f *FileSystem) Close() error {
+	return nil
+}
+
+func (f *FileSystem) dir(owner, repo string, kind Kind) string {
+	if kind == Observations {
+		return filepath.Join(f.outputDir, owner, repo)
+	}
+	return filepath.Join(f.dataDir, owner, repo, string(kind))
+}
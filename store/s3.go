@@ -0,0 +1,214 @@
+package store
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/minio/minio-go/v7"
+	"github.com/minio/minio-go/v7/pkg/credentials"
+)
+
+const (
+	s3AccessKeyEnvVar = "AWS_ACCESS_KEY_ID"
+	s3SecretKeyEnvVar = "AWS_SECRET_ACCESS_KEY"
+
+	s3Timeout = 30 * time.Second
+)
+
+// S3Config describes how to connect to an S3-compatible bucket
+type S3Config struct {
+	// Endpoint is the host and port of the S3-compatible API, e.g. "s3.amazonaws.com" or "localhost:9000"
+	Endpoint string
+	Bucket   string
+	// Prefix is prepended to all object keys
+	Prefix string
+	Region string
+	// Insecure uses HTTP instead of HTTPS
+	Insecure  bool
+	AccessKey string
+	SecretKey string
+}
+
+// S3 stores data as objects in an S3-compatible bucket
+type S3 struct {
+	config S3Config
+	client *minio.Client
+}
+
+// NewS3 connects to an S3-compatible bucket to use as a store
+func NewS3(config S3Config) (*S3, error) {
+	if config.Bucket == "" {
+		return nil, fmt.Errorf("s3 store requires a bucket")
+	}
+	if config.Endpoint == "" {
+		config.Endpoint = "s3.amazonaws.com"
+	}
+
+	client, err := minio.New(config.Endpoint, &minio.Options{
+		Creds:  credentials.NewStaticV4(config.AccessKey, config.SecretKey, ""),
+		Secure: !config.Insecure,
+		Region: config.Region,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create s3 client for '%s': %w", config.Endpoint, err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), s3Timeout)
+	defer cancel()
+	exists, err := client.BucketExists(ctx, config.Bucket)
+	if err != nil {
+		return nil, fmt.Errorf("failed to check s3 bucket '%s': %w", config.Bucket, err)
+	}
+	if !exists {
+		return nil, fmt.Errorf("s3 bucket '%s' does not exist", config.Bucket)
+	}
+	return &S3{config: config, client: client}, nil
+}
+
+// Get downloads an item's object
+func (s *S3) Get(owner, repo string, kind Kind, name string) ([]byte, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), s3Timeout)
+	defer cancel()
+
+	object, err := s.client.GetObject(ctx, s.config.Bucket, s.key(owner, repo, kind, name), minio.GetObjectOptions{})
+	if err != nil {
+		return nil, err
+	}
+	defer object.Close()
+
+	data, err := io.ReadAll(object)
+	if err != nil {
+		if minio.ToErrorResponse(err).Code == "NoSuchKey" {
+			return nil, ErrNotFound
+		}
+		return nil, err
+	}
+	return data, nil
+}
+
+// Put uploads an item's object
+func (s *S3) Put(owner, repo string, kind Kind, name string, data []byte) error {
+	ctx, cancel := context.WithTimeout(context.Background(), s3Timeout)
+	defer cancel()
+
+	_, err := s.client.PutObject(
+		ctx,
+		s.config.Bucket,
+		s.key(owner, repo, kind, name),
+		bytes.NewReader(data),
+		int64(len(data)),
+		minio.PutObjectOptions{},
+	)
+	return err
+}
+
+// List lists the objects of a kind for a repo
+func (s *S3) List(owner, repo string, kind Kind) ([]string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), s3Timeout)
+	defer cancel()
+
+	prefix := s.key(owner, repo, kind, "")
+	names := []string{}
+	for object := range s.client.ListObjects(ctx, s.config.Bucket, minio.ListObjectsOptions{Prefix: prefix}) {
+		if object.Err != nil {
+			return nil, object.Err
+		}
+		name := strings.TrimPrefix(object.Key, prefix)
+		if name == "" || strings.Contains(name, "/") {
+			continue
+		}
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+// Repos lists the owner and repo prefixes in the bucket
+func (s *S3) Repos() ([]Repo, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), s3Timeout)
+	defer cancel()
+
+	rootPrefix := ""
+	if s.config.Prefix != "" {
+		rootPrefix = s.config.Prefix + "/"
+	}
+	repos := []Repo{}
+	for owner := range s.client.ListObjects(ctx, s.config.Bucket, minio.ListObjectsOptions{Prefix: rootPrefix}) {
+		if owner.Err != nil {
+			return nil, owner.Err
+		}
+		if !strings.HasSuffix(owner.Key, "/") {
+			continue
+		}
+		for repo := range s.client.ListObjects(ctx, s.config.Bucket, minio.ListObjectsOptions{Prefix: owner.Key}) {
+			if repo.Err != nil {
+				return nil, repo.Err
+			}
+			if !strings.HasSuffix(repo.Key, "/") {
+				continue
+			}
+			hasData, err := s.hasGatheredData(ctx, repo.Key)
+			if err != nil {
+				return nil, err
+			}
+			if !hasData {
+				continue
+			}
+			repos = append(repos, Repo{
+				Owner: strings.Trim(strings.TrimPrefix(owner.Key, rootPrefix), "/"),
+				Repo:  strings.Trim(strings.TrimPrefix(repo.Key, owner.Key), "/"),
+			})
+		}
+	}
+	return repos, nil
+}
+
+// hasGatheredData checks if a repo prefix holds any kind of data other than observations
+func (s *S3) hasGatheredData(ctx context.Context, repoPrefix string) (bool, error) {
+	// Stops the listing when returning early
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	for kind := range s.client.ListObjects(ctx, s.config.Bucket, minio.ListObjectsOptions{Prefix: repoPrefix}) {
+		if kind.Err != nil {
+			return false, kind.Err
+		}
+		if strings.HasSuffix(kind.Key, "/") && strings.TrimSuffix(strings.TrimPrefix(kind.Key, repoPrefix), "/") != string(Observations) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// Location is the URL of the item's object
+func (s *S3) Location(owner, repo string, kind Kind, name string) string {
+	return fmt.Sprintf("s3://%s/%s", s.config.Bucket, s.key(owner, repo, kind, name))
+}
+
+// Close does nothing for an S3 store
+func (s *S3) Close() error {
+	return nil
+}
+
+func (s *S3) key(owner, repo string, kind Kind, name string) string {
+	key := path.Join(s.config.Prefix, owner, repo, string(kind), name)
+	if name == "" {
+		key += "/"
+	}
+	return key
+}
+
+func s3AccessKey() string {
+	return os.Getenv(s3AccessKeyEnvVar)
+}
+
+func s3SecretKey() string {
+	return os.Getenv(s3SecretKeyEnvVar)
+}
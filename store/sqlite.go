@@ -0,0 +1,128 @@
+package store
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	// Pure Go SQLite driver, registered as "sqlite"
+	_ "modernc.org/sqlite"
+)
+
+const sqliteSchema = `CREATE TABLE IF NOT EXISTS items (
+	owner      TEXT NOT NULL,
+	repo       TEXT NOT NULL,
+	kind       TEXT NOT NULL,
+	name       TEXT NOT NULL,
+	data       BLOB NOT NULL,
+	updated_at TIMESTAMP NOT NULL,
+	PRIMARY KEY (owner, repo, kind, name)
+)`
+
+// SQLite stores data as rows in a single SQLite database file
+type SQLite struct {
+	path string
+	db   *sql.DB
+}
+
+// NewSQLite opens or creates a SQLite database at path to use as a store
+func NewSQLite(path string) (*SQLite, error) {
+	if dir := filepath.Dir(path); dir != "" {
+		err := os.MkdirAll(dir, 0755)
+		if err != nil {
+			return nil, fmt.Errorf("failed to make dir '%s': %w", dir, err)
+		}
+	}
+
+	db, err := sql.Open("sqlite", path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open sqlite database '%s': %w", path, err)
+	}
+	// Workflow runs are gathered concurrently, and SQLite only allows one writer at a time
+	db.SetMaxOpenConns(1)
+	_, err = db.Exec(sqliteSchema)
+	if err != nil {
+		return nil, errors.Join(fmt.Errorf("failed to create sqlite schema: %w", err), db.Close())
+	}
+	return &SQLite{path: path, db: db}, nil
+}
+
+// Get reads an item's row
+func (s *SQLite) Get(owner, repo string, kind Kind, name string) ([]byte, error) {
+	var data []byte
+	err := s.db.QueryRow(
+		`SELECT data FROM items WHERE owner = ? AND repo = ? AND kind = ? AND name = ?`,
+		owner, repo, string(kind), name,
+	).Scan(&data)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	return data, err
+}
+
+// Put inserts or replaces an item's row
+func (s *SQLite) Put(owner, repo string, kind Kind, name string, data []byte) error {
+	_, err := s.db.Exec(
+		`INSERT INTO items (owner, repo, kind, name, data, updated_at) VALUES (?, ?, ?, ?, ?, ?)
+		ON CONFLICT (owner, repo, kind, name) DO UPDATE SET data = excluded.data, updated_at = excluded.updated_at`,
+		owner, repo, string(kind), name, data, time.Now().UTC(),
+	)
+	return err
+}
+
+// List lists the names of a kind's rows for a repo
+func (s *SQLite) List(owner, repo string, kind Kind) ([]string, error) {
+	rows, err := s.db.Query(
+		`SELECT name FROM items WHERE owner = ? AND repo = ? AND kind = ? ORDER BY name`,
+		owner, repo, string(kind),
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	names := []string{}
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return nil, err
+		}
+		names = append(names, name)
+	}
+	return names, rows.Err()
+}
+
+// Repos lists the distinct owners and repos with rows
+func (s *SQLite) Repos() ([]Repo, error) {
+	rows, err := s.db.Query(
+		`SELECT DISTINCT owner, repo FROM items WHERE kind != ? ORDER BY owner, repo`,
+		string(Observations),
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	repos := []Repo{}
+	for rows.Next() {
+		var repo Repo
+		if err := rows.Scan(&repo.Owner, &repo.Repo); err != nil {
+			return nil, err
+		}
+		repos = append(repos, repo)
+	}
+	return repos, rows.Err()
+}
+
+// Location describes the item's row
+func (s *SQLite) Location(owner, repo string, kind Kind, name string) string {
+	return fmt.Sprintf("sqlite://%s#%s/%s/%s/%s", s.path, owner, repo, kind, name)
+}
+
+// Close closes the database
+func (s *SQLite) Close() error {
+	return s.db.Close()
+}
@@ -0,0 +1,85 @@
+package store
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+// Kind is a category of data held in a Store
+type Kind string
+
+const (
+	// WorkflowRuns are gathered workflow runs
+	WorkflowRuns Kind = "workflow_runs"
+	// PullRequests are gathered pull request aggregates
+	PullRequests Kind = "pull_requests"
+	// JobEvents are workflow_job status changes received by the webhook server, per workflow run
+	JobEvents Kind = "job_events"
+	// Observations are rendered outputs of observing gathered data
+	Observations Kind = "observations"
+)
+
+// Repo identifies a repository that has data in a Store
+type Repo struct {
+	Owner string
+	Repo  string
+}
+
+// ErrNotFound is returned when an item doesn't exist in a Store
+var ErrNotFound = errors.New("not found in store")
+
+// Store persists gathered data and observations, keyed by repo, kind, and name
+type Store interface {
+	// Get reads an item, returning ErrNotFound if it doesn't exist
+	Get(owner, repo string, kind Kind, name string) ([]byte, error)
+	// Put writes an item, replacing it if it already exists
+	Put(owner, repo string, kind Kind, name string, data []byte) error
+	// List returns the names of all items of a kind for a repo
+	List(owner, repo string, kind Kind) ([]string, error)
+	// Repos returns all repos that have gathered data in the store
+	Repos() ([]Repo, error)
+	// Location describes where an item lives, e.g. a file path or URL
+	Location(owner, repo string, kind Kind, name string) string
+	// Close releases any resources held by the store
+	Close() error
+}
+
+// Open opens a store described by uri. An empty uri opens a filesystem store rooted at dataDir, writing
+// observations to outputDir. Supported schemes are:
+//
+//	file://<dir>
+//	sqlite://<path>
+//	s3://<bucket>[/<prefix>]?endpoint=<host:port>[&insecure=true][&region=<region>]
+func Open(uri, dataDir, outputDir string) (Store, error) {
+	if uri == "" {
+		return NewFileSystem(dataDir, outputDir), nil
+	}
+
+	parsed, err := url.Parse(uri)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse store URI '%s': %w", uri, err)
+	}
+	path := parsed.Host + parsed.Path
+
+	switch parsed.Scheme {
+	case "file":
+		return NewFileSystem(path, outputDir), nil
+	case "sqlite":
+		return NewSQLite(path)
+	case "s3":
+		query := parsed.Query()
+		return NewS3(S3Config{
+			Endpoint:  query.Get("endpoint"),
+			Bucket:    parsed.Host,
+			Prefix:    strings.Trim(parsed.Path, "/"),
+			Region:    query.Get("region"),
+			Insecure:  query.Get("insecure") == "true",
+			AccessKey: s3AccessKey(),
+			SecretKey: s3SecretKey(),
+		})
+	default:
+		return nil, fmt.Errorf("unknown store scheme '%s', must be one of file, sqlite, or s3", parsed.Scheme)
+	}
+}
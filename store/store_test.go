@@ -0,0 +1,232 @@
+package store
+
+import (
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/johannesboyne/gofakes3"
+	"github.com/johannesboyne/gofakes3/backend/s3mem"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const testBucket = "workflow-metrics"
+
+// TestStoreContract runs every backend through the same expectations of the Store interface
+func TestStoreContract(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		name string
+		open func(t *testing.T) Store
+		// location is where workflow run 1.json of kalverra/workflow-metrics is expected to live
+		location func(s Store) string
+	}{
+		{
+			name: "filesystem",
+			open: func(t *testing.T) Store {
+				dir := t.TempDir()
+				return NewFileSystem(filepath.Join(dir, "data"), filepath.Join(dir, "observe_output"))
+			},
+			location: func(s Store) string {
+				return filepath.Join(s.(*FileSystem).dataDir, "kalverra", "workflow-metrics", "workflow_runs", "1.json")
+			},
+		},
+		{
+			name: "sqlite",
+			open: func(t *testing.T) Store {
+				s, err := NewSQLite(filepath.Join(t.TempDir(), "store.db"))
+				require.NoError(t, err, "failed to open sqlite store")
+				return s
+			},
+			location: func(s Store) string {
+				return "sqlite://" + s.(*SQLite).path + "#kalverra/workflow-metrics/workflow_runs/1.json"
+			},
+		},
+		{
+			name: "s3",
+			open: func(t *testing.T) Store {
+				return newTestS3(t, "prefix")
+			},
+			location: func(Store) string {
+				return "s3://" + testBucket + "/prefix/kalverra/workflow-metrics/workflow_runs/1.json"
+			},
+		},
+		{
+			name: "s3 without prefix",
+			open: func(t *testing.T) Store {
+				return newTestS3(t, "")
+			},
+			location: func(Store) string {
+				return "s3://" + testBucket + "/kalverra/workflow-metrics/workflow_runs/1.json"
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			s := tc.open(t)
+			t.Cleanup(func() {
+				assert.NoError(t, s.Close(), "failed to close store")
+			})
+
+			repos, err := s.Repos()
+			require.NoError(t, err, "failed to list repos of empty store")
+			assert.Empty(t, repos, "expected no repos in empty store")
+			_, err = s.Get("kalverra", "workflow-metrics", WorkflowRuns, "1.json")
+			require.ErrorIs(t, err, ErrNotFound, "expected not found getting from empty store")
+			names, err := s.List("kalverra", "workflow-metrics", WorkflowRuns)
+			require.NoError(t, err, "failed to list empty store")
+			assert.Empty(t, names, "expected no names in empty store")
+
+			puts := []struct {
+				owner, repo string
+				kind        Kind
+				name, data  string
+			}{
+				{"kalverra", "workflow-metrics", WorkflowRuns, "2.json", "run 2"},
+				{"kalverra", "workflow-metrics", WorkflowRuns, "1.json", "run 1 draft"},
+				{"kalverra", "workflow-metrics", WorkflowRuns, "1.json", "run 1"},
+				{"kalverra", "workflow-metrics", PullRequests, "7.json", "pull request 7"},
+				{"kalverra", "workflow-metrics", Observations, "workflow_run_1.md", "observed"},
+				{"kalverra", "other", JobEvents, "3.json", "events 3"},
+				{"smartcontractkit", "chainlink", WorkflowRuns, "4.json", "run 4"},
+				// Only observations, which aren't gathered data
+				{"observed", "only", Observations, "report.md", "observed"},
+			}
+			for _, put := range puts {
+				err := s.Put(put.owner, put.repo, put.kind, put.name, []byte(put.data))
+				require.NoError(t, err, "failed to put %s/%s %s %s", put.owner, put.repo, put.kind, put.name)
+			}
+
+			gets := []struct {
+				owner, repo string
+				kind        Kind
+				name, want  string
+			}{
+				{"kalverra", "workflow-metrics", WorkflowRuns, "1.json", "run 1"},
+				{"kalverra", "workflow-metrics", WorkflowRuns, "2.json", "run 2"},
+				{"kalverra", "workflow-metrics", PullRequests, "7.json", "pull request 7"},
+				{"kalverra", "workflow-metrics", Observations, "workflow_run_1.md", "observed"},
+				{"kalverra", "other", JobEvents, "3.json", "events 3"},
+			}
+			for _, get := range gets {
+				data, err := s.Get(get.owner, get.repo, get.kind, get.name)
+				require.NoError(t, err, "failed to get %s/%s %s %s", get.owner, get.repo, get.kind, get.name)
+				assert.Equal(t, get.want, string(data), "wrong data for %s/%s %s %s", get.owner, get.repo, get.kind, get.name)
+			}
+
+			notFound := []struct {
+				owner, repo string
+				kind        Kind
+				name        string
+			}{
+				{"kalverra", "workflow-metrics", WorkflowRuns, "3.json"},
+				{"kalverra", "workflow-metrics", PullRequests, "1.json"},
+				{"kalverra", "other", WorkflowRuns, "1.json"},
+				{"nobody", "workflow-metrics", WorkflowRuns, "1.json"},
+			}
+			for _, get := range notFound {
+				_, err := s.Get(get.owner, get.repo, get.kind, get.name)
+				require.ErrorIs(t, err, ErrNotFound, "expected not found for %s/%s %s %s", get.owner, get.repo, get.kind, get.name)
+			}
+
+			lists := []struct {
+				owner, repo string
+				kind        Kind
+				want        []string
+			}{
+				{"kalverra", "workflow-metrics", WorkflowRuns, []string{"1.json", "2.json"}},
+				{"kalverra", "workflow-metrics", PullRequests, []string{"7.json"}},
+				{"kalverra", "workflow-metrics", JobEvents, nil},
+				{"kalverra", "workflow-metrics", Observations, []string{"workflow_run_1.md"}},
+				{"kalverra", "other", JobEvents, []string{"3.json"}},
+				{"nobody", "nothing", WorkflowRuns, nil},
+			}
+			for _, list := range lists {
+				names, err := s.List(list.owner, list.repo, list.kind)
+				require.NoError(t, err, "failed to list %s/%s %s", list.owner, list.repo, list.kind)
+				if len(list.want) == 0 {
+					assert.Empty(t, names, "expected no names for %s/%s %s", list.owner, list.repo, list.kind)
+					continue
+				}
+				assert.Equal(t, list.want, names, "wrong names for %s/%s %s", list.owner, list.repo, list.kind)
+			}
+
+			repos, err = s.Repos()
+			require.NoError(t, err, "failed to list repos")
+			assert.Equal(t, []Repo{
+				{Owner: "kalverra", Repo: "other"},
+				{Owner: "kalverra", Repo: "workflow-metrics"},
+				{Owner: "smartcontractkit", Repo: "chainlink"},
+			}, repos, "repos with only observations shouldn't be listed")
+
+			assert.Equal(t, tc.location(s), s.Location("kalverra", "workflow-metrics", WorkflowRuns, "1.json"), "wrong location")
+			assert.NotEqual(t,
+				s.Location("kalverra", "workflow-metrics", WorkflowRuns, "1.json"),
+				s.Location("kalverra", "workflow-metrics", PullRequests, "1.json"),
+				"items of different kinds should have different locations",
+			)
+		})
+	}
+}
+
+func TestOpen(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		name    string
+		uri     func(dir string) string
+		want    any
+		wantErr bool
+	}{
+		{name: "default", uri: func(string) string { return "" }, want: &FileSystem{}},
+		{name: "file", uri: func(dir string) string { return "file://" + filepath.Join(dir, "data") }, want: &FileSystem{}},
+		{name: "sqlite", uri: func(dir string) string { return "sqlite://" + filepath.Join(dir, "store.db") }, want: &SQLite{}},
+		{name: "s3 without bucket", uri: func(string) string { return "s3://?endpoint=localhost:1" }, wantErr: true},
+		{name: "unknown scheme", uri: func(string) string { return "ftp://example.com" }, wantErr: true},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			dir := t.TempDir()
+			s, err := Open(tc.uri(dir), filepath.Join(dir, "data"), filepath.Join(dir, "observe_output"))
+			if tc.wantErr {
+				require.Error(t, err, "expected error opening store")
+				return
+			}
+			require.NoError(t, err, "failed to open store")
+			t.Cleanup(func() {
+				assert.NoError(t, s.Close(), "failed to close store")
+			})
+			assert.IsType(t, tc.want, s, "opened wrong kind of store")
+		})
+	}
+}
+
+// newTestS3 connects an S3 store to an in-memory S3 stand-in
+func newTestS3(t *testing.T, prefix string) *S3 {
+	t.Helper()
+
+	backend := s3mem.New()
+	require.NoError(t, backend.CreateBucket(testBucket), "failed to create bucket")
+	server := httptest.NewServer(gofakes3.New(backend).Server())
+	t.Cleanup(server.Close)
+
+	s, err := NewS3(S3Config{
+		Endpoint:  strings.TrimPrefix(server.URL, "http://"),
+		Bucket:    testBucket,
+		Prefix:    prefix,
+		Region:    "us-east-1",
+		Insecure:  true,
+		AccessKey: "access",
+		SecretKey: "secret",
+	})
+	require.NoError(t, err, "failed to open s3 store")
+	return s
+}
@@ -0,0 +1,179 @@
+// Package transport provides HTTP transports that wrap calls to the GitHub API
+package transport
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Rate limit headers GitHub responds with
+const (
+	rateLimitRemainingHeader = "X-RateLimit-Remaining"
+	rateLimitResourceHeader  = "X-RateLimit-Resource"
+
+	rateLimitEndpoint = "GET /rate_limit"
+)
+
+var (
+	// ErrBudgetExhausted is returned instead of making a request once the API call budget is spent
+	ErrBudgetExhausted = errors.New("GitHub API call budget exhausted")
+
+	numericSegment = regexp.MustCompile(`^\d+$`)
+	shaSegment     = regexp.MustCompile(`^[0-9a-f]{40}$`)
+)
+
+// EndpointCalls are the API calls made to a single endpoint
+type EndpointCalls struct {
+	// Endpoint is the method and templated path, e.g. "GET /repos/{owner}/{repo}/actions/runs/{id}"
+	Endpoint string
+	// Calls are requests that counted against the rate limit
+	Calls int
+	// NotModified are conditional requests answered from cache, which don't count against the rate limit
+	NotModified int
+}
+
+// Budget counts GitHub API calls per endpoint, and refuses to make more once the configured maximum is spent or
+// the remaining rate limit drops to the reserve
+type Budget struct {
+	next http.RoundTripper
+	// maxCalls is the most calls that will be made, 0 for unlimited
+	maxCalls int
+	// reserve is how much of the core rate limit to leave for other automation sharing the token
+	reserve int
+
+	mu        sync.Mutex
+	calls     int
+	remaining int
+	endpoints map[string]*EndpointCalls
+}
+
+// NewBudget wraps next with a budget of maxCalls API calls, leaving reserve of the rate limit. Zero disables either
+// limit.
+func NewBudget(next http.RoundTripper, maxCalls, reserve int) *Budget {
+	if next == nil {
+		next = http.DefaultTransport
+	}
+	return &Budget{
+		next:      next,
+		maxCalls:  maxCalls,
+		reserve:   reserve,
+		remaining: -1,
+		endpoints: map[string]*EndpointCalls{},
+	}
+}
+
+// RoundTrip makes the request if there is budget left, and records it against its endpoint. Conditional requests are
+// made even once the budget is spent, as they're usually answered from cache with a 304 that doesn't count against
+// the rate limit.
+func (b *Budget) RoundTrip(req *http.Request) (*http.Response, error) {
+	var (
+		endpoint    = Endpoint(req)
+		conditional = req.Header.Get("If-None-Match") != "" || req.Header.Get("If-Modified-Since") != ""
+		// Checking the rate limit doesn't count against it
+		counted = endpoint != rateLimitEndpoint
+	)
+
+	b.mu.Lock()
+	if err := b.exhausted(); err != nil && !conditional {
+		b.mu.Unlock()
+		return nil, err
+	}
+	// The call is reserved before it's made, so concurrent calls can't overspend the budget
+	if counted {
+		b.calls++
+	}
+	b.mu.Unlock()
+
+	resp, err := b.next.RoundTrip(req)
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if counted && (err != nil || resp.StatusCode == http.StatusNotModified) {
+		b.calls--
+	}
+	if err != nil {
+		return resp, err
+	}
+
+	calls, ok := b.endpoints[endpoint]
+	if !ok {
+		calls = &EndpointCalls{Endpoint: endpoint}
+		b.endpoints[endpoint] = calls
+	}
+	if resp.StatusCode == http.StatusNotModified {
+		calls.NotModified++
+	} else {
+		calls.Calls++
+	}
+	resource := resp.Header.Get(rateLimitResourceHeader)
+	if remaining, err := strconv.Atoi(resp.Header.Get(rateLimitRemainingHeader)); err == nil && (resource == "" || resource == "core") {
+		b.remaining = remaining
+	}
+	return resp, nil
+}
+
+// exhausted returns ErrBudgetExhausted if the maximum calls are spent or the rate limit is down to the reserve. The
+// caller must hold the lock.
+func (b *Budget) exhausted() error {
+	if b.maxCalls > 0 && b.calls >= b.maxCalls {
+		return fmt.Errorf("%w: made %d of a maximum %d calls", ErrBudgetExhausted, b.calls, b.maxCalls)
+	}
+	if b.reserve > 0 && b.remaining >= 0 && b.remaining <= b.reserve {
+		return fmt.Errorf("%w: %d calls left in the rate limit, reserving %d", ErrBudgetExhausted, b.remaining, b.reserve)
+	}
+	return nil
+}
+
+// Calls returns the number of API calls made that counted against the rate limit
+func (b *Budget) Calls() int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.calls
+}
+
+// Report lists the API calls made per endpoint, most called first
+func (b *Budget) Report() []EndpointCalls {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	report := make([]EndpointCalls, 0, len(b.endpoints))
+	for _, calls := range b.endpoints {
+		report = append(report, *calls)
+	}
+	sort.Slice(report, func(i, j int) bool {
+		if report[i].Calls != report[j].Calls {
+			return report[i].Calls > report[j].Calls
+		}
+		return report[i].Endpoint < report[j].Endpoint
+	})
+	return report
+}
+
+// Endpoint templates a request's path so calls to the same endpoint for different resources are grouped together,
+// e.g. "GET /repos/{owner}/{repo}/actions/runs/{id}"
+func Endpoint(req *http.Request) string {
+	segments := strings.Split(strings.Trim(req.URL.Path, "/"), "/")
+	// GitHub Enterprise Server prefixes the API with /api/v3
+	if len(segments) >= 2 && segments[0] == "api" && segments[1] == "v3" {
+		segments = segments[2:]
+	}
+	for i, segment := range segments {
+		switch {
+		case i == 1 && (segments[0] == "repos" || segments[0] == "orgs" || segments[0] == "users"):
+			segments[i] = "{owner}"
+		case i == 2 && segments[0] == "repos":
+			segments[i] = "{repo}"
+		case numericSegment.MatchString(segment):
+			segments[i] = "{id}"
+		case shaSegment.MatchString(segment):
+			segments[i] = "{sha}"
+		}
+	}
+	return fmt.Sprintf("%s /%s", req.Method, strings.Join(segments, "/"))
+}
@@ -0,0 +1,104 @@
+package transport
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newTestAPI serves every request with 200, or 304 for conditional requests
+func newTestAPI(t *testing.T) string {
+	t.Helper()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("If-None-Match") != "" {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	t.Cleanup(server.Close)
+	return server.URL
+}
+
+// budgetGet makes a GET through the budget, conditionally if etag is set
+func budgetGet(budget *Budget, url, etag string) (int, error) {
+	req, err := http.NewRequest(http.MethodGet, url, nil)
+	if err != nil {
+		return 0, err
+	}
+	if etag != "" {
+		req.Header.Set("If-None-Match", etag)
+	}
+	resp, err := budget.RoundTrip(req)
+	if err != nil {
+		return 0, err
+	}
+	return resp.StatusCode, resp.Body.Close()
+}
+
+func TestBudget(t *testing.T) {
+	t.Parallel()
+
+	url := newTestAPI(t)
+	budget := NewBudget(http.DefaultTransport, 2, 0)
+
+	status, err := budgetGet(budget, url+"/repos/kalverra/workflow-metrics/actions/runs/1", `"etag"`)
+	require.NoError(t, err, "conditional request should be made")
+	assert.Equal(t, http.StatusNotModified, status, "expected a 304")
+	assert.Zero(t, budget.Calls(), "304s shouldn't count against the budget")
+
+	for call := 1; call <= 2; call++ {
+		_, err := budgetGet(budget, url+"/repos/kalverra/workflow-metrics/actions/runs/1", "")
+		require.NoError(t, err, "call %d should be within budget", call)
+	}
+	_, err = budgetGet(budget, url+"/repos/kalverra/workflow-metrics/actions/runs/1", "")
+	require.ErrorIs(t, err, ErrBudgetExhausted, "calls past the budget should be refused")
+
+	status, err = budgetGet(budget, url+"/repos/kalverra/workflow-metrics/actions/runs/1", `"etag"`)
+	require.NoError(t, err, "conditional requests should be made once the budget is spent")
+	assert.Equal(t, http.StatusNotModified, status, "expected a 304")
+	assert.Equal(t, 2, budget.Calls(), "304s shouldn't count against the budget")
+
+	assert.Equal(t, []EndpointCalls{
+		{Endpoint: "GET /repos/{owner}/{repo}/actions/runs/{id}", Calls: 2, NotModified: 2},
+	}, budget.Report(), "wrong report")
+}
+
+func TestBudgetConcurrent(t *testing.T) {
+	t.Parallel()
+
+	const maxCalls, callers = 5, 20
+	url := newTestAPI(t)
+	budget := NewBudget(http.DefaultTransport, maxCalls, 0)
+
+	var (
+		wg      sync.WaitGroup
+		mu      sync.Mutex
+		made    int
+		refused int
+	)
+	for range callers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := budgetGet(budget, url+"/repos/kalverra/workflow-metrics/actions/runs/1", "")
+			mu.Lock()
+			defer mu.Unlock()
+			if err != nil {
+				assert.ErrorIs(t, err, ErrBudgetExhausted, "calls should only fail for the budget")
+				refused++
+				return
+			}
+			made++
+		}()
+	}
+	wg.Wait()
+	assert.Equal(t, maxCalls, made, "concurrent calls shouldn't overspend the budget")
+	assert.Equal(t, callers-maxCalls, refused, "calls past the budget should be refused")
+	assert.Equal(t, maxCalls, budget.Calls(), "wrong calls")
+}
@@ -0,0 +1,109 @@
+package transport
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httputil"
+	"os"
+	"path/filepath"
+)
+
+// Cache makes GET requests conditional on the ETag of the last response, which GitHub answers with 304 Not Modified
+// without counting against the rate limit. Responses are cached on disk so they're reused across runs.
+type Cache struct {
+	next http.RoundTripper
+	dir  string
+}
+
+// NewCache wraps next with a cache of responses stored in dir
+func NewCache(next http.RoundTripper, dir string) (*Cache, error) {
+	if next == nil {
+		next = http.DefaultTransport
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to make dir '%s': %w", dir, err)
+	}
+	return &Cache{next: next, dir: dir}, nil
+}
+
+// RoundTrip makes the request conditional on a cached response, and answers from the cache if it wasn't modified
+func (c *Cache) RoundTrip(req *http.Request) (*http.Response, error) {
+	// Rate limits change with every call, so are never worth caching
+	if req.Method != http.MethodGet || req.Header.Get("Range") != "" || Endpoint(req) == rateLimitEndpoint {
+		return c.next.RoundTrip(req)
+	}
+
+	path := c.path(req)
+	cached, err := c.read(path, req)
+	if err != nil {
+		return nil, err
+	}
+	if cached != nil {
+		req = req.Clone(req.Context())
+		req.Header.Set("If-None-Match", cached.Header.Get("ETag"))
+	}
+
+	resp, err := c.next.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+
+	switch {
+	case resp.StatusCode == http.StatusNotModified && cached != nil:
+		resp.Body.Close()
+		// Keep the fresh rate limit headers, which reflect the current state
+		for key, values := range resp.Header {
+			cached.Header[key] = values
+		}
+		return cached, nil
+	case resp.StatusCode == http.StatusOK && resp.Header.Get("ETag") != "":
+		return c.write(path, resp)
+	default:
+		return resp, nil
+	}
+}
+
+// path is the cache file for a request. It isn't keyed by authorization, as tokens are refreshed often, and GitHub
+// only answers Not Modified if the current token can read the resource.
+func (c *Cache) path(req *http.Request) string {
+	hash := sha256.New()
+	for _, part := range []string{req.URL.String(), req.Header.Get("Accept")} {
+		hash.Write([]byte(part))
+		hash.Write([]byte{0})
+	}
+	return filepath.Join(c.dir, hex.EncodeToString(hash.Sum(nil)))
+}
+
+// read returns the cached response for a request, or nil if there isn't one
+func (c *Cache) read(path string, req *http.Request) (*http.Response, error) {
+	raw, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read cached response '%s': %w", path, err)
+	}
+	resp, err := http.ReadResponse(bufio.NewReader(bytes.NewReader(raw)), req)
+	if err != nil {
+		// A corrupt cache entry is refetched and overwritten
+		return nil, nil
+	}
+	return resp, nil
+}
+
+// write caches a response, returning an unread copy of it
+func (c *Cache) write(path string, resp *http.Response) (*http.Response, error) {
+	raw, err := httputil.DumpResponse(resp, true)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read response to cache: %w", err)
+	}
+	if err := os.WriteFile(path, raw, 0600); err != nil {
+		return nil, fmt.Errorf("failed to write cached response '%s': %w", path, err)
+	}
+	return resp, nil
+}
@@ -0,0 +1,183 @@
+package transport
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httputil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+)
+
+// ErrNotRecorded is returned when replaying a request that has no recorded response
+var ErrNotRecorded = errors.New("no recorded response")
+
+const (
+	// cassetteExt is the extension of recorded responses
+	cassetteExt = ".http"
+	// enterpriseAPIPrefix is the path GitHub Enterprise Server serves the API under
+	enterpriseAPIPrefix = "/api/v3"
+	// appAPIPrefix is the path of GitHub App endpoints, which mint installation tokens and are never replayed
+	appAPIPrefix = "/app/"
+	// redacted replaces credentials in recorded responses
+	redacted = "REDACTED"
+)
+
+var (
+	unsafeFileChars = regexp.MustCompile(`[^a-zA-Z0-9]+`)
+	// tokenFields matches JSON fields holding credentials, like installation access tokens
+	tokenFields = regexp.MustCompile(`("(?:token|access_token|refresh_token)"\s*:\s*)"[^"]*"`)
+	// sensitiveHeaders are response headers that can carry credentials
+	sensitiveHeaders = []string{"Authorization", "Set-Cookie", "X-GitHub-Token"}
+)
+
+// cassette is a dir of recorded responses. Repeated requests, like polling a workflow run, are recorded in order so
+// they're replayed in the same order.
+type cassette struct {
+	dir string
+
+	mu    sync.Mutex
+	calls map[string]int
+}
+
+// next returns the name of a request's responses, and the index of its next one
+func (c *cassette) next(req *http.Request) (name string, index int) {
+	name = cassetteName(req)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	index = c.calls[name]
+	c.calls[name]++
+	return name, index
+}
+
+// path is the file of a request's response at an index
+func (c *cassette) path(name string, index int) string {
+	return filepath.Join(c.dir, fmt.Sprintf("%s_%d%s", name, index, cassetteExt))
+}
+
+// cassetteName names a request's responses by its endpoint, so cassettes can be read and edited to reproduce bugs.
+// The host and API prefix aren't part of the name, so responses recorded from GitHub Enterprise Server can be replayed
+// against any GitHub URL.
+func cassetteName(req *http.Request) string {
+	path := strings.TrimPrefix(req.URL.Path, enterpriseAPIPrefix)
+	query := req.URL.Query().Encode()
+
+	hash := sha256.New()
+	for _, part := range []string{req.Method, path, query} {
+		hash.Write([]byte(part))
+		hash.Write([]byte{0})
+	}
+	slug := strings.Trim(unsafeFileChars.ReplaceAllString(path, "_"), "_")
+	if len(slug) > 100 {
+		slug = slug[:100]
+	}
+	return fmt.Sprintf("%s_%s_%s", req.Method, slug, hex.EncodeToString(hash.Sum(nil))[:12])
+}
+
+// Recorder records every response to a cassette dir, to replay them later with a Replayer
+type Recorder struct {
+	next     http.RoundTripper
+	cassette *cassette
+}
+
+// NewRecorder wraps next with a recorder of responses to dir
+func NewRecorder(next http.RoundTripper, dir string) (*Recorder, error) {
+	if next == nil {
+		next = http.DefaultTransport
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to make dir '%s': %w", dir, err)
+	}
+	return &Recorder{next: next, cassette: &cassette{dir: dir, calls: map[string]int{}}}, nil
+}
+
+// RoundTrip makes the request and records its response, with credentials redacted. GitHub App endpoints aren't
+// recorded, as they respond with installation tokens and replaying doesn't authenticate.
+func (r *Recorder) RoundTrip(req *http.Request) (*http.Response, error) {
+	resp, err := r.next.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+	if strings.HasPrefix(strings.TrimPrefix(req.URL.Path, enterpriseAPIPrefix), appAPIPrefix) {
+		return resp, nil
+	}
+
+	body, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read response to record: %w", err)
+	}
+	resp.Body = io.NopCloser(bytes.NewReader(body))
+
+	raw, err := httputil.DumpResponse(redactResponse(resp, body), true)
+	if err != nil {
+		return nil, fmt.Errorf("failed to dump response to record: %w", err)
+	}
+	path := r.cassette.path(r.cassette.next(req))
+	if err := os.WriteFile(path, raw, 0600); err != nil {
+		return nil, fmt.Errorf("failed to record response '%s': %w", path, err)
+	}
+	return resp, nil
+}
+
+// redactResponse copies a response with its body, without credentials in its headers or body
+func redactResponse(resp *http.Response, body []byte) *http.Response {
+	redactedBody := tokenFields.ReplaceAll(body, []byte(`$1"`+redacted+`"`))
+	recorded := *resp
+	recorded.Header = resp.Header.Clone()
+	for _, header := range sensitiveHeaders {
+		if recorded.Header.Get(header) != "" {
+			recorded.Header.Set(header, redacted)
+		}
+	}
+	recorded.Body = io.NopCloser(bytes.NewReader(redactedBody))
+	recorded.ContentLength = int64(len(redactedBody))
+	return &recorded
+}
+
+// Replayer answers requests with the responses recorded by a Recorder, without any network calls
+type Replayer struct {
+	cassette *cassette
+}
+
+// NewReplayer replays the responses recorded in dir
+func NewReplayer(dir string) (*Replayer, error) {
+	info, err := os.Stat(dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read cassette dir '%s': %w", dir, err)
+	}
+	if !info.IsDir() {
+		return nil, fmt.Errorf("cassette '%s' is not a dir", dir)
+	}
+	return &Replayer{cassette: &cassette{dir: dir, calls: map[string]int{}}}, nil
+}
+
+// RoundTrip answers the request with its next recorded response. Once a request's responses run out, the last one is
+// repeated.
+func (r *Replayer) RoundTrip(req *http.Request) (*http.Response, error) {
+	name, index := r.cassette.next(req)
+	for ; index >= 0; index-- {
+		path := r.cassette.path(name, index)
+		raw, err := os.ReadFile(path)
+		if errors.Is(err, os.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read recorded response '%s': %w", path, err)
+		}
+		resp, err := http.ReadResponse(bufio.NewReader(bytes.NewReader(raw)), req)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse recorded response '%s': %w", path, err)
+		}
+		return resp, nil
+	}
+	return nil, fmt.Errorf("%w for %s %s in '%s'", ErrNotRecorded, req.Method, req.URL, r.cassette.dir)
+}
@@ -0,0 +1,59 @@
+package transport
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const testToken = "ghs_secret"
+
+func TestRecorderRedactsCredentials(t *testing.T) {
+	t.Parallel()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Set-Cookie", "session="+testToken)
+		_, _ = io.WriteString(w, `{"id": 1, "token": "`+testToken+`", "name": "workflow-metrics"}`)
+	}))
+	t.Cleanup(server.Close)
+
+	dir := t.TempDir()
+	recorder, err := NewRecorder(http.DefaultTransport, dir)
+	require.NoError(t, err, "failed to create recorder")
+	client := &http.Client{Transport: recorder}
+
+	for _, path := range []string{"/app/installations/1/access_tokens", "/api/v3/app/installations/1/access_tokens", "/repos/kalverra/workflow-metrics"} {
+		resp, err := client.Post(server.URL+path, "application/json", nil)
+		require.NoError(t, err, "failed to call %s", path)
+		body, err := io.ReadAll(resp.Body)
+		require.NoError(t, err, "failed to read response of %s", path)
+		require.NoError(t, resp.Body.Close())
+		assert.Contains(t, string(body), testToken, "callers should get the real response of %s", path)
+	}
+
+	cassettes, err := filepath.Glob(filepath.Join(dir, "*"+cassetteExt))
+	require.NoError(t, err, "failed to list cassettes")
+	require.Len(t, cassettes, 1, "only the non GitHub App response should be recorded")
+	raw, err := os.ReadFile(cassettes[0])
+	require.NoError(t, err, "failed to read cassette")
+	assert.NotContains(t, string(raw), testToken, "recorded response should be redacted")
+	assert.Contains(t, string(raw), `"token": "`+redacted+`"`, "token field should be redacted")
+
+	replayer, err := NewReplayer(dir)
+	require.NoError(t, err, "failed to create replayer")
+	req, err := http.NewRequest(http.MethodPost, server.URL+"/repos/kalverra/workflow-metrics", nil)
+	require.NoError(t, err, "failed to create request")
+	resp, err := replayer.RoundTrip(req)
+	require.NoError(t, err, "failed to replay")
+	body, err := io.ReadAll(resp.Body)
+	require.NoError(t, err, "failed to read replayed response")
+	require.NoError(t, resp.Body.Close())
+	assert.JSONEq(t, `{"id": 1, "token": "`+redacted+`", "name": "workflow-metrics"}`, string(body), "wrong replayed response")
+}
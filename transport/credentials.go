@@ -0,0 +1,31 @@
+package transport
+
+import (
+	"net/http"
+	"strings"
+)
+
+// APIHostOnlyAuth drops the credentials of requests to hosts other than the GitHub API's, like the pre-signed blob
+// storage URLs that artifacts and logs are downloaded from, so they can be made with the same client as API calls
+type APIHostOnlyAuth struct {
+	next    http.RoundTripper
+	apiHost string
+}
+
+// NewAPIHostOnlyAuth wraps next to only send credentials to apiHost, e.g. api.github.com
+func NewAPIHostOnlyAuth(next http.RoundTripper, apiHost string) *APIHostOnlyAuth {
+	if next == nil {
+		next = http.DefaultTransport
+	}
+	return &APIHostOnlyAuth{next: next, apiHost: apiHost}
+}
+
+// RoundTrip makes the request, without its credentials if it's not to the API host
+func (a *APIHostOnlyAuth) RoundTrip(req *http.Request) (*http.Response, error) {
+	if strings.EqualFold(req.URL.Host, a.apiHost) || req.Header.Get("Authorization") == "" {
+		return a.next.RoundTrip(req)
+	}
+	req = req.Clone(req.Context())
+	req.Header.Del("Authorization")
+	return a.next.RoundTrip(req)
+}
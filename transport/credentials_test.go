@@ -0,0 +1,43 @@
+package transport
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAPIHostOnlyAuth(t *testing.T) {
+	t.Parallel()
+
+	var authorization string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		authorization = r.Header.Get("Authorization")
+	}))
+	t.Cleanup(server.Close)
+	serverURL, err := url.Parse(server.URL)
+	require.NoError(t, err, "failed to parse server URL")
+
+	tests := []struct {
+		name     string
+		apiHost  string
+		expected string
+	}{
+		{name: "API host", apiHost: serverURL.Host, expected: "Bearer " + testToken},
+		{name: "other host", apiHost: "api.github.com", expected: ""},
+	}
+	for _, test := range tests {
+		client := &http.Client{Transport: NewAPIHostOnlyAuth(http.DefaultTransport, test.apiHost)}
+		req, err := http.NewRequest(http.MethodGet, server.URL, nil)
+		require.NoError(t, err, "failed to create request")
+		req.Header.Set("Authorization", "Bearer "+testToken)
+		resp, err := client.Do(req)
+		require.NoError(t, err, "failed to make request to %s", test.name)
+		require.NoError(t, resp.Body.Close())
+		assert.Equal(t, test.expected, authorization, "wrong credentials sent to %s", test.name)
+		assert.Equal(t, "Bearer "+testToken, req.Header.Get("Authorization"), "caller's request shouldn't be modified")
+	}
+}
@@ -0,0 +1,280 @@
+// Package webhook receives GitHub webhooks and gathers workflow runs as they complete
+package webhook
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/google/go-github/v70/github"
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	// deliveryTTL is how long delivery IDs are remembered to ignore redeliveries
+	deliveryTTL     = time.Hour
+	shutdownTimeout = 30 * time.Second
+)
+
+// GatherFunc gathers a completed workflow run
+type GatherFunc func(owner, repo string, workflowRunID int64) error
+
+// RecordJobFunc records a job's status change from a workflow_job event, received at receivedAt
+type RecordJobFunc func(owner, repo string, job *github.WorkflowJob, receivedAt time.Time) error
+
+// Config configures a webhook server
+type Config struct {
+	// Addr is the address to listen on, e.g. ":8080"
+	Addr string
+	// Secret is the webhook secret that payload signatures are validated with
+	Secret []byte
+	// Workers is how many workflow runs are gathered at once
+	Workers int
+	// QueueSize is how many workflow runs can wait to be gathered before new events are rejected
+	QueueSize int
+}
+
+// Server validates GitHub webhooks, records workflow_job status changes, and gathers the workflow runs of completed
+// workflow_run events with a pool of workers
+type Server struct {
+	config    Config
+	gather    GatherFunc
+	recordJob RecordJobFunc
+	queue     chan runKey
+
+	mu sync.Mutex
+	// pending are workflow runs that are queued to be gathered, so duplicate events are dropped
+	pending map[runKey]bool
+	// deliveries are recently handled delivery IDs, so redeliveries are dropped
+	deliveries map[string]time.Time
+	// closed is set once the queue is closed, as handlers can outlive a shutdown that timed out
+	closed bool
+}
+
+// runKey identifies a workflow run
+type runKey struct {
+	owner         string
+	repo          string
+	workflowRunID int64
+}
+
+// NewServer creates a webhook server that gathers workflow runs with gather, and records every workflow_job status
+// change with recordJob, if provided
+func NewServer(config Config, gather GatherFunc, recordJob RecordJobFunc) (*Server, error) {
+	if len(config.Secret) == 0 {
+		return nil, fmt.Errorf("a webhook secret is required to validate payloads")
+	}
+	if config.Workers <= 0 {
+		config.Workers = 1
+	}
+	if config.QueueSize <= 0 {
+		config.QueueSize = 100
+	}
+	return &Server{
+		config:     config,
+		gather:     gather,
+		recordJob:  recordJob,
+		queue:      make(chan runKey, config.QueueSize),
+		pending:    map[runKey]bool{},
+		deliveries: map[string]time.Time{},
+	}, nil
+}
+
+// Run serves webhooks until ctx is cancelled, then stops accepting events and finishes gathering queued workflow
+// runs
+func (s *Server) Run(ctx context.Context) error {
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /webhook", s.handleWebhook)
+	mux.HandleFunc("GET /healthz", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+	httpServer := &http.Server{
+		Addr:              s.config.Addr,
+		Handler:           mux,
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+
+	var workers sync.WaitGroup
+	for range s.config.Workers {
+		workers.Add(1)
+		go func() {
+			defer workers.Done()
+			s.work()
+		}()
+	}
+
+	serveErr := make(chan error, 1)
+	go func() {
+		log.Info().
+			Str("addr", s.config.Addr).
+			Int("workers", s.config.Workers).
+			Int("queue_size", s.config.QueueSize).
+			Msg("Serving webhooks")
+		serveErr <- httpServer.ListenAndServe()
+	}()
+
+	var err error
+	select {
+	case err = <-serveErr:
+	case <-ctx.Done():
+		log.Info().Msg("Shutting down webhook server")
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+		err = httpServer.Shutdown(shutdownCtx)
+		cancel()
+	}
+	s.mu.Lock()
+	s.closed = true
+	close(s.queue)
+	s.mu.Unlock()
+	workers.Wait()
+	if errors.Is(err, http.ErrServerClosed) {
+		return nil
+	}
+	return err
+}
+
+// handleWebhook validates a webhook and queues its workflow run to be gathered
+func (s *Server) handleWebhook(w http.ResponseWriter, r *http.Request) {
+	receivedAt := time.Now()
+	payload, err := github.ValidatePayload(r, s.config.Secret)
+	if err != nil {
+		log.Warn().Err(err).Str("remote_addr", r.RemoteAddr).Msg("Invalid webhook signature")
+		http.Error(w, "invalid signature", http.StatusUnauthorized)
+		return
+	}
+
+	var (
+		eventType  = github.WebHookType(r)
+		deliveryID = github.DeliveryID(r)
+		l          = log.With().Str("event", eventType).Str("delivery_id", deliveryID).Logger()
+	)
+	if s.delivered(deliveryID) {
+		l.Debug().Msg("Ignoring already handled webhook")
+		w.WriteHeader(http.StatusAccepted)
+		return
+	}
+
+	event, err := github.ParseWebHook(eventType, payload)
+	if err != nil {
+		l.Warn().Err(err).Msg("Failed to parse webhook")
+		http.Error(w, "invalid payload", http.StatusBadRequest)
+		return
+	}
+
+	var run *runKey
+	switch event := event.(type) {
+	case *github.WorkflowRunEvent:
+		if event.GetAction() != "completed" {
+			break
+		}
+		run = &runKey{
+			owner:         event.GetRepo().GetOwner().GetLogin(),
+			repo:          event.GetRepo().GetName(),
+			workflowRunID: event.GetWorkflowRun().GetID(),
+		}
+	case *github.WorkflowJobEvent:
+		if s.recordJob != nil {
+			err := s.recordJob(event.GetRepo().GetOwner().GetLogin(), event.GetRepo().GetName(), event.GetWorkflowJob(), receivedAt)
+			if err != nil {
+				l.Error().Err(err).Int64("job_id", event.GetWorkflowJob().GetID()).Msg("Failed to record job event")
+				http.Error(w, "failed to record job event", http.StatusInternalServerError)
+				return
+			}
+		}
+		// Job events only record the job's transitions, the workflow run is gathered once it completes
+		s.handled(deliveryID)
+		w.WriteHeader(http.StatusAccepted)
+		return
+	}
+
+	if run == nil {
+		l.Debug().Msg("Ignoring webhook event")
+		s.handled(deliveryID)
+		w.WriteHeader(http.StatusAccepted)
+		return
+	}
+	// Not marked as handled, so GitHub's redelivery is queued once there's room
+	if err := s.enqueue(*run); err != nil {
+		l.Warn().Err(err).Int64("workflow_run_id", run.workflowRunID).Msg("Failed to queue workflow run")
+		http.Error(w, err.Error(), http.StatusServiceUnavailable)
+		return
+	}
+	s.handled(deliveryID)
+	l.Debug().
+		Str("owner", run.owner).
+		Str("repo", run.repo).
+		Int64("workflow_run_id", run.workflowRunID).
+		Msg("Queued workflow run")
+	w.WriteHeader(http.StatusAccepted)
+}
+
+// delivered checks if a delivery was already handled
+func (s *Server) delivered(deliveryID string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	_, ok := s.deliveries[deliveryID]
+	return ok && deliveryID != ""
+}
+
+// handled remembers a delivery as handled, forgetting old deliveries
+func (s *Server) handled(deliveryID string) {
+	if deliveryID == "" {
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := time.Now()
+	for id, received := range s.deliveries {
+		if now.Sub(received) > deliveryTTL {
+			delete(s.deliveries, id)
+		}
+	}
+	s.deliveries[deliveryID] = now
+}
+
+// enqueue queues a workflow run to be gathered, unless it's already queued
+func (s *Server) enqueue(run runKey) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return fmt.Errorf("server is shutting down")
+	}
+	if s.pending[run] {
+		return nil
+	}
+	select {
+	case s.queue <- run:
+		s.pending[run] = true
+		return nil
+	default:
+		return fmt.Errorf("queue is full with %d workflow runs", s.config.QueueSize)
+	}
+}
+
+// work gathers queued workflow runs until the queue is closed
+func (s *Server) work() {
+	for run := range s.queue {
+		// Events for the workflow run that arrive while it's gathered queue it again, as it may have changed
+		s.mu.Lock()
+		delete(s.pending, run)
+		s.mu.Unlock()
+
+		startTime := time.Now()
+		err := s.gather(run.owner, run.repo, run.workflowRunID)
+		l := log.With().
+			Str("owner", run.owner).
+			Str("repo", run.repo).
+			Int64("workflow_run_id", run.workflowRunID).
+			Str("duration", time.Since(startTime).String()).
+			Logger()
+		if err != nil {
+			l.Error().Err(err).Msg("Failed to gather workflow run from webhook")
+			continue
+		}
+		l.Info().Msg("Gathered workflow run from webhook")
+	}
+}
@@ -0,0 +1,71 @@
+package webhook
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/google/go-github/v70/github"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var testSecret = []byte("secret")
+
+// deliver sends a signed webhook to the server, returning the response status
+func deliver(t *testing.T, s *Server, eventType, deliveryID, payload string) int {
+	t.Helper()
+
+	mac := hmac.New(sha256.New, testSecret)
+	mac.Write([]byte(payload))
+	req := httptest.NewRequest(http.MethodPost, "/webhook", bytes.NewBufferString(payload))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(github.EventTypeHeader, eventType)
+	req.Header.Set(github.DeliveryIDHeader, deliveryID)
+	req.Header.Set(github.SHA256SignatureHeader, "sha256="+hex.EncodeToString(mac.Sum(nil)))
+	recorder := httptest.NewRecorder()
+	s.handleWebhook(recorder, req)
+	return recorder.Code
+}
+
+func TestHandleWebhook(t *testing.T) {
+	t.Parallel()
+
+	var recorded []int64
+	s, err := NewServer(Config{Secret: testSecret}, func(string, string, int64) error { return nil },
+		func(_, _ string, job *github.WorkflowJob, _ time.Time) error {
+			recorded = append(recorded, job.GetID())
+			return nil
+		},
+	)
+	require.NoError(t, err, "failed to create server")
+
+	const repo = `"repository": {"name": "workflow-metrics", "owner": {"login": "kalverra"}}`
+	for i, action := range []string{"queued", "in_progress", "completed"} {
+		status := deliver(t, s, "workflow_job", "job-"+action,
+			`{"action": "`+action+`", "workflow_job": {"id": 10, "run_id": 1}, `+repo+`}`)
+		assert.Equal(t, http.StatusAccepted, status, "job event should be accepted")
+		assert.Len(t, recorded, i+1, "every job event should be recorded")
+	}
+	assert.Empty(t, s.queue, "job events shouldn't queue their workflow run to be gathered")
+
+	status := deliver(t, s, "workflow_run", "run-in-progress", `{"action": "in_progress", "workflow_run": {"id": 1}, `+repo+`}`)
+	assert.Equal(t, http.StatusAccepted, status, "in progress workflow run event should be accepted")
+	assert.Empty(t, s.queue, "in progress workflow runs shouldn't be gathered")
+
+	status = deliver(t, s, "workflow_run", "run-completed", `{"action": "completed", "workflow_run": {"id": 1}, `+repo+`}`)
+	assert.Equal(t, http.StatusAccepted, status, "completed workflow run event should be accepted")
+	require.Len(t, s.queue, 1, "completed workflow runs should be gathered")
+	assert.Equal(t, runKey{owner: "kalverra", repo: "workflow-metrics", workflowRunID: 1}, <-s.queue, "wrong workflow run queued")
+
+	s.mu.Lock()
+	s.closed = true
+	s.mu.Unlock()
+	status = deliver(t, s, "workflow_run", "run-after-shutdown", `{"action": "completed", "workflow_run": {"id": 2}, `+repo+`}`)
+	assert.Equal(t, http.StatusServiceUnavailable, status, "workflow runs shouldn't be queued after shutdown")
+}